@@ -13,6 +13,7 @@ var (
 	MysqlConf  *xconfig.MysqlConfig
 	RedisConf  *xconfig.RedisConfig
 	LoggerConf *xconfig.LogConfig
+	CorsConf   *xconfig.CorsConfig
 )
 
 func LoadConf(path string) error {
@@ -35,12 +36,13 @@ func LoadConf(path string) error {
 	initMysqlConf()
 	initRedisConf()
 	initLogConf()
+	initCorsConf()
 
 	return nil
 }
 
 func setDefault() {
-
+	viper.SetDefault("cors.maxAge", "12h")
 }
 
 func initServerConf() {
@@ -50,6 +52,11 @@ func initServerConf() {
 		Name: viper.GetString("server.name"),
 		Mode: viper.GetString("server.mode"),
 		NodeId: viper.GetInt("server.nodeId"),
+		CertFile: viper.GetString("server.certFile"),
+		KeyFile: viper.GetString("server.keyFile"),
+		ClientCAFile: viper.GetString("server.clientCAFile"),
+		RequireClientCert: viper.GetBool("server.requireClientCert"),
+		CertReloadInterval: viper.GetDuration("server.certReloadInterval"),
 	}
 }
 
@@ -81,3 +88,11 @@ func initLogConf() {
 		Caller: viper.GetBool("log.caller"),
 	}
 }
+
+func initCorsConf() {
+	CorsConf = &xconfig.CorsConfig{
+		AllowOrigins:     viper.GetStringSlice("cors.allowOrigins"),
+		AllowCredentials: viper.GetBool("cors.allowCredentials"),
+		MaxAge:           viper.GetDuration("cors.maxAge"),
+	}
+}
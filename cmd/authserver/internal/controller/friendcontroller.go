@@ -42,14 +42,3 @@ func (c *FriendController) GetAllFriendsInfo(ctx *gin.Context) *easygin.Result {
 
 	return easygin.Ok(friends)
 }
-
-// GetOnlineFriends 查询用户在线状态, 返回在线的用户ID
-func (c *FriendController) GetOnlineFriends(ctx *gin.Context) *easygin.Result {
-	value, exists := ctx.Get("id")
-	if !exists {
-		return easygin.Error(http.StatusUnauthorized, -1)
-	}
-	id := value.(int64)
-	onlineFriends := c.friendService.GetOnlineFriends(id)
-	return easygin.Ok(onlineFriends)
-}
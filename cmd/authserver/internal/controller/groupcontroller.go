@@ -0,0 +1,125 @@
+package controller
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mangohow/easygin"
+	"github.com/mangohow/imchat/cmd/authserver/internal/log"
+	"github.com/mangohow/imchat/cmd/authserver/internal/resultcode"
+	"github.com/mangohow/imchat/cmd/authserver/internal/service"
+	"github.com/mangohow/imchat/pkg/model"
+	"github.com/sirupsen/logrus"
+)
+
+/*
+
+	GroupController 群组controller
+*/
+type GroupController struct {
+	groupService *service.GroupService
+	logger       *logrus.Logger
+}
+
+func NewGroupController() *GroupController {
+	return &GroupController{
+		groupService: service.NewGroupService(),
+		logger:       log.Logger(),
+	}
+}
+
+// CreateGroup 创建群
+// POST /api/auth/group json: {name, members}
+func (c *GroupController) CreateGroup(ctx *gin.Context, create *model.GroupCreate) *easygin.Result {
+	value, exists := ctx.Get("id")
+	if !exists {
+		return easygin.Error(http.StatusUnauthorized, -1)
+	}
+	if err := validate.Struct(create); err != nil {
+		c.logger.Errorf("validate failed:%v", err)
+		return easygin.Fail(resultcode.ParamInvalid)
+	}
+
+	group, err := c.groupService.CreateGroup(value.(int64), create)
+	if err != nil {
+		return c.groupError(err)
+	}
+
+	return easygin.Ok(group)
+}
+
+// GetGroups 获取加入的所有群
+// GET /api/auth/groups
+func (c *GroupController) GetGroups(ctx *gin.Context) *easygin.Result {
+	value, exists := ctx.Get("id")
+	if !exists {
+		return easygin.Error(http.StatusUnauthorized, -1)
+	}
+
+	return easygin.Ok(c.groupService.GetGroups(value.(int64)))
+}
+
+// GetMembers 获取群成员ID
+// GET /api/auth/group/members param: groupId
+func (c *GroupController) GetMembers(ctx *gin.Context, groupId int64) *easygin.Result {
+	value, exists := ctx.Get("id")
+	if !exists {
+		return easygin.Error(http.StatusUnauthorized, -1)
+	}
+
+	members, err := c.groupService.GetMembers(value.(int64), groupId)
+	if err != nil {
+		return c.groupError(err)
+	}
+
+	return easygin.Ok(members)
+}
+
+// AddMembers 邀请好友入群
+// POST /api/auth/group/members json: {groupId, members}
+func (c *GroupController) AddMembers(ctx *gin.Context, add *model.GroupMembersAdd) *easygin.Result {
+	value, exists := ctx.Get("id")
+	if !exists {
+		return easygin.Error(http.StatusUnauthorized, -1)
+	}
+	if err := validate.Struct(add); err != nil {
+		c.logger.Errorf("validate failed:%v", err)
+		return easygin.Fail(resultcode.ParamInvalid)
+	}
+
+	if err := c.groupService.AddMembers(value.(int64), add); err != nil {
+		return c.groupError(err)
+	}
+
+	return easygin.Ok(nil)
+}
+
+// QuitGroup 退出群
+// DELETE /api/auth/group/member param: groupId
+func (c *GroupController) QuitGroup(ctx *gin.Context, groupId int64) *easygin.Result {
+	value, exists := ctx.Get("id")
+	if !exists {
+		return easygin.Error(http.StatusUnauthorized, -1)
+	}
+
+	if err := c.groupService.QuitGroup(value.(int64), groupId); err != nil {
+		return c.groupError(err)
+	}
+
+	return easygin.Ok(nil)
+}
+
+func (c *GroupController) groupError(err error) *easygin.Result {
+	switch err {
+	case service.GroupNotExist:
+		return easygin.Fail(resultcode.GroupNotExist)
+	case service.NotGroupMember:
+		return easygin.Fail(resultcode.NotGroupMember)
+	case service.NotFriendError:
+		return easygin.Fail(resultcode.NotFriend)
+	case service.GroupOwnerCannotQuit:
+		return easygin.Fail(resultcode.GroupOwnerCannotQuit)
+	}
+
+	return easygin.Fail(resultcode.OperationFailed)
+}
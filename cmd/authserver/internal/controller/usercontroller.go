@@ -8,6 +8,8 @@ import (
 	"github.com/mangohow/imchat/cmd/authserver/internal/log"
 	"github.com/mangohow/imchat/cmd/authserver/internal/resultcode"
 	"github.com/mangohow/imchat/cmd/authserver/internal/service"
+	"github.com/mangohow/imchat/pkg/consts"
+	"github.com/mangohow/imchat/pkg/consts/redisconsts"
 	"github.com/mangohow/imchat/pkg/model"
 	"github.com/mangohow/imchat/pkg/utils"
 	"github.com/sirupsen/logrus"
@@ -87,7 +89,8 @@ func (c *UserController) Register(user *model.UserRegister) *easygin.Result {
 
 // Login 用户登录认证
 // GET /api/login
-func (c *UserController) Login(user *model.UserLogin) *easygin.Result {
+// token同时保存到cookie中, 浏览器可以直接使用cookie建立websocket连接
+func (c *UserController) Login(ctx *gin.Context, user *model.UserLogin) *easygin.Result {
 	// 参数验证
 	err := validate.Struct(user)
 	if err != nil {
@@ -110,6 +113,9 @@ func (c *UserController) Login(user *model.UserLogin) *easygin.Result {
 		return easygin.Fail(resultcode.UsernameOrPasswordInvalid)
 	}
 
+	ctx.SetSameSite(http.SameSiteLaxMode)
+	ctx.SetCookie(consts.TokenCookie, token, int(redisconsts.TokenExpireDuration.Seconds()), "/", "", ctx.Request.TLS != nil, true)
+
 	u.Password = ""
 	return easygin.Ok(map[string]interface{}{
 		"user": u,
@@ -131,6 +137,24 @@ func (c *UserController) GetUserInfo(id int64) *easygin.Result {
 	return easygin.Ok(userinfo)
 }
 
+// CreateWsTicket 获取websocket登录票据, 票据只能使用一次, 有效期30s
+// 浏览器不能在websocket握手时设置header, 可以通过url参数ticket传入票据
+// POST /api/auth/wsTicket
+func (c *UserController) CreateWsTicket(ctx *gin.Context) *easygin.Result {
+	id, token := ctx.GetInt64("id"), ctx.GetString("token")
+	if id == 0 || token == "" {
+		return easygin.Error(http.StatusInternalServerError, -1)
+	}
+
+	ticket, err := c.userService.CreateWsTicket(id, token)
+	if err != nil {
+		c.logger.Errorf("create ws ticket error:%v", err)
+		return easygin.Fail(resultcode.ServerException)
+	}
+
+	return easygin.Ok(ticket)
+}
+
 // GetSelfInfo 获取自己信息
 // GET /api/selfinfo
 func (c *UserController) GetSelfInfo(ctx *gin.Context) *easygin.Result {
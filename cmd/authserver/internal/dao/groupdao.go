@@ -0,0 +1,66 @@
+package dao
+
+import (
+	"github.com/mangohow/imchat/cmd/authserver/internal/log"
+	"github.com/mangohow/imchat/pkg/model"
+	"github.com/sirupsen/logrus"
+)
+
+// 群组dao，获取群信息和群成员
+
+type GroupDao struct {
+	logger *logrus.Logger
+}
+
+func NewGroupDao() *GroupDao {
+	return &GroupDao{
+		logger: log.Logger(),
+	}
+}
+
+// CreateGroup 创建群并添加群成员
+func (d *GroupDao) CreateGroup(group *model.Group, members []*model.GroupMember) (err error) {
+	db := mysqlDB.Begin()
+	if err = db.Table("t_group").Create(group).Error; err != nil {
+		db.Rollback()
+		return err
+	}
+	if err = db.Table("t_group_member").Create(members).Error; err != nil {
+		db.Rollback()
+		return err
+	}
+	return db.Commit().Error
+}
+
+func (d *GroupDao) FindGroupById(id int64) (*model.Group, error) {
+	group := new(model.Group)
+	err := mysqlDB.Table("t_group").Where("id = ?", id).First(group).Error
+	return group, err
+}
+
+// FindGroupsByUserId 查询用户加入的所有群
+func (d *GroupDao) FindGroupsByUserId(userId int64) (groups []*model.Group) {
+	mysqlDB.Table("t_group").
+		Where("id IN (?)", mysqlDB.Table("t_group_member").Select("group_id").Where("user_id = ?", userId)).
+		Find(&groups)
+	return
+}
+
+func (d *GroupDao) FindMemberIds(groupId int64) (ids []int64) {
+	mysqlDB.Table("t_group_member").Where("group_id = ?", groupId).Pluck("user_id", &ids)
+	return
+}
+
+func (d *GroupDao) IsMember(groupId, userId int64) bool {
+	var count int64
+	mysqlDB.Table("t_group_member").Where("group_id = ? and user_id = ?", groupId, userId).Count(&count)
+	return count != 0
+}
+
+func (d *GroupDao) AddMembers(members []*model.GroupMember) error {
+	return mysqlDB.Table("t_group_member").Create(members).Error
+}
+
+func (d *GroupDao) DelMember(groupId, userId int64) error {
+	return mysqlDB.Table("t_group_member").Where("group_id = ? and user_id = ?", groupId, userId).Delete(&model.GroupMember{}).Error
+}
@@ -18,6 +18,11 @@ const (
 	QueryFailed
 	OperationFailed
 	ServerException
+
+	GroupNotExist
+	NotGroupMember
+	NotFriend
+	GroupOwnerCannotQuit
 )
 
 
@@ -40,6 +45,11 @@ var messager = map[int]string{
 	QueryFailed: "查询失败，请重试",
 	OperationFailed: "操作失败，请重试",
 	ServerException: "服务器异常",
+
+	GroupNotExist: "群不存在",
+	NotGroupMember: "不是群成员",
+	NotFriend: "只能邀请好友入群",
+	GroupOwnerCannotQuit: "群主不能退出群",
 }
 
 func MessageFunc(code int) string {
@@ -2,11 +2,22 @@ package routes
 
 import (
 	"github.com/mangohow/easygin"
+	"github.com/mangohow/imchat/cmd/authserver/internal/conf"
 	"github.com/mangohow/imchat/cmd/authserver/internal/controller"
 	"github.com/mangohow/imchat/cmd/authserver/internal/middleware"
+	"github.com/mangohow/imchat/pkg/common/xcors"
+	"github.com/mangohow/imchat/pkg/common/xmetrics"
 )
 
 func Register(router *easygin.EasyGin) {
+	// 跨域, 需要在权限验证之前
+	if cors := xcors.Middleware(conf.CorsConf); cors != nil {
+		router.Use(cors)
+	}
+	// 监控指标
+	xmetrics.Register(router.Engine)
+	router.Use(xmetrics.Middleware())
+
 	group := router.Group("/api")
 	userController := controller.NewUserController()
 	group.GET("/phoneCode", userController.GetPhoneVerificationCode)
@@ -17,9 +28,16 @@ func Register(router *easygin.EasyGin) {
 	authedGroup := router.Group("/api/auth")
 	authedGroup.Use(middleware.Authentication())
 	authedGroup.GET("/selfinfo", userController.GetSelfInfo)
+	authedGroup.POST("/wsTicket", userController.CreateWsTicket)
 
 	friendController := controller.NewFriendController()
 	authedGroup.GET("/friends", friendController.GetAllFriendsInfo)
-	authedGroup.GET("/onlineFriends", friendController.GetOnlineFriends)
+
+	groupController := controller.NewGroupController()
+	authedGroup.POST("/group", groupController.CreateGroup)
+	authedGroup.GET("/groups", groupController.GetGroups)
+	authedGroup.GET("/group/members", groupController.GetMembers)
+	authedGroup.POST("/group/members", groupController.AddMembers)
+	authedGroup.DELETE("/group/member", groupController.QuitGroup)
 }
 
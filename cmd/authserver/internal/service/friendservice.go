@@ -123,35 +123,3 @@ func (s *FriendService) GetAllFriends(userId int64) ([]*model.FriendDTO, error)
 
 	return friendInfos, nil
 }
-
-func (s *FriendService) GetOnlineFriends(id int64) []int64 {
-	script :=
-`
-local res = redis.call('SMEMBERS', KEYS[1])
-if not res then
-	return nil
-end
-
-local retVal = {}
-for i, v in pairs(res) do
-	local r = redis.call('EXISTS', KEYS[2]..v)
-	if r == 1 then
-		table.insert(retVal, v)
-	end
-end
-
-return retVal
-`
-
-	key := redisconsts.FriendsKey + strconv.Itoa(int(id))
-	res := s.redis.Eval(context.Background(), script, []string{key, redisconsts.ChatServerClientKey})
-	result, err := res.Int64Slice()
-	if err != nil {
-		s.logger.Errorf("get online friends error:%v", err)
-	}
-
-	return result
-}
-
-
-
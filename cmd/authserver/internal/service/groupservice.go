@@ -0,0 +1,206 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/elliotchance/pie/v2"
+	"github.com/go-redis/redis/v8"
+	"github.com/mangohow/imchat/cmd/authserver/internal/dao"
+	"github.com/mangohow/imchat/cmd/authserver/internal/log"
+	"github.com/mangohow/imchat/cmd/authserver/internal/rdsconn"
+	"github.com/mangohow/imchat/pkg/consts/redisconsts"
+	"github.com/mangohow/imchat/pkg/model"
+	"github.com/mangohow/imchat/pkg/utils"
+	"github.com/sirupsen/logrus"
+)
+
+// GroupService 群组服务
+// 群成员保存在mysql中，同时在redis中维护一份群成员集合 group:members:<gid>
+// chatserver和messageserver通过该集合判断用户是否为群成员
+type GroupService struct {
+	dao       *dao.GroupDao
+	friendDao *dao.FriendDao
+	redis     *redis.Client
+	logger    *logrus.Logger
+}
+
+func NewGroupService() *GroupService {
+	return &GroupService{
+		dao:       dao.NewGroupDao(),
+		friendDao: dao.NewContactFriendDao(),
+		redis:     rdsconn.RedisConn(),
+		logger:    log.Logger(),
+	}
+}
+
+var (
+	GroupNotExist        = errors.New("group not exist")
+	NotGroupMember       = errors.New("not group member")
+	NotFriendError       = errors.New("not friend")
+	GroupOwnerCannotQuit = errors.New("group owner can not quit")
+)
+
+// CreateGroup 创建群, 被拉入群的成员必须是群主的好友
+func (s *GroupService) CreateGroup(ownerId int64, create *model.GroupCreate) (*model.Group, error) {
+	members := pie.Unique(pie.Filter(create.Members, func(id int64) bool {
+		return id != ownerId
+	}))
+	if !s.allFriends(ownerId, members) {
+		return nil, NotFriendError
+	}
+
+	id, err := s.generateGroupId()
+	if err != nil {
+		s.logger.Errorf("generate group id error:%v", err)
+		return nil, err
+	}
+
+	now := time.Now()
+	group := &model.Group{
+		Id:         id,
+		Name:       create.Name,
+		OwnerId:    ownerId,
+		CreateTime: now,
+	}
+
+	groupMembers := make([]*model.GroupMember, 0, len(members)+1)
+	groupMembers = append(groupMembers, &model.GroupMember{
+		GroupId:  id,
+		UserId:   ownerId,
+		Role:     model.GroupRoleOwner,
+		JoinTime: now,
+	})
+	for _, member := range members {
+		groupMembers = append(groupMembers, &model.GroupMember{
+			GroupId:  id,
+			UserId:   member,
+			Role:     model.GroupRoleMember,
+			JoinTime: now,
+		})
+	}
+
+	if err = s.dao.CreateGroup(group, groupMembers); err != nil {
+		s.logger.Errorf("create group error:%v", err)
+		return nil, err
+	}
+
+	s.cacheMembers(id, append(members, ownerId))
+
+	return group, nil
+}
+
+// AddMembers 群成员邀请自己的好友入群
+func (s *GroupService) AddMembers(userId int64, add *model.GroupMembersAdd) error {
+	if !s.dao.IsMember(add.GroupId, userId) {
+		return NotGroupMember
+	}
+
+	exists := s.dao.FindMemberIds(add.GroupId)
+	members, _ := pie.Diff(exists, pie.Unique(add.Members))
+	if len(members) == 0 {
+		return nil
+	}
+	if !s.allFriends(userId, members) {
+		return NotFriendError
+	}
+
+	now := time.Now()
+	groupMembers := pie.Map(members, func(id int64) *model.GroupMember {
+		return &model.GroupMember{
+			GroupId:  add.GroupId,
+			UserId:   id,
+			Role:     model.GroupRoleMember,
+			JoinTime: now,
+		}
+	})
+	if err := s.dao.AddMembers(groupMembers); err != nil {
+		s.logger.Errorf("add group members error:%v", err)
+		return err
+	}
+
+	s.cacheMembers(add.GroupId, members)
+
+	return nil
+}
+
+// QuitGroup 退出群, 群主不能退出
+func (s *GroupService) QuitGroup(userId, groupId int64) error {
+	group, err := s.dao.FindGroupById(groupId)
+	if err != nil {
+		return GroupNotExist
+	}
+	if group.OwnerId == userId {
+		return GroupOwnerCannotQuit
+	}
+
+	if err = s.dao.DelMember(groupId, userId); err != nil {
+		s.logger.Errorf("del group member error:%v", err)
+		return err
+	}
+
+	key := redisconsts.GroupMembersKey + strconv.Itoa(int(groupId))
+	if err = s.redis.SRem(context.Background(), key, userId).Err(); err != nil {
+		s.logger.Errorf("remove group member cache error:%v", err)
+	}
+
+	return nil
+}
+
+// GetGroups 查询用户加入的所有群
+func (s *GroupService) GetGroups(userId int64) []*model.Group {
+	return s.dao.FindGroupsByUserId(userId)
+}
+
+// GetMembers 查询群成员, 只有群成员可以查询
+func (s *GroupService) GetMembers(userId, groupId int64) ([]int64, error) {
+	ids := s.dao.FindMemberIds(groupId)
+	if !pie.Contains(ids, userId) {
+		return nil, NotGroupMember
+	}
+
+	// 重新同步redis中的群成员
+	key := redisconsts.GroupMembersKey + strconv.Itoa(int(groupId))
+	pip := s.redis.TxPipeline()
+	pip.Del(context.Background(), key)
+	pip.SAdd(context.Background(), key, utils.ToInterfaceSlice(ids)...)
+	if _, err := pip.Exec(context.Background()); err != nil {
+		s.logger.Errorf("cache group members error:%v", err)
+	}
+
+	return ids, nil
+}
+
+func (s *GroupService) cacheMembers(groupId int64, members []int64) {
+	key := redisconsts.GroupMembersKey + strconv.Itoa(int(groupId))
+	if err := s.redis.SAdd(context.Background(), key, utils.ToInterfaceSlice(members)...).Err(); err != nil {
+		s.logger.Errorf("cache group members error:%v", err)
+	}
+}
+
+func (s *GroupService) allFriends(userId int64, ids []int64) bool {
+	friendIds := pie.Map(s.friendDao.FindFriendsById(userId), func(t *model.Friend) int64 {
+		return t.FriendId
+	})
+	return pie.All(ids, func(id int64) bool {
+		return pie.Contains(friendIds, id)
+	})
+}
+
+// 生成群ID
+// 与用户ID一样由 时间戳(48bit) + 计数器(16bit) 生成
+// 计数器只通过INCR原子递增, 取低16位, 不重置, 同一秒内创建的群不超过65536个时不会重复
+func (s *GroupService) generateGroupId() (int64, error) {
+	n, err := s.redis.Incr(context.Background(), redisconsts.GroupCounterKey).Result()
+	if err != nil {
+		return 0, err
+	}
+
+	return groupId(time.Now(), n), nil
+}
+
+func groupId(now time.Time, n int64) int64 {
+	return now.Unix()<<16 | int64(uint16(n))
+}
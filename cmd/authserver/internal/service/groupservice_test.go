@@ -0,0 +1,58 @@
+package service
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+	"github.com/mangohow/imchat/pkg/consts/redisconsts"
+)
+
+func TestGroupId(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	if id := groupId(now, 1); id>>16 != now.Unix() || id&0xffff != 1 {
+		t.Fatalf("unexpected group id: %x", id)
+	}
+	// 计数器超过16位时取低16位, 不会影响时间戳
+	if a, b := groupId(now, 0xffff), groupId(now, 0x10000); a == b || b>>16 != now.Unix() {
+		t.Fatalf("unexpected group ids: %x %x", a, b)
+	}
+}
+
+// 并发生成群ID, 计数器回绕时也不会重复
+func TestGenerateGroupIdConcurrent(t *testing.T) {
+	s := miniredis.RunT(t)
+	rds := redis.NewClient(&redis.Options{Addr: s.Addr()})
+	defer rds.Close()
+	if err := s.Set(redisconsts.GroupCounterKey, "65500"); err != nil {
+		t.Fatal(err)
+	}
+
+	svc := &GroupService{redis: rds}
+	var (
+		mux sync.Mutex
+		wg  sync.WaitGroup
+		ids = make(map[int64]struct{})
+	)
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			id, err := svc.generateGroupId()
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			mux.Lock()
+			ids[id] = struct{}{}
+			mux.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	if len(ids) != 100 {
+		t.Fatalf("expect 100 unique ids, got %d", len(ids))
+	}
+}
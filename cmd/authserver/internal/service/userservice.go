@@ -2,6 +2,8 @@ package service
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/base64"
 	"encoding/json"
 	"errors"
 	"math"
@@ -175,6 +177,25 @@ func (s *UserService) CheckUserLogin(login *model.UserLogin) (user *model.User,
 }
 
 
+// CreateWsTicket 生成websocket登录票据, 浏览器建立websocket连接时通过url参数传入
+// 票据只能使用一次, 同时刷新redis中的token, chatserver使用票据换取token后按照token进行认证
+func (s *UserService) CreateWsTicket(id int64, token string) (string, error) {
+	buf := make([]byte, 24)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	ticket := base64.RawURLEncoding.EncodeToString(buf)
+
+	pipeline := s.redis.Pipeline()
+	pipeline.Set(context.Background(), redisconsts.TokenKey+strconv.Itoa(int(id)), token, redisconsts.TokenExpireDuration)
+	pipeline.Set(context.Background(), redisconsts.WsTicketKey+ticket, token, redisconsts.WsTicketDuration)
+	if _, err := pipeline.Exec(context.Background()); err != nil {
+		return "", err
+	}
+
+	return ticket, nil
+}
+
 type userStatus int
 
 const (
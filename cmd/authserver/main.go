@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"net/http"
@@ -12,6 +13,7 @@ import (
 	"github.com/mangohow/imchat/cmd/authserver/internal/log"
 	"github.com/mangohow/imchat/cmd/authserver/internal/rdsconn"
 	"github.com/mangohow/imchat/cmd/authserver/internal/routes"
+	"github.com/mangohow/imchat/pkg/common/xtls"
 )
 
 func main() {
@@ -42,12 +44,18 @@ func main() {
 	// 注册路由
 	routes.Register(easyGin)
 
-	easyGin.SetAfterCloseHandlers(func() {
+	// 配置了证书时使用https
+	tlsConfig, err := xtls.NewServerConfig(context.Background(), conf.ServerConf, func(err error) {
+		log.Logger().Errorf("reload certificate error:%v", err)
+	})
+	if err != nil {
+		panic(fmt.Errorf("init tls error, reason:%v", err))
+	}
+
+	err = xtls.ServeEasyGin(easyGin, fmt.Sprintf("%s:%d", conf.ServerConf.Host, conf.ServerConf.Port), tlsConfig, func() {
 		dao.CloseMysql()
 		rdsconn.CloseRedis()
 	})
-
-	err := easyGin.ListenAndServe(fmt.Sprintf("%s:%d", conf.ServerConf.Host, conf.ServerConf.Port))
 	if err != nil {
 		if err == http.ErrServerClosed {
 			fmt.Println("server closed")
@@ -4,37 +4,134 @@ import (
 	"bytes"
 	"encoding/binary"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/gorilla/websocket"
+	"github.com/mangohow/imchat/pkg/common/xframe"
+	"github.com/mangohow/imchat/pkg/consts"
+	"github.com/mangohow/imchat/proto/pb"
 	"google.golang.org/protobuf/proto"
 )
 
 // Client websocket库不支持并发写，因此需要在写数据时进行加锁
 // 采用读写分离的方式来解决: 启动两个goroutine来读写数据
+// 底层连接可以是websocket或tcp, 参考Transport
 type Client struct {
-	wsc *websocket.Conn
+	conn Transport
 	authed bool
 
 	mux sync.RWMutex
 	kvs map[string]interface{}
 
 	ch chan writeData
+	// 写队列中的字节数
+	queuedBytes atomic.Int64
+	// 写队列的配置
+	opts *WriteOptions
+	// 因为接收太慢被断开
+	slowOnce sync.Once
+
+	// 连接建立的时间
+	createTime time.Time
+
+	// 客户端使用的帧格式版本, 收到V1帧后升级
+	frameVersion atomic.Uint32
+	// 是否协商了permessage-deflate
+	deflate bool
+	// 握手时选择的编解码方式
+	codec Codec
+	// 握手时协商的协议版本
+	protocolVersion int
+
+	// 心跳相关, 参考heartbeat.go
+	// 最近一次ping的往返时间(纳秒)
+	rtt atomic.Int64
+	// 最后一次发送请求的时间(纳秒)
+	lastActive atomic.Int64
+	// 保证AfterClientCloseHandler只调用一次
+	closeOnce sync.Once
 }
 
 type writeData struct {
 	wsMsgType int
 	data []byte
+	// 消息ID, 用于监控, 不是帧数据时为0
+	msgId uint32
 }
 
-func NewClient(conn *websocket.Conn) *Client {
-	return &Client{
-		wsc: conn,
+func NewClient(conn Transport, opts *WriteOptions) *Client {
+	if opts == nil {
+		opts = DefaultWriteOptions
+	}
+	c := &Client{
+		conn: conn,
 		kvs: make(map[string]interface{}),
-		ch: make(chan writeData, 1024),
+		ch: make(chan writeData, WriteQueueLen),
+		opts: opts,
+		createTime: time.Now(),
+		codec: ProtoCodec,
+		protocolVersion: consts.MinProtocolVersion,
+	}
+	c.touch(c.createTime)
+
+	return c
+}
+
+// ProtocolVersion 客户端的协议版本, 处理器可以根据版本进行不同的处理
+func (c *Client) ProtocolVersion() int {
+	return c.protocolVersion
+}
+
+// Codec 客户端使用的编解码方式
+func (c *Client) Codec() Codec {
+	return c.codec
+}
+
+func (c *Client) CreateTime() time.Time {
+	return c.createTime
+}
+
+// FrameVersion 客户端使用的帧格式版本
+func (c *Client) FrameVersion() uint8 {
+	return uint8(c.frameVersion.Load())
+}
+
+func (c *Client) setFrameVersion(version uint8) {
+	if version > c.FrameVersion() {
+		c.frameVersion.Store(uint32(version))
 	}
 }
 
+// 发送前对数据进行处理, 返回实际发送的websocket消息类型和数据
+// 通过Write写入的都是protobuf帧, 发送给json客户端之前需要转换格式, 发送给protobuf客户端之前进行压缩
+func (c *Client) encodeFrame(res writeData) (int, []byte, error) {
+	if res.wsMsgType != websocket.BinaryMessage {
+		return res.wsMsgType, res.data, nil
+	}
+	if c.codec == ProtoCodec {
+		return res.wsMsgType, c.compressFrame(res.data), nil
+	}
+
+	data, err := transcode(c.codec, res.data)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	return c.codec.MessageType(), data, nil
+}
+
+// 发送前进行应用层压缩
+// 客户端需要使用V1帧才能识别压缩标志, 已经协商了permessage-deflate的不需要再压缩
+func (c *Client) compressFrame(data []byte) []byte {
+	opts := c.opts.Compress
+	if opts == nil || opts.MinSize <= 0 || c.deflate || c.FrameVersion() < xframe.Version1 {
+		return data
+	}
+
+	return opts.compress(data)
+}
+
 func (c *Client) Authed() bool {
 	return c.authed
 }
@@ -78,11 +175,29 @@ func (c *Client) GetUid() int64 {
 	return id
 }
 
+// GetDevice 获取设备ID, 在握手阶段由客户端传入
+func (c *Client) GetDevice() string {
+	device, _ := c.GetString("device")
+	return device
+}
+
+// GetPlatform 获取客户端平台, 如ios、android、pc、web
+func (c *Client) GetPlatform() string {
+	platform, _ := c.GetString("platform")
+	return platform
+}
+
+// DeviceKey 平台和设备ID一起确定用户的一个设备, 格式为<platform>:<device>
+func (c *Client) DeviceKey() string {
+	return DeviceKey(c.GetPlatform(), c.GetDevice())
+}
+
+func DeviceKey(platform, device string) string {
+	return platform + ":" + device
+}
+
 func (c *Client) Write(data []byte) {
-	c.ch <- writeData{
-		wsMsgType: websocket.BinaryMessage,
-		data:      data,
-	}
+	c.WriteMessage(websocket.BinaryMessage, data)
 }
 
 func (c *Client) WriteData(respId uint32, data []byte) {
@@ -98,36 +213,134 @@ func (c *Client) WriteData(respId uint32, data []byte) {
 }
 
 func (c *Client) WriteProtoMessage(respId uint32, message proto.Message) error {
+	return c.writeFrame(xframe.Header{MsgId: respId}, message)
+}
+
+// 使用客户端的编解码方式生成帧, 放入写队列中
+func (c *Client) writeFrame(header xframe.Header, message proto.Message) error {
+	data, err := c.codec.Encode(header, message)
+	if err != nil {
+		return err
+	}
+
+	c.enqueue(writeData{wsMsgType: c.codec.MessageType(), data: data, msgId: header.MsgId})
+	return nil
+}
+
+// WriteError 发送错误帧给客户端, msgId为出错的请求的消息ID
+func (c *Client) WriteError(code int32, message string, msgId uint32) error {
+	return c.WriteProtoMessage(consts.ErrorMessage, &pb.Error{
+		Code:    code,
+		Message: message,
+		MsgId:   msgId,
+	})
+}
+
+// MarshalProtoMessage 生成发送给客户端或其它服务器的数据: 4字节消息ID + protobuf数据
+func MarshalProtoMessage(id uint32, message proto.Message) ([]byte, error) {
 	buf := make([]byte, 4)
-	binary.LittleEndian.PutUint32(buf, respId)
+	binary.LittleEndian.PutUint32(buf, id)
 
 	buffer := bytes.NewBuffer(buf)
 
 	data, err := proto.Marshal(message)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	buffer.Write(data)
 
-	c.Write(buffer.Bytes())
-	return nil
+	return buffer.Bytes(), nil
 }
 
+// WriteMessage 将数据放入写队列中, 不会阻塞
+// 写队列满了或者超过了字节数限制时, 根据SlowConsumerPolicy来处理
 func (c *Client) WriteMessage(messageType int, data []byte) {
-	c.ch <- writeData{
-		wsMsgType: messageType,
-		data:      data,
+	res := writeData{wsMsgType: messageType, data: data}
+	if messageType == websocket.BinaryMessage {
+		res.msgId, _ = xframe.PeekMsgId(data)
+	}
+	c.enqueue(res)
+}
+
+func (c *Client) enqueue(res writeData) {
+	data := res.data
+	size := int64(len(data))
+	if c.opts.MaxQueueBytes > 0 && c.queuedBytes.Add(size) > c.opts.MaxQueueBytes {
+		c.queuedBytes.Add(-size)
+		c.slowConsumer(res.wsMsgType, data)
+		return
+	}
+
+	select {
+	case c.ch <- res:
+	default:
+		if c.opts.MaxQueueBytes > 0 {
+			c.queuedBytes.Add(-size)
+		}
+		c.slowConsumer(res.wsMsgType, data)
 	}
 }
 
+// 从写队列中取出数据后调用
+func (c *Client) dequeued(res writeData) {
+	if c.opts.MaxQueueBytes > 0 {
+		c.queuedBytes.Add(-int64(len(res.data)))
+	}
+}
+
+// QueueLen 写队列中等待发送的消息数
+func (c *Client) QueueLen() int {
+	return len(c.ch)
+}
+
+// QueueBytes 写队列中等待发送的字节数
+func (c *Client) QueueBytes() int64 {
+	return c.queuedBytes.Load()
+}
+
+// Congested 写队列中的数据超过了一半的容量
+func (c *Client) Congested() bool {
+	if c.QueueLen() > WriteQueueLen/2 {
+		return true
+	}
+	return c.opts.MaxQueueBytes > 0 && c.QueueBytes() > c.opts.MaxQueueBytes/2
+}
+
+// 写队列满了
+// disconnect: 丢弃数据并断开连接, 客户端重连后拉取离线消息
+// spill: 丢弃数据, 交给SpillFunc处理, 连接不会断开
+func (c *Client) slowConsumer(messageType int, data []byte) {
+	if c.opts.SlowConsumerPolicy == SlowConsumerSpill && c.opts.Spill != nil {
+		c.opts.Spill(c, messageType, data)
+		return
+	}
+
+	c.DisconnectSlowConsumer()
+}
+
+// DisconnectSlowConsumer 断开接收太慢的连接, 只会执行一次
+// 写队列可能已经满了, 关闭帧直接通过WriteControl发送, 并且不能阻塞调用者
+func (c *Client) DisconnectSlowConsumer() {
+	c.slowOnce.Do(func() {
+		slowConsumerDisconnects.Add(1)
+		go c.Kick(consts.CloseSlowConsumer, SlowConsumerReason)
+	})
+}
+
 func (c *Client) WriteControl(messageType int, data []byte, deadline time.Time) error {
-	return c.wsc.WriteControl(messageType, data, deadline)
+	return c.conn.WriteControl(messageType, data, deadline)
 }
 
 func (c *Client) Close() error {
-	return c.wsc.Close()
+	return c.conn.Close()
+}
+
+// Kick 发送关闭帧告诉客户端被下线的原因，然后关闭连接
+func (c *Client) Kick(code int, reason string) error {
+	_ = c.conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, reason), ControlDeadline())
+	return c.conn.Close()
 }
 
 func (c *Client) RemoteAddr() string {
-	return c.wsc.RemoteAddr().String()
+	return c.conn.RemoteAddr().String()
 }
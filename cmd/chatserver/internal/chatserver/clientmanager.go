@@ -4,41 +4,69 @@ import (
 	"sync"
 )
 
+// IClientManager 一个用户可以在多个设备上同时登录
+// 同一个用户的连接通过平台和设备ID(Client.DeviceKey)来区分, 不同平台上相同的设备ID是不同的设备
 type IClientManager interface {
-	// Get 根据id获取Client
-	Get(id int64) *Client
-	
+	// Get 根据id获取该用户在本服务器上的所有Client
+	Get(id int64) []*Client
+
+	// GetDevice 根据id、平台和设备ID获取Client
+	GetDevice(id int64, platform, device string) *Client
+
 	// Add 添加一个Client
 	Add(id int64, c *Client)
-	
-	// Del 删除一个Client
+
+	// Del 删除该用户的所有Client
 	Del(id int64)
 
+	// Replace 添加一个Client，返回被替换掉的同一设备上的Client
+	Replace(id int64, c *Client) *Client
+
+	// Remove 只有id和设备对应的Client为c时才删除, 返回是否删除
+	Remove(id int64, c *Client) bool
+
 	// Clear 清理所有连接，关闭连接并delete
 	Clear()
+
+	// Range 遍历所有Client, fn返回false时停止遍历, fn中不能修改manager
+	Range(fn func(id int64, c *Client) bool)
 }
 
 var ClientManagerInstance = IClientManager(&clientManager{
-	clients: make(map[int64]*Client),
+	clients: make(map[int64]map[string]*Client),
 })
 
 type clientManager struct {
-	clients map[int64]*Client
+	// uid -> platform:device -> Client
+	clients map[int64]map[string]*Client
 	rwm     sync.RWMutex
 }
 
 
-func (m *clientManager) Get(id int64) *Client {
+func (m *clientManager) Get(id int64) []*Client {
 	m.rwm.RLock()
-	c := m.clients[id]
+	devices := m.clients[id]
+	if len(devices) == 0 {
+		m.rwm.RUnlock()
+		return nil
+	}
+	res := make([]*Client, 0, len(devices))
+	for _, c := range devices {
+		res = append(res, c)
+	}
+	m.rwm.RUnlock()
+	return res
+}
+
+func (m *clientManager) GetDevice(id int64, platform, device string) *Client {
+	m.rwm.RLock()
+	c := m.clients[id][DeviceKey(platform, device)]
 	m.rwm.RUnlock()
 	return c
 }
 
 func (m *clientManager) Add(id int64, c *Client) {
-	m.rwm.Lock()
-	m.clients[id] = c
-	m.rwm.Unlock()
+	m.Replace(id, c)
 }
 
 func (m *clientManager) Del(id int64) {
@@ -47,11 +75,54 @@ func (m *clientManager) Del(id int64) {
 	m.rwm.Unlock()
 }
 
+func (m *clientManager) Replace(id int64, c *Client) *Client {
+	device := c.DeviceKey()
+	m.rwm.Lock()
+	devices := m.clients[id]
+	if devices == nil {
+		devices = make(map[string]*Client)
+		m.clients[id] = devices
+	}
+	old := devices[device]
+	devices[device] = c
+	m.rwm.Unlock()
+	return old
+}
+
+func (m *clientManager) Remove(id int64, c *Client) bool {
+	device := c.DeviceKey()
+	m.rwm.Lock()
+	defer m.rwm.Unlock()
+	devices := m.clients[id]
+	if devices[device] != c {
+		return false
+	}
+	delete(devices, device)
+	if len(devices) == 0 {
+		delete(m.clients, id)
+	}
+	return true
+}
+
 func (m *clientManager) Clear() {
 	m.rwm.Lock()
-	for _, client := range m.clients {
-		_ = client.Close()
+	for _, devices := range m.clients {
+		for _, client := range devices {
+			_ = client.Close()
+		}
 	}
-	m.clients = make(map[int64]*Client)
+	m.clients = make(map[int64]map[string]*Client)
 	m.rwm.Unlock()
-}
\ No newline at end of file
+}
+
+func (m *clientManager) Range(fn func(id int64, c *Client) bool) {
+	m.rwm.RLock()
+	defer m.rwm.RUnlock()
+	for id, devices := range m.clients {
+		for _, client := range devices {
+			if !fn(id, client) {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package chatserver
+
+import (
+	"testing"
+)
+
+func newTestClient(uid int64, device string) *Client {
+	c := &Client{kvs: make(map[string]interface{})}
+	c.Set("id", uid)
+	c.Set("device", device)
+	return c
+}
+
+func TestClientManagerMultiDevice(t *testing.T) {
+	m := &clientManager{clients: make(map[int64]map[string]*Client)}
+
+	phone := newTestClient(1, "phone")
+	pc := newTestClient(1, "pc")
+	if old := m.Replace(1, phone); old != nil {
+		t.Fatal("unexpected old client")
+	}
+	m.Add(1, pc)
+	if n := len(m.Get(1)); n != 2 {
+		t.Fatalf("expect 2 clients, got %d", n)
+	}
+
+	// 同一设备重新登录, 旧连接被替换
+	phone2 := newTestClient(1, "phone")
+	if old := m.Replace(1, phone2); old != phone {
+		t.Fatal("expect phone to be replaced")
+	}
+
+	// 被替换的连接关闭时不能删除新的连接
+	if m.Remove(1, phone) {
+		t.Fatal("replaced client should not be removed")
+	}
+	if m.GetDevice(1, "", "phone") != phone2 {
+		t.Fatal("new client was removed")
+	}
+
+	if !m.Remove(1, phone2) || !m.Remove(1, pc) {
+		t.Fatal("remove failed")
+	}
+	if m.Get(1) != nil {
+		t.Fatal("expect no clients")
+	}
+}
+
+// 不同平台上相同的设备ID是不同的设备, 不会互相替换
+func TestClientManagerPlatformCollision(t *testing.T) {
+	m := &clientManager{clients: make(map[int64]map[string]*Client)}
+
+	ios := newTestClient(1, "default")
+	ios.Set("platform", "ios")
+	web := newTestClient(1, "default")
+	web.Set("platform", "web")
+	m.Replace(1, ios)
+	if old := m.Replace(1, web); old != nil {
+		t.Fatal("client on another platform should not be replaced")
+	}
+	if n := len(m.Get(1)); n != 2 {
+		t.Fatalf("expect 2 clients, got %d", n)
+	}
+	if m.GetDevice(1, "ios", "default") != ios || m.GetDevice(1, "web", "default") != web {
+		t.Fatal("get device returned wrong client")
+	}
+
+	if !m.Remove(1, web) || m.GetDevice(1, "ios", "default") != ios {
+		t.Fatal("remove affected client on another platform")
+	}
+}
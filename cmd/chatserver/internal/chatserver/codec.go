@@ -0,0 +1,199 @@
+package chatserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/gorilla/websocket"
+	"github.com/mangohow/imchat/pkg/common/xframe"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+/*
+	客户端和服务器之间数据的编解码方式, 在握手时通过codec参数选择, 每个连接只能使用一种
+
+	proto: 二进制帧, 帧头参考xframe, 消息体为protobuf数据, 默认使用
+	json:  文本帧, 方便浏览器和调试工具使用, 格式为:
+	       {"id": 消息ID, "requestId": 请求ID, "flags": 标志, "data": protojson格式的消息}
+
+	服务器之间转发的数据始终使用protobuf, 发送给json客户端之前再转换为json
+*/
+
+const (
+	CodecProto = "proto"
+	CodecJSON  = "json"
+
+	// CodecParam 握手时选择编解码方式的url参数或header
+	CodecParam = "codec"
+)
+
+type Codec interface {
+	Name() string
+
+	// MessageType 发送数据时使用的websocket消息类型
+	MessageType() int
+
+	// Decode 解析客户端发送的帧, 返回帧头和消息体
+	Decode(data []byte) (xframe.Header, []byte, error)
+
+	// Encode 生成发送给客户端的帧
+	Encode(header xframe.Header, message proto.Message) ([]byte, error)
+
+	// Unmarshal 将Decode返回的消息体解析为message
+	Unmarshal(body []byte, message proto.Message) error
+}
+
+var (
+	ProtoCodec Codec = protoCodec{}
+	JSONCodec  Codec = jsonCodec{}
+)
+
+// CodecFromRequest 根据握手请求选择编解码方式, 不支持时返回nil
+func CodecFromRequest(r *http.Request) Codec {
+	name := r.URL.Query().Get(CodecParam)
+	if name == "" {
+		name = r.Header.Get(CodecParam)
+	}
+
+	switch name {
+	case "", CodecProto:
+		return ProtoCodec
+	case CodecJSON:
+		return JSONCodec
+	}
+
+	return nil
+}
+
+type protoCodec struct{}
+
+func (protoCodec) Name() string {
+	return CodecProto
+}
+
+func (protoCodec) MessageType() int {
+	return websocket.BinaryMessage
+}
+
+func (protoCodec) Decode(data []byte) (xframe.Header, []byte, error) {
+	return xframe.Decode(data)
+}
+
+func (protoCodec) Encode(header xframe.Header, message proto.Message) ([]byte, error) {
+	data, err := proto.Marshal(message)
+	if err != nil {
+		return nil, err
+	}
+
+	return xframe.Encode(header, data), nil
+}
+
+func (protoCodec) Unmarshal(body []byte, message proto.Message) error {
+	return proto.Unmarshal(body, message)
+}
+
+type jsonFrame struct {
+	Id        uint32          `json:"id"`
+	RequestId uint32          `json:"requestId,omitempty"`
+	Flags     uint8           `json:"flags,omitempty"`
+	Data      json.RawMessage `json:"data,omitempty"`
+}
+
+type jsonCodec struct{}
+
+func (jsonCodec) Name() string {
+	return CodecJSON
+}
+
+func (jsonCodec) MessageType() int {
+	return websocket.TextMessage
+}
+
+// Decode json帧没有版本的区别, 按V1帧处理, 响应时会带上请求ID
+func (jsonCodec) Decode(data []byte) (xframe.Header, []byte, error) {
+	var frame jsonFrame
+	if err := json.Unmarshal(data, &frame); err != nil {
+		return xframe.Header{}, nil, err
+	}
+
+	header := xframe.Header{
+		Version:   xframe.Version1,
+		Flags:     frame.Flags,
+		MsgId:     frame.Id,
+		RequestId: frame.RequestId,
+	}
+
+	return header, frame.Data, nil
+}
+
+func (jsonCodec) Encode(header xframe.Header, message proto.Message) ([]byte, error) {
+	frame := jsonFrame{
+		Id:        header.MsgId,
+		RequestId: header.RequestId,
+		Flags:     header.Flags &^ xframe.FlagCompressed,
+	}
+
+	if message != nil {
+		data, err := protojson.Marshal(message)
+		if err != nil {
+			return nil, err
+		}
+		frame.Data = data
+	}
+
+	return json.Marshal(&frame)
+}
+
+func (jsonCodec) Unmarshal(body []byte, message proto.Message) error {
+	if len(body) == 0 {
+		return nil
+	}
+	return protojson.UnmarshalOptions{DiscardUnknown: true}.Unmarshal(body, message)
+}
+
+// 消息ID对应的protobuf类型, 用于将服务器之间转发的protobuf数据转换为其它格式
+var messageTypes = make(map[uint32]proto.Message)
+
+// RegisterMessageType 注册消息ID对应的protobuf类型, 需要在服务启动前注册
+// 使用HandlerAnyFunc注册的请求会自动注册, 服务器推送的消息需要手动注册
+func RegisterMessageType(id uint32, message proto.Message) {
+	messageTypes[id] = message
+}
+
+// MessageTypeRegistered 消息ID是否注册了protobuf类型, 没有注册的消息不能发送给使用JSON的客户端
+func MessageTypeRegistered(id uint32) bool {
+	_, ok := messageTypes[id]
+	return ok
+}
+
+// 创建消息ID对应的protobuf类型, 未注册时返回nil
+func newMessageOf(id uint32) proto.Message {
+	m, ok := messageTypes[id]
+	if !ok {
+		return nil
+	}
+	return m.ProtoReflect().New().Interface()
+}
+
+// 将protobuf帧转换为codec对应的格式
+func transcode(codec Codec, data []byte) ([]byte, error) {
+	header, body, err := xframe.Decode(data)
+	if err != nil {
+		return nil, err
+	}
+
+	var message proto.Message
+	if len(body) > 0 {
+		message = newMessageOf(header.MsgId)
+		if message == nil {
+			return nil, fmt.Errorf("unregistered message type:%d", header.MsgId)
+		}
+		if err = proto.Unmarshal(body, message); err != nil {
+			return nil, err
+		}
+	}
+
+	return codec.Encode(header, message)
+}
@@ -0,0 +1,137 @@
+package chatserver
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"testing"
+
+	"github.com/gorilla/websocket"
+	"github.com/mangohow/imchat/pkg/consts"
+	"github.com/mangohow/imchat/proto/pb"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+// 读取写队列中的数据, 经过发送前的处理后返回json帧
+func readTestJSONFrame(t *testing.T, c *Client) jsonFrame {
+	var frame jsonFrame
+	select {
+	case res := <-c.ch:
+		msgType, data, err := c.encodeFrame(res)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if msgType != websocket.TextMessage {
+			t.Fatalf("expect text message, got %d", msgType)
+		}
+		if err = json.Unmarshal(data, &frame); err != nil {
+			t.Fatal(err)
+		}
+	default:
+		t.Fatal("no data written")
+	}
+	return frame
+}
+
+func TestJSONCodec(t *testing.T) {
+	var forward []byte
+	h := NewMessageHandler()
+	h.HandlerAnyFunc(consts.TypingMessage, func(ctx *Context, typing *pb.Typing) (*pb.Typing, error) {
+		if typing.Receiver == 0 {
+			return nil, NewError(consts.ErrCodeInvalidParam, "invalid")
+		}
+		forward = ctx.Message.RawData
+		ctx.SetRespId(consts.TypingMessage)
+		return typing, nil
+	})
+
+	c := NewClient(nil, nil)
+	c.codec = JSONCodec
+	handle := func(data string) {
+		header, body, err := c.codec.Decode([]byte(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		msg := &Message{MsgId: header.MsgId, Version: header.Version, RequestId: header.RequestId, ProtoData: body}
+		if err = h.Handle(c, msg); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	handle(`{"id":50001,"requestId":5,"data":{"sender":"1","receiver":"2","typing":true}}`)
+	frame := readTestJSONFrame(t, c)
+	if frame.Id != consts.TypingMessage || frame.RequestId != 5 {
+		t.Fatalf("unexpected frame: %+v", frame)
+	}
+	resp := new(pb.Typing)
+	if err := protojson.Unmarshal(frame.Data, resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Sender != 1 || resp.Receiver != 2 || !resp.Typing {
+		t.Fatalf("unexpected response: %v", resp)
+	}
+
+	// 转发给其它服务器的数据为protobuf格式
+	if len(forward) < MessageTypeLen || binary.LittleEndian.Uint32(forward) != consts.TypingMessage {
+		t.Fatal("raw data should be protobuf frame")
+	}
+
+	// 错误帧
+	handle(`{"id":50001,"requestId":6,"data":{"sender":"1"}}`)
+	frame = readTestJSONFrame(t, c)
+	if frame.Id != consts.ErrorMessage || frame.RequestId != 6 {
+		t.Fatalf("unexpected frame: %+v", frame)
+	}
+
+	// 其它服务器转发过来的protobuf数据, 发送前转换为json
+	c.Write(forward)
+	frame = readTestJSONFrame(t, c)
+	if frame.Id != consts.TypingMessage || frame.RequestId != 0 {
+		t.Fatalf("unexpected frame: %+v", frame)
+	}
+	push := new(pb.Typing)
+	if err := protojson.Unmarshal(frame.Data, push); err != nil {
+		t.Fatal(err)
+	}
+	if push.Receiver != 2 {
+		t.Fatalf("unexpected push: %v", push)
+	}
+
+	// 没有消息体的推送
+	c.WriteData(consts.NewMessage, nil)
+	if frame = readTestJSONFrame(t, c); frame.Id != consts.NewMessage || frame.Data != nil {
+		t.Fatalf("unexpected frame: %+v", frame)
+	}
+}
+
+// 注册了多个处理器时, json请求转发的数据使用对应处理器的类型生成
+func TestJSONRawDataPerHandler(t *testing.T) {
+	var forward []byte
+	h := NewMessageHandler()
+	h.HandlerAnyFunc(consts.HelloRequest, func(ctx *Context, hello *pb.Hello) {})
+	h.HandlerAnyFunc(consts.TypingMessage, func(ctx *Context, typing *pb.Typing) {})
+	h.HandlerAnyFunc(consts.SingleChatMessage, func(ctx *Context, chat *pb.SingleChat) {
+		forward = ctx.Message.RawData
+	})
+
+	c := NewClient(nil, nil)
+	c.codec = JSONCodec
+	header, body, err := c.codec.Decode([]byte(`{"id":3,"data":{"sender":"1","receiver":"2","message":"aGk="}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = h.Handle(c, &Message{MsgId: header.MsgId, Version: header.Version, ProtoData: body}); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(forward) <= MessageTypeLen || binary.LittleEndian.Uint32(forward) != consts.SingleChatMessage {
+		t.Fatalf("unexpected raw data: %x", forward)
+	}
+	chat := new(pb.SingleChat)
+	if err = proto.Unmarshal(forward[MessageTypeLen:], chat); err != nil {
+		t.Fatal(err)
+	}
+	if chat.Sender != 1 || chat.Receiver != 2 || string(chat.Message) != "hi" {
+		t.Fatalf("unexpected forwarded message: %v", chat)
+	}
+}
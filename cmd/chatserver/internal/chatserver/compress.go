@@ -0,0 +1,61 @@
+package chatserver
+
+import (
+	"github.com/mangohow/imchat/pkg/common/xconfig"
+	"github.com/mangohow/imchat/pkg/common/xframe"
+)
+
+// CompressOptions 发送数据的压缩配置
+//  1. permessage-deflate: 握手时协商, 由websocket库压缩所有数据
+//  2. 应用层压缩: 只压缩指定类型并且超过MinSize的消息, 设置帧头中的FlagCompressed标志,
+//     只对使用V1帧的客户端生效, 已经协商了permessage-deflate的连接不会再压缩
+type CompressOptions struct {
+	// 握手时协商permessage-deflate
+	Deflate bool
+	// permessage-deflate的压缩级别
+	Level int
+	// 应用层压缩的最小字节数, 为0时不压缩
+	MinSize int
+	// 需要进行应用层压缩的消息ID
+	MsgIds map[uint32]struct{}
+}
+
+func NewCompressOptions(conf *xconfig.CompressionConfig) *CompressOptions {
+	if conf == nil {
+		return nil
+	}
+
+	opts := &CompressOptions{
+		Deflate: conf.Deflate,
+		Level:   conf.Level,
+		MinSize: conf.MinSize,
+		MsgIds:  make(map[uint32]struct{}, len(conf.MsgIds)),
+	}
+	for _, id := range conf.MsgIds {
+		opts.MsgIds[id] = struct{}{}
+	}
+
+	return opts
+}
+
+// 应用层压缩, 返回实际发送给客户端的数据
+// 旧格式的帧会转换为V1帧, 压缩后没有变小的不压缩
+func (o *CompressOptions) compress(data []byte) []byte {
+	header, body, err := xframe.Decode(data)
+	if err != nil || header.HasFlag(xframe.FlagCompressed) || len(body) < o.MinSize {
+		return data
+	}
+	if _, ok := o.MsgIds[header.MsgId]; !ok {
+		return data
+	}
+
+	compressed, err := xframe.Compress(body)
+	if err != nil || len(compressed) >= len(body) {
+		return data
+	}
+
+	header.Version = xframe.Version1
+	header.Flags |= xframe.FlagCompressed
+
+	return xframe.Encode(header, compressed)
+}
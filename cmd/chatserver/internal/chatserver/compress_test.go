@@ -0,0 +1,66 @@
+package chatserver
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/mangohow/imchat/pkg/common/xconfig"
+	"github.com/mangohow/imchat/pkg/common/xframe"
+	"github.com/mangohow/imchat/pkg/consts"
+)
+
+func TestCompressFrame(t *testing.T) {
+	opts := *DefaultWriteOptions
+	opts.Compress = NewCompressOptions(&xconfig.CompressionConfig{
+		MinSize: 1024,
+		MsgIds:  []uint32{consts.SingleChatMessage},
+	})
+
+	body := bytes.Repeat([]byte("hello "), 1000)
+	push := xframe.Encode(xframe.Header{MsgId: consts.SingleChatMessage}, body)
+
+	// 旧格式的客户端不压缩
+	c := NewClient(nil, &opts)
+	if res := c.compressFrame(push); !bytes.Equal(res, push) {
+		t.Fatal("v0 client should not be compressed")
+	}
+
+	// 使用V1帧的客户端, 推送的消息转换为压缩的V1帧
+	c.setFrameVersion(xframe.Version1)
+	res := c.compressFrame(push)
+	if len(res) >= len(push) {
+		t.Fatalf("expect compressed, len:%d", len(res))
+	}
+	header, data, err := xframe.Decode(res)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if header.Version != xframe.Version1 || !header.HasFlag(xframe.FlagCompressed) || header.MsgId != consts.SingleChatMessage {
+		t.Fatalf("unexpected header: %+v", header)
+	}
+	if !bytes.Equal(data, body) {
+		t.Fatal("decompressed data mismatch")
+	}
+
+	// 响应中的请求ID保持不变
+	resp := xframe.Encode(xframe.Header{Version: xframe.Version1, Flags: xframe.FlagResponse, MsgId: consts.SingleChatMessage, RequestId: 7}, body)
+	header, _, _ = xframe.Decode(c.compressFrame(resp))
+	if header.RequestId != 7 || !header.HasFlag(xframe.FlagResponse) || !header.HasFlag(xframe.FlagCompressed) {
+		t.Fatalf("unexpected header: %+v", header)
+	}
+
+	// 太小的消息和不需要压缩的消息类型不压缩
+	small := xframe.Encode(xframe.Header{MsgId: consts.SingleChatMessage}, body[:100])
+	other := xframe.Encode(xframe.Header{MsgId: consts.TypingMessage}, body)
+	for _, data := range [][]byte{small, other} {
+		if res := c.compressFrame(data); !bytes.Equal(res, data) {
+			t.Fatal("should not be compressed")
+		}
+	}
+
+	// 已经协商了permessage-deflate的不再压缩
+	c.deflate = true
+	if res := c.compressFrame(push); !bytes.Equal(res, push) {
+		t.Fatal("deflate client should not be compressed")
+	}
+}
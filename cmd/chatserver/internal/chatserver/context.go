@@ -3,11 +3,25 @@ package chatserver
 import (
 	"math"
 	"sync"
+
+	"github.com/mangohow/imchat/cmd/chatserver/internal/log"
+	"github.com/mangohow/imchat/pkg/common/xframe"
+	"github.com/mangohow/imchat/pkg/consts"
+	"github.com/mangohow/imchat/proto/pb"
+	"google.golang.org/protobuf/proto"
 )
 
 type Message struct {
 	MsgId     uint32
+	// 帧格式版本, 旧格式为0
+	Version   uint8
+	Flags     uint8
+	// 客户端生成的请求ID, 响应时原样带回
+	RequestId uint32
+	// 4字节消息ID + protobuf数据, 无论客户端使用哪种帧格式和编解码方式, 都可以直接转发给其它服务器
+	// json客户端的请求在HandlerAnyFunc解析消息体之后才会生成
 	RawData   []byte
+	// 消息体, 需要使用客户端的Codec解析
 	ProtoData []byte
 }
 
@@ -68,3 +82,34 @@ func (c *Context) GetRespId() uint32 {
 	return c.respId
 }
 
+// WriteProtoMessage 发送响应给客户端
+// 如果请求使用的是V1帧, 响应也使用V1帧, 并带上请求中的请求ID
+func (c *Context) WriteProtoMessage(respId uint32, message proto.Message) error {
+	header := xframe.Header{MsgId: respId}
+	if c.Message.Version != xframe.Version0 {
+		header.Version = c.Message.Version
+		header.Flags = xframe.FlagResponse
+		header.RequestId = c.Message.RequestId
+	}
+
+	return c.writeFrame(header, message)
+}
+
+// WriteError 发送错误帧给客户端, 告诉客户端请求处理失败的原因
+func (c *Context) WriteError(code int32, message string) error {
+	return c.WriteProtoMessage(consts.ErrorMessage, &pb.Error{
+		Code:    code,
+		Message: message,
+		MsgId:   c.Message.MsgId,
+	})
+}
+
+// writeHandlerError 将处理器返回的错误转换为错误帧
+func (c *Context) writeHandlerError(err error) {
+	e, ok := err.(*Error)
+	if !ok {
+		log.Logger().Errorf("handle message error, msgId:%d, err:%v", c.Message.MsgId, err)
+		e = ErrInternal
+	}
+	_ = c.WriteError(e.Code, e.Message)
+}
@@ -0,0 +1,119 @@
+package chatserver
+
+import (
+	"context"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/mangohow/imchat/pkg/consts"
+	"github.com/mangohow/imchat/proto/pb"
+)
+
+/*
+	关闭服务时排空连接, 滚动发布时不丢失消息:
+	1. 停止接收新连接, 排空期间完成握手的连接直接关闭
+	2. 通知所有客户端重连到其它服务器(ReconnectNotify), 在写队列的末尾加入关闭帧,
+	   写goroutine发送完队列中的数据后再关闭连接
+	3. 等待连接关闭, 连接关闭时AfterClientCloseHandler会删除redis中的路由, 之后的消息不会再转发到本服务器
+	4. 调用RegisterOnDrain注册的函数, 如停止从消息队列中读取数据
+	5. 超时后仍然没有关闭的连接由RegisterOnShutdown注册的函数处理
+
+	消息在转发前已经保存到数据库中了, 留在本服务器消息队列中的数据不需要重新转发,
+	客户端重连后会拉取离线消息
+*/
+
+const (
+	// DefaultDrainTimeout 默认的排空超时时间
+	DefaultDrainTimeout = time.Second * 30
+	// DrainReason 排空时关闭连接的原因
+	DrainReason = "server is shutting down"
+
+	// 超时后关闭剩余连接时, 等待连接清理的时间
+	closeGraceDuration = time.Second
+)
+
+// SuggestNodeFunc 返回建议客户端重连的服务器地址
+type SuggestNodeFunc func(c *Client) string
+
+// SetSuggestNodeFunc 设置排空时建议客户端重连的服务器
+func (s *ChatServer) SetSuggestNodeFunc(fn SuggestNodeFunc) {
+	s.suggestNode = fn
+}
+
+// RegisterOnDrain 注册排空连接之后调用的函数
+func (s *ChatServer) RegisterOnDrain(fn func()) {
+	s.onDrain = append(s.onDrain, fn)
+}
+
+// Draining 是否正在排空连接
+func (s *ChatServer) Draining() bool {
+	return s.draining.Load()
+}
+
+// Connections 本服务器上的连接数, 包括还没有认证的
+func (s *ChatServer) Connections() int64 {
+	return s.activeConns.Load()
+}
+
+// Drain 排空连接, ctx结束时返回ctx.Err(), 剩余的连接不会被关闭
+func (s *ChatServer) Drain(ctx context.Context) error {
+	if !s.draining.CompareAndSwap(false, true) {
+		return nil
+	}
+
+	// 停止接收新连接, 已经建立的websocket连接不受影响
+	if s.tcpListener != nil {
+		_ = s.tcpListener.Close()
+	}
+	if err := s.ws.Shutdown(ctx); err != nil {
+		s.logger.Errorf("shutdown websocket server error:%v", err)
+	}
+
+	n := 0
+	s.clientManager.Range(func(id int64, c *Client) bool {
+		s.migrate(c)
+		n++
+		return true
+	})
+	s.logger.Infof("draining %d clients", n)
+
+	err := s.waitConnections(ctx)
+	if err != nil {
+		s.logger.Errorf("drain timeout, %d connections remain", s.Connections())
+	}
+
+	for _, fn := range s.onDrain {
+		fn()
+	}
+
+	return err
+}
+
+// 通知客户端重连到其它服务器, 写队列中的数据发送完之后关闭连接
+func (s *ChatServer) migrate(c *Client) {
+	var address string
+	if s.suggestNode != nil {
+		address = s.suggestNode(c)
+	}
+
+	_ = c.WriteProtoMessage(consts.ReconnectNotify, &pb.Reconnect{
+		Address: address,
+		Reason:  DrainReason,
+	})
+	c.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseServiceRestart, DrainReason))
+}
+
+// 等待所有连接关闭
+func (s *ChatServer) waitConnections(ctx context.Context) error {
+	ticker := time.NewTicker(time.Millisecond * 50)
+	defer ticker.Stop()
+	for s.Connections() > 0 {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+
+	return nil
+}
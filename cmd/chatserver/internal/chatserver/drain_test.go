@@ -0,0 +1,83 @@
+package chatserver
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/mangohow/imchat/pkg/consts"
+	"github.com/mangohow/imchat/proto/pb"
+)
+
+func TestDrain(t *testing.T) {
+	s, addr := newTestTCPServer(t)
+	s.SetSuggestNodeFunc(func(c *Client) string {
+		return "10.0.0.2:6387"
+	})
+	drained := false
+	s.RegisterOnDrain(func() {
+		drained = true
+	})
+
+	conn := dialTestTCP(t, addr, &pb.Login{Token: "token", Device: "100"})
+	if header := readTestTCPFrame(t, conn, new(pb.LoginReply)); header.MsgId != consts.LoginReply {
+		t.Fatalf("expect login reply, got %d", header.MsgId)
+	}
+
+	clients := ClientManagerInstance.Get(100)
+	if len(clients) != 1 {
+		t.Fatalf("expect 1 client, got %d", len(clients))
+	}
+	// 排空前写队列中的数据需要发送给客户端
+	for _, message := range []string{"a", "b", "c"} {
+		data, _ := MarshalProtoMessage(consts.HelloReply, &pb.Hello{Message: message})
+		clients[0].Write(data)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- s.Drain(context.Background())
+	}()
+
+	for _, message := range []string{"a", "b", "c"} {
+		hello := new(pb.Hello)
+		if header := readTestTCPFrame(t, conn, hello); header.MsgId != consts.HelloReply || hello.Message != message {
+			t.Fatalf("expect queued message %s, got %d %s", message, header.MsgId, hello.Message)
+		}
+	}
+	reconnect := new(pb.Reconnect)
+	if header := readTestTCPFrame(t, conn, reconnect); header.MsgId != consts.ReconnectNotify {
+		t.Fatalf("expect reconnect notify, got %d", header.MsgId)
+	}
+	if reconnect.Address != "10.0.0.2:6387" {
+		t.Fatalf("unexpected address: %s", reconnect.Address)
+	}
+	_, _, err := conn.ReadMessage()
+	if !websocket.IsCloseError(err, websocket.CloseServiceRestart) {
+		t.Fatalf("expect service restart close, got %v", err)
+	}
+	conn.Close()
+
+	select {
+	case err = <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second * 5):
+		t.Fatal("drain not finished")
+	}
+	if !drained {
+		t.Fatal("drain hooks not called")
+	}
+	if len(ClientManagerInstance.Get(100)) != 0 {
+		t.Fatal("client not removed")
+	}
+
+	// 排空后不再接收新连接
+	if c, err := net.DialTimeout("tcp", addr, time.Second); err == nil {
+		c.Close()
+		t.Fatal("expect listener closed")
+	}
+}
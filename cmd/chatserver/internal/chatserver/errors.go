@@ -0,0 +1,29 @@
+package chatserver
+
+import (
+	"fmt"
+
+	"github.com/mangohow/imchat/pkg/consts"
+)
+
+// Error 处理器返回的错误, 会被转换为错误帧发送给客户端
+// 处理器返回其它类型的error时, 客户端收到的是ErrInternal
+type Error struct {
+	Code    int32
+	Message string
+}
+
+func NewError(code int32, message string) *Error {
+	return &Error{Code: code, Message: message}
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("code:%d, message:%s", e.Code, e.Message)
+}
+
+var (
+	ErrBadRequest         = NewError(consts.ErrCodeBadRequest, "bad request")
+	ErrInternal           = NewError(consts.ErrCodeInternal, "internal error")
+	ErrUnknownMessage     = NewError(consts.ErrCodeUnknownMessage, "unknown message")
+	ErrUnsupportedVersion = NewError(consts.ErrCodeUnsupportedVersion, "unsupported by protocol version")
+)
@@ -35,12 +35,17 @@ func (h *ProtoHandlerGroup) Use(midFunc ...HandlerFunc) {
 }
 
 func (h *ProtoHandlerGroup) HandlerFunc(id uint32, handler HandlerFunc) {
-	h.chain = append(h.chain, handler)
-	h.addHandlers(id, h.chain)
+	h.addHandlers(id, h.handlerChain(handler))
+}
+
+// handlerChain 中间件加上处理器, 每个消息ID使用单独的切片, 不能修改h.chain
+func (h *ProtoHandlerGroup) handlerChain(handler HandlerFunc) HandlerChain {
+	return append(h.chain[:len(h.chain):len(h.chain)], handler)
 }
 
 var (
 	ctxPointerType = reflect.TypeOf(&Context{})
+	errorType      = reflect.TypeOf((*error)(nil)).Elem()
 )
 
 // HandlerAnyFunc 使用反射对参数进行绑定
@@ -77,13 +82,26 @@ func (h *ProtoHandlerGroup) HandlerAnyFunc(id uint32, handler AnyFunc) {
 
 		// 检查是否是proto.Message类型
 		value := reflect.New(in.Elem()).Interface()
-		if _, ok := value.(proto.Message); !ok {
+		m, ok := value.(proto.Message)
+		if !ok {
 			panic("must be proto.Message type")
 		}
+		RegisterMessageType(id, m)
 	}
 
-	// 检查返回值类型
-	if ft.NumOut() == 1 {
+	// 检查返回值类型, 最后一个返回值可以为error
+	errIndex := -1
+	if n := ft.NumOut(); n > 0 && ft.Out(n-1) == errorType {
+		errIndex = n - 1
+	}
+	msgIndex := -1
+	if ft.NumOut() == 2 || (ft.NumOut() == 1 && errIndex == -1) {
+		msgIndex = 0
+	}
+	if ft.NumOut() == 2 && errIndex == -1 {
+		panic("the second return value must be error")
+	}
+	if msgIndex == 0 {
 		out := ft.Out(0)
 		if out.Kind() != reflect.Pointer {
 			panic("return value must be pointer")
@@ -106,38 +124,52 @@ func (h *ProtoHandlerGroup) HandlerAnyFunc(id uint32, handler AnyFunc) {
 
 			in = in.Elem()
 			inVal := reflect.New(in)
-			// 否则，序列化为protobuf类型数据
+			// 否则，使用客户端的编解码方式解析为protobuf类型数据
 			data := ctx.Message.ProtoData
-			err := proto.Unmarshal(data, inVal.Interface().(proto.Message))
+			err := ctx.Codec().Unmarshal(data, inVal.Interface().(proto.Message))
 			if err != nil {
-				panic(err)
+				ctx.Abort()
+				_ = ctx.WriteError(ErrBadRequest.Code, ErrBadRequest.Message)
+				return
+			}
+
+			// 生成转发给其它服务器的数据, json客户端的请求使用本处理器解析出的消息重新生成
+			if ctx.Codec() != ProtoCodec {
+				ctx.Message.RawData, err = MarshalProtoMessage(ctx.Message.MsgId, inVal.Interface().(proto.Message))
+				if err != nil {
+					ctx.Abort()
+					ctx.writeHandlerError(err)
+					return
+				}
 			}
 
 			inValues = append(inValues, inVal)
 		}
 
 		outValues := fv.Call(inValues)
-		if len(outValues) == 0 {
+		// 处理器返回了错误, 发送错误帧给客户端
+		if errIndex != -1 && !outValues[errIndex].IsNil() {
+			ctx.writeHandlerError(outValues[errIndex].Interface().(error))
 			return
 		}
-		result := outValues[0].Interface()
-		if result == nil {
+		if msgIndex == -1 || outValues[msgIndex].IsNil() {
 			return
 		}
+		result := outValues[msgIndex].Interface()
 
 		if ctx.GetRespId() == 0 {
-			panic("not set resp id")
+			ctx.writeHandlerError(fmt.Errorf("not set resp id for %d", ctx.Message.MsgId))
+			return
 		}
 
-		err := ctx.WriteProtoMessage( ctx.GetRespId(), result.(proto.Message))
+		err := ctx.WriteProtoMessage(ctx.GetRespId(), result.(proto.Message))
 		if err != nil {
-			panic(err)
+			ctx.writeHandlerError(err)
 		}
 	}
 
 
-	h.chain = append(h.chain, fn)
-	h.addHandlers(id, h.chain)
+	h.addHandlers(id, h.handlerChain(fn))
 }
 
 func (h *ProtoHandlerGroup) combineRootGroup(handlers HandlerChain) {
@@ -0,0 +1,222 @@
+package chatserver
+
+import (
+	"encoding/binary"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/mangohow/imchat/cmd/chatserver/internal/conf"
+	"github.com/mangohow/imchat/cmd/chatserver/internal/log"
+	"github.com/mangohow/imchat/pkg/common/xconfig"
+	"github.com/mangohow/imchat/pkg/common/xframe"
+	"github.com/mangohow/imchat/pkg/consts"
+	"github.com/mangohow/imchat/proto/pb"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestMain(m *testing.M) {
+	conf.LoggerConf = &xconfig.LogConfig{Level: "fatal"}
+	if err := log.InitLogger(); err != nil {
+		panic(err)
+	}
+	os.Exit(m.Run())
+}
+
+func newTestMessage(t *testing.T, id uint32, m proto.Message) *Message {
+	data, err := MarshalProtoMessage(id, m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &Message{MsgId: id, RawData: data, ProtoData: data[MessageTypeLen:]}
+}
+
+// 读取写队列中的数据, 返回消息ID和protobuf数据
+func readTestFrame(t *testing.T, c *Client) (uint32, []byte) {
+	select {
+	case res := <-c.ch:
+		return binary.LittleEndian.Uint32(res.data[:MessageTypeLen]), res.data[MessageTypeLen:]
+	default:
+		t.Fatal("no data written")
+	}
+	return 0, nil
+}
+
+func readTestError(t *testing.T, c *Client) *pb.Error {
+	id, data := readTestFrame(t, c)
+	if id != consts.ErrorMessage {
+		t.Fatalf("expect error frame, got %d", id)
+	}
+	e := new(pb.Error)
+	if err := proto.Unmarshal(data, e); err != nil {
+		t.Fatal(err)
+	}
+	return e
+}
+
+func TestHandlerAnyFuncErrors(t *testing.T) {
+	h := NewMessageHandler()
+	h.Use(Recovery())
+	h.HandlerAnyFunc(consts.HelloRequest, func(ctx *Context, hello *pb.Hello) (*pb.Hello, error) {
+		switch hello.Message {
+		case "error":
+			return nil, NewError(consts.ErrCodeInvalidParam, "invalid")
+		case "internal":
+			return nil, errors.New("db error")
+		case "no resp id":
+			return &pb.Hello{}, nil
+		case "panic":
+			panic("handler panic")
+		}
+		ctx.SetRespId(consts.HelloReply)
+		return &pb.Hello{Message: "hello"}, nil
+	})
+
+	c := NewClient(nil, nil)
+	handle := func(message string) {
+		if err := h.Handle(c, newTestMessage(t, consts.HelloRequest, &pb.Hello{Message: message})); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	handle("hello")
+	if id, _ := readTestFrame(t, c); id != consts.HelloReply {
+		t.Fatalf("expect hello reply, got %d", id)
+	}
+
+	handle("error")
+	if e := readTestError(t, c); e.Code != consts.ErrCodeInvalidParam || e.MsgId != consts.HelloRequest {
+		t.Fatalf("unexpected error frame: %v", e)
+	}
+
+	for _, message := range []string{"internal", "no resp id", "panic"} {
+		handle(message)
+		if e := readTestError(t, c); e.Code != consts.ErrCodeInternal {
+			t.Fatalf("%s: unexpected error frame: %v", message, e)
+		}
+	}
+
+	// 错误的protobuf数据
+	bad := &Message{MsgId: consts.HelloRequest, ProtoData: []byte{0xff, 0xff}}
+	if err := h.Handle(c, bad); err != nil {
+		t.Fatal(err)
+	}
+	if e := readTestError(t, c); e.Code != consts.ErrCodeBadRequest {
+		t.Fatalf("unexpected error frame: %v", e)
+	}
+}
+
+func TestResponseEchoRequestId(t *testing.T) {
+	h := NewMessageHandler()
+	h.HandlerAnyFunc(consts.HelloRequest, func(ctx *Context, hello *pb.Hello) (*pb.Hello, error) {
+		if hello.Message == "error" {
+			return nil, NewError(consts.ErrCodeInvalidParam, "invalid")
+		}
+		ctx.SetRespId(consts.HelloReply)
+		return &pb.Hello{Message: "hello"}, nil
+	})
+
+	c := NewClient(nil, nil)
+	handle := func(version uint8, requestId uint32, message string) xframe.Header {
+		body, _ := proto.Marshal(&pb.Hello{Message: message})
+		data := xframe.Encode(xframe.Header{Version: version, MsgId: consts.HelloRequest, RequestId: requestId}, body)
+		header, protoData, err := xframe.Decode(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		msg := &Message{
+			MsgId:     header.MsgId,
+			Version:   header.Version,
+			Flags:     header.Flags,
+			RequestId: header.RequestId,
+			RawData:   data[header.Len()-MessageTypeLen:],
+			ProtoData: protoData,
+		}
+		if id := binary.LittleEndian.Uint32(msg.RawData); id != consts.HelloRequest {
+			t.Fatalf("raw data should start with message id, got %d", id)
+		}
+		if err := h.Handle(c, msg); err != nil {
+			t.Fatal(err)
+		}
+
+		select {
+		case res := <-c.ch:
+			resp, _, err := xframe.Decode(res.data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return resp
+		default:
+			t.Fatal("no data written")
+		}
+		return xframe.Header{}
+	}
+
+	// V1格式的请求, 响应带上请求ID
+	resp := handle(xframe.Version1, 42, "hello")
+	if resp.Version != xframe.Version1 || resp.MsgId != consts.HelloReply || resp.RequestId != 42 || !resp.HasFlag(xframe.FlagResponse) {
+		t.Fatalf("unexpected response header: %+v", resp)
+	}
+
+	// 错误帧也要带上请求ID
+	resp = handle(xframe.Version1, 43, "error")
+	if resp.MsgId != consts.ErrorMessage || resp.RequestId != 43 {
+		t.Fatalf("unexpected error header: %+v", resp)
+	}
+
+	// 旧格式的请求, 响应也使用旧格式
+	resp = handle(xframe.Version0, 0, "hello")
+	if resp.Version != xframe.Version0 || resp.MsgId != consts.HelloReply {
+		t.Fatalf("unexpected response header: %+v", resp)
+	}
+}
+
+// 每个消息ID只执行自己的处理器, 不会执行之前注册的处理器
+func TestHandlerChainPerId(t *testing.T) {
+	h := NewMessageHandler()
+	var calls []string
+	h.Use(func(ctx *Context) {
+		calls = append(calls, "middleware")
+	})
+	h.HandlerAnyFunc(consts.HelloRequest, func(ctx *Context, hello *pb.Hello) *pb.Hello {
+		calls = append(calls, "hello")
+		ctx.SetRespId(consts.HelloReply)
+		return &pb.Hello{Message: "hello"}
+	})
+	h.HandlerAnyFunc(consts.SingleChatMessage, func(ctx *Context, chat *pb.SingleChat) {
+		calls = append(calls, "chat")
+	})
+	h.HandlerFunc(consts.SingleChatAck, func(ctx *Context) {
+		calls = append(calls, "ack")
+	})
+
+	c := NewClient(nil, nil)
+	cases := []struct {
+		msg    *Message
+		expect string
+	}{
+		{newTestMessage(t, consts.SingleChatMessage, &pb.SingleChat{Sender: 1, Receiver: 2}), "middleware,chat"},
+		{newTestMessage(t, consts.SingleChatAck, &pb.SingleChat{}), "middleware,ack"},
+		{newTestMessage(t, consts.HelloRequest, &pb.Hello{}), "middleware,hello"},
+	}
+	for _, cs := range cases {
+		calls = calls[:0]
+		if err := h.Handle(c, cs.msg); err != nil {
+			t.Fatal(err)
+		}
+		if got := strings.Join(calls, ","); got != cs.expect {
+			t.Fatalf("msg %d: expect %s, got %s", cs.msg.MsgId, cs.expect, got)
+		}
+	}
+
+	// 只有hello请求有响应
+	if id, _ := readTestFrame(t, c); id != consts.HelloReply {
+		t.Fatalf("expect hello reply, got %d", id)
+	}
+	select {
+	case res := <-c.ch:
+		t.Fatalf("unexpected frame: %v", res.data)
+	default:
+	}
+}
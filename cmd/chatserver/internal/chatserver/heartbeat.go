@@ -0,0 +1,118 @@
+package chatserver
+
+import (
+	"context"
+	"encoding/binary"
+	"time"
+
+	"github.com/mangohow/imchat/pkg/consts"
+)
+
+/*
+	心跳和空闲连接
+	1. 读超时(HeartBeat): 在该时间内没有收到任何帧(包括ping/pong)的连接被认为已经断开, 为0时不设置读超时
+	2. 服务器每隔PingInterval发送一次ping, 数据为8字节大端的发送时间(纳秒), 客户端需要在pong中原样带回,
+	   用于计算往返时间(RTT); 浏览器会自动回复pong, tcp客户端需要自己回复
+	3. 认证过的连接在IdleTimeout内没有发送任何请求(ping/pong不算)时, 使用CloseIdleTimeout关闭
+
+	连接被回收时立即调用AfterClientCloseHandler清理redis中的路由, 不用等待读goroutine退出
+*/
+
+const (
+	// ControlTimeout 发送控制帧的超时时间
+	ControlTimeout = time.Second * 5
+	// IdleReason 空闲连接被关闭的原因
+	IdleReason = "idle timeout"
+
+	pingPayloadLen = 8
+)
+
+// ControlDeadline 发送控制帧的截止时间
+func ControlDeadline() time.Time {
+	return time.Now().Add(ControlTimeout)
+}
+
+// 读超时的截止时间, 没有配置心跳时不设置超时
+func (s *ChatServer) readDeadline() time.Time {
+	if s.config.HeartBeat <= 0 {
+		return time.Time{}
+	}
+	return time.Now().Add(s.config.HeartBeat)
+}
+
+func pingPayload(now time.Time) []byte {
+	buf := make([]byte, pingPayloadLen)
+	binary.BigEndian.PutUint64(buf, uint64(now.UnixNano()))
+	return buf
+}
+
+// 收到pong后计算往返时间, 不是服务器发送的ping的回复时忽略
+func (c *Client) pong(appData string, now time.Time) {
+	if len(appData) != pingPayloadLen {
+		return
+	}
+	sent := time.Unix(0, int64(binary.BigEndian.Uint64([]byte(appData))))
+	rtt := now.Sub(sent)
+	if rtt < 0 {
+		return
+	}
+	c.rtt.Store(int64(rtt))
+}
+
+// RTT 最近一次ping的往返时间, 还没有收到pong时为0
+func (c *Client) RTT() time.Duration {
+	return time.Duration(c.rtt.Load())
+}
+
+// LastActive 最后一次发送请求的时间
+func (c *Client) LastActive() time.Time {
+	return time.Unix(0, c.lastActive.Load())
+}
+
+func (c *Client) touch(now time.Time) {
+	c.lastActive.Store(now.UnixNano())
+}
+
+// 定时检查认证过的连接, 关闭空闲的连接
+func (s *ChatServer) reapIdle(ctx context.Context) {
+	interval := s.config.IdleTimeout / 4
+	if interval < time.Second {
+		interval = time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			var idle []*Client
+			s.clientManager.Range(func(id int64, c *Client) bool {
+				if now.Sub(c.LastActive()) >= s.config.IdleTimeout {
+					idle = append(idle, c)
+				}
+				return true
+			})
+			for _, c := range idle {
+				s.logger.Debugf("reap idle connection, uid:%d, addr:%s", c.GetUid(), c.RemoteAddr())
+				s.reap(c, consts.CloseIdleTimeout, IdleReason)
+			}
+		}
+	}
+}
+
+// 回收连接, 先清理路由, 然后关闭连接
+func (s *ChatServer) reap(c *Client, code int, reason string) {
+	s.clientClosed(c)
+	go c.Kick(code, reason)
+}
+
+// 连接关闭后调用AfterClientCloseHandler, 只会调用一次
+func (s *ChatServer) clientClosed(c *Client) {
+	if s.afterClientCloseHandler == nil {
+		return
+	}
+	c.closeOnce.Do(func() {
+		s.afterClientCloseHandler(c)
+	})
+}
@@ -0,0 +1,96 @@
+package chatserver
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/mangohow/imchat/pkg/consts"
+	"github.com/mangohow/imchat/proto/pb"
+)
+
+func TestServerPing(t *testing.T) {
+	_, addr := newTestTCPServer(t, func(c *Config) {
+		c.PingInterval = time.Millisecond * 20
+	})
+	conn := dialTestTCP(t, addr, &pb.Login{Token: "token", Device: "200"})
+	if header := readTestTCPFrame(t, conn, new(pb.LoginReply)); header.MsgId != consts.LoginReply {
+		t.Fatalf("expect login reply, got %d", header.MsgId)
+	}
+
+	// 读取时自动回复pong
+	go func() {
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	deadline := time.Now().Add(time.Second * 5)
+	for {
+		clients := ClientManagerInstance.Get(200)
+		if len(clients) == 1 && clients[0].RTT() > 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("rtt not measured")
+		}
+		time.Sleep(time.Millisecond * 10)
+	}
+}
+
+func TestReapIdle(t *testing.T) {
+	s, addr := newTestTCPServer(t, func(c *Config) {
+		c.PingInterval = time.Millisecond * 20
+		c.IdleTimeout = time.Millisecond * 200
+	})
+	closed := make(chan *Client, 1)
+	s.SetClientCloseHandler(func(conn *Client) {
+		if conn.Authed() {
+			ClientManagerInstance.Remove(conn.GetUid(), conn)
+			closed <- conn
+		}
+	})
+	go s.reapIdle(s.ctx)
+
+	conn := dialTestTCP(t, addr, &pb.Login{Token: "token", Device: "300"})
+	if header := readTestTCPFrame(t, conn, new(pb.LoginReply)); header.MsgId != consts.LoginReply {
+		t.Fatalf("expect login reply, got %d", header.MsgId)
+	}
+
+	// 回复pong不算活跃, 仍然会被回收
+	_, _, err := conn.ReadMessage()
+	if !websocket.IsCloseError(err, consts.CloseIdleTimeout) {
+		t.Fatalf("expect idle timeout close, got %v", err)
+	}
+
+	select {
+	case c := <-closed:
+		if c.GetUid() != 300 {
+			t.Fatalf("unexpected client closed: %d", c.GetUid())
+		}
+	case <-time.After(time.Second):
+		t.Fatal("close handler not called")
+	}
+	if len(ClientManagerInstance.Get(300)) != 0 {
+		t.Fatal("idle client not removed")
+	}
+	// 读goroutine退出时不会再次调用
+	select {
+	case <-closed:
+		t.Fatal("close handler called twice")
+	case <-time.After(time.Millisecond * 100):
+	}
+}
+
+func TestReadDeadlineWithoutHeartBeat(t *testing.T) {
+	s := &ChatServer{config: &Config{}}
+	if !s.readDeadline().IsZero() {
+		t.Fatal("expect no read deadline when heartbeat is 0")
+	}
+	s.config.HeartBeat = time.Second
+	if d := time.Until(s.readDeadline()); d <= 0 || d > time.Second {
+		t.Fatalf("unexpected read deadline: %v", d)
+	}
+}
@@ -0,0 +1,45 @@
+package chatserver
+
+import (
+	"github.com/mangohow/imchat/cmd/chatserver/internal/metrics"
+)
+
+// 连接数和写队列的指标在采集时计算, /metrics在单独的端口上暴露, 参考route.NewMetricsServer
+func (s *ChatServer) registerMetrics() {
+	metrics.GaugeFunc("connections", "Open client connections, including unauthenticated ones.", func() float64 {
+		return float64(s.Connections())
+	})
+	metrics.GaugeFunc("clients", "Authenticated clients in the client manager.", func() float64 {
+		return float64(s.queueStats().clients)
+	})
+	metrics.GaugeFunc("write_queue_messages", "Messages waiting in all client write queues.", func() float64 {
+		return float64(s.queueStats().total)
+	})
+	metrics.GaugeFunc("write_queue_max_messages", "Longest client write queue.", func() float64 {
+		return float64(s.queueStats().max)
+	})
+	metrics.CounterFunc("slow_consumer_disconnects_total", "Clients disconnected because they read too slowly.", func() float64 {
+		return float64(SlowConsumerDisconnects())
+	})
+}
+
+type queueStats struct {
+	clients int
+	total   int
+	max     int
+}
+
+func (s *ChatServer) queueStats() queueStats {
+	var stats queueStats
+	s.clientManager.Range(func(id int64, c *Client) bool {
+		n := c.QueueLen()
+		stats.clients++
+		stats.total += n
+		if n > stats.max {
+			stats.max = n
+		}
+		return true
+	})
+
+	return stats
+}
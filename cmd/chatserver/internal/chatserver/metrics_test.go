@@ -0,0 +1,55 @@
+package chatserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mangohow/imchat/cmd/chatserver/internal/metrics"
+	"github.com/mangohow/imchat/pkg/common/xframe"
+	"github.com/mangohow/imchat/pkg/common/xmetrics"
+	"github.com/mangohow/imchat/pkg/consts"
+	"github.com/mangohow/imchat/proto/pb"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestFrameMetrics(t *testing.T) {
+	s, addr := newTestTCPServer(t)
+	s.registerMetrics()
+	in := metrics.FramesIn.WithLabelValues(metrics.MsgId(consts.HelloRequest))
+	out := metrics.FramesOut.WithLabelValues(metrics.MsgId(consts.HelloReply))
+	inBefore, outBefore := testutil.ToFloat64(in), testutil.ToFloat64(out)
+
+	conn := dialTestTCP(t, addr, &pb.Login{Token: "token", Device: "300"})
+	readTestTCPFrame(t, conn, new(pb.LoginReply))
+	writeTestTCPFrame(t, conn, xframe.Header{Version: xframe.Version1, MsgId: consts.HelloRequest, RequestId: 1}, &pb.Hello{Message: "hello"})
+	readTestTCPFrame(t, conn, new(pb.Hello))
+
+	// 写goroutine在发送成功后才计数
+	deadline := time.Now().Add(time.Second)
+	for testutil.ToFloat64(out) == outBefore && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond * 10)
+	}
+	if n := testutil.ToFloat64(in) - inBefore; n != 1 {
+		t.Fatalf("expect 1 hello request, got %v", n)
+	}
+	if n := testutil.ToFloat64(out) - outBefore; n != 1 {
+		t.Fatalf("expect 1 hello reply, got %v", n)
+	}
+
+	w := httptest.NewRecorder()
+	xmetrics.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, xmetrics.Path, nil))
+	if !strings.Contains(w.Body.String(), "imchat_chatserver_clients ") {
+		t.Fatalf("clients gauge not exported:\n%s", w.Body.String())
+	}
+
+	// 客户端连接的端口上不暴露/metrics
+	s.ws.HandleWebSocket(s.websocketHandler)
+	w = httptest.NewRecorder()
+	s.ws.Server.Handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, xmetrics.Path, nil))
+	if w.Code == http.StatusOK {
+		t.Fatalf("metrics should not be served on the client port")
+	}
+}
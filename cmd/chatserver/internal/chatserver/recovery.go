@@ -0,0 +1,24 @@
+package chatserver
+
+import (
+	"runtime/debug"
+
+	"github.com/mangohow/imchat/cmd/chatserver/internal/log"
+)
+
+// Recovery 捕获处理器中的panic, 返回错误帧给客户端, 防止整个服务崩溃
+// 需要作为第一个中间件使用
+func Recovery() HandlerFunc {
+	return func(ctx *Context) {
+		defer func() {
+			if r := recover(); r != nil {
+				log.Logger().Errorf("handler panic, msgId:%d, uid:%d, err:%v\n%s",
+					ctx.Message.MsgId, ctx.GetUid(), r, debug.Stack())
+				ctx.Abort()
+				_ = ctx.WriteError(ErrInternal.Code, ErrInternal.Message)
+			}
+		}()
+
+		ctx.Next()
+	}
+}
@@ -2,19 +2,23 @@ package chatserver
 
 import (
 	"context"
-	"encoding/binary"
+	"crypto/tls"
 	"fmt"
 	"io"
 	"net"
 	"net/http"
 	"os"
+	"sync/atomic"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/gorilla/websocket"
 	"github.com/mangohow/imchat/cmd/chatserver/internal/conf"
 	"github.com/mangohow/imchat/cmd/chatserver/internal/log"
+	"github.com/mangohow/imchat/cmd/chatserver/internal/metrics"
+	"github.com/mangohow/imchat/pkg/common/xframe"
 	"github.com/mangohow/imchat/pkg/common/xwaitgroup"
+	"github.com/mangohow/imchat/pkg/consts"
 	ws "github.com/mangohow/imchat/pkg/common/xwebsocket"
 	"github.com/sirupsen/logrus"
 )
@@ -22,8 +26,24 @@ import (
 type Config struct {
 	// 服务端监听的端口
 	Addr string
-	// 心跳时间
+	// 心跳时间, 在该时间内没有收到任何数据时断开连接, 为0时不检查, 参考heartbeat.go
 	HeartBeat time.Duration
+	// 服务器发送ping的间隔, 为0时不发送
+	PingInterval time.Duration
+	// 认证过的连接在该时间内没有发送请求时断开, 为0时不检查
+	IdleTimeout time.Duration
+	// 客户端写队列的配置
+	WriteOptions *WriteOptions
+	// 压缩配置, 为nil时不压缩
+	Compression *CompressOptions
+	// 允许连接的浏览器Origin, 为空时只允许同源
+	AllowedOrigins []string
+	// 不为nil时使用wss, 参考xtls, tcp连接也会使用TLS
+	TLSConfig *tls.Config
+	// tcp传输层监听的地址, 为空时不监听, 参考tcp.go
+	TCPAddr string
+	// 关闭时排空连接的超时时间, 参考drain.go
+	DrainTimeout time.Duration
 }
 
 /*
@@ -40,6 +60,7 @@ type ChatServer struct {
 	messageHandler IMessageHandler
 
 	ws            *ws.WebSocket
+	tcpListener   net.Listener
 	// 客户端管理器
 	clientManager IClientManager
 
@@ -56,6 +77,13 @@ type ChatServer struct {
 	cancel context.CancelFunc
 
 	waitgroup xwaitgroup.WaitGroupWrapper
+
+	// 排空连接相关, 参考drain.go
+	draining    atomic.Bool
+	activeConns atomic.Int64
+	suggestNode SuggestNodeFunc
+	onDrain     []func()
+	onShutdown  []func()
 }
 
 type AfterHandshakeHandler func(r *http.Request, conn *Client) bool
@@ -75,22 +103,44 @@ func NewServer(conf *Config) *ChatServer {
 		conf.Addr = DefaultListenAddr
 	}
 
+	if conf.DrainTimeout <= 0 {
+		conf.DrainTimeout = DefaultDrainTimeout
+	}
+
+	if conf.WriteOptions == nil {
+		opts := *DefaultWriteOptions
+		conf.WriteOptions = &opts
+	}
+	conf.WriteOptions.Compress = conf.Compression
+
+	wsServer := ws.New("/ws/chat")
+	wsServer.Subprotocols = subprotocols()
+	wsServer.AllowedOrigins = conf.AllowedOrigins
+	wsServer.Server.TLSConfig = conf.TLSConfig
+	if conf.Compression != nil && conf.Compression.Deflate {
+		wsServer.EnableCompression = true
+		wsServer.CompressionLevel = conf.Compression.Level
+	}
+
 	// 生成serverID
 	id := generateServerId()
 
 	log.Logger().Debug("node id:", id)
 
 	ctx, cancelFunc := context.WithCancel(context.Background())
-	return &ChatServer{
+	s := &ChatServer{
 		clientManager:  ClientManagerInstance,
 		messageHandler: NewMessageHandler(),
-		ws:             ws.New("/ws/chat"),
+		ws:             wsServer,
 		logger:         log.Logger(),
 		config:         conf,
 		nodeId:         id,
 		ctx:            ctx,
 		cancel:         cancelFunc,
 	}
+	s.registerMetrics()
+
+	return s
 }
 
 // 生成serverID，并将ID保存到文件中，服务重启时使用原有的
@@ -132,28 +182,96 @@ func (s *ChatServer) SetAfterHandshakeHandler(handler AfterHandshakeHandler) {
 	s.afterHandshakeHandler = handler
 }
 
+// SetSpillFunc 设置spill策略下处理被丢弃数据的函数
+func (s *ChatServer) SetSpillFunc(fn SpillFunc) {
+	s.config.WriteOptions.Spill = fn
+}
+
 // Serve 服务启动时需要注册到消息队列
 func (s *ChatServer) Serve() error {
+	if s.config.TCPAddr != "" {
+		ln, err := net.Listen("tcp", s.config.TCPAddr)
+		if err != nil {
+			return err
+		}
+		if s.config.TLSConfig != nil {
+			ln = tls.NewListener(ln, s.config.TLSConfig)
+		}
+		s.tcpListener = ln
+		s.logger.Info("tcp listen at: ", s.config.TCPAddr)
+		go s.serveTCP(ln)
+	}
+
+	if s.config.IdleTimeout > 0 {
+		s.waitgroup.Go(func() {
+			s.reapIdle(s.ctx)
+		})
+	}
+
 	s.ws.HandleWebSocket(s.websocketHandler)
-	s.logger.Info("server listen at: ", s.config.Addr)
+	if s.config.TLSConfig != nil {
+		s.logger.Info("server listen with tls at: ", s.config.Addr)
+	} else {
+		s.logger.Info("server listen at: ", s.config.Addr)
+	}
 	return s.ws.ListenAndServe(s.config.Addr)
 }
 
-const MessageTypeLen = 4
+// MessageTypeLen 服务器之间转发的数据的头部长度, 参考xframe
+const MessageTypeLen = xframe.MessageIdLen
 
 // 采用读写分离的方式
 func (s *ChatServer) startClientWriter(ctx context.Context, conn *Client) {
+	var pingC <-chan time.Time
+	if s.config.PingInterval > 0 {
+		ticker := time.NewTicker(s.config.PingInterval)
+		defer ticker.Stop()
+		pingC = ticker.C
+	}
+
 	for {
 		select {
 		case <-ctx.Done():
 			return
+		case now := <-pingC:
+			if err := conn.conn.WriteControl(websocket.PingMessage, pingPayload(now), ControlDeadline()); err != nil {
+				s.logger.Debugf("write ping error:%v, addr:%s", err, conn.RemoteAddr())
+			}
 		case res := <- conn.ch:
+			conn.dequeued(res)
+			// 客户端的协议版本不支持的推送直接丢弃
+			if !conn.supportsFrame(res) {
+				continue
+			}
 			if isControl(res.wsMsgType) {
-				conn.wsc.WriteControl(res.wsMsgType, res.data, time.Now().Add(s.config.HeartBeat))
-			} else {
-				conn.wsc.WriteMessage(res.wsMsgType, res.data)
+				conn.conn.WriteControl(res.wsMsgType, res.data, ControlDeadline())
+				continue
 			}
 
+			// 设置写超时, 防止客户端接收太慢时一直阻塞
+			if timeout := conn.opts.WriteTimeout; timeout > 0 {
+				_ = conn.conn.SetWriteDeadline(time.Now().Add(timeout))
+			}
+			msgType, data, err := conn.encodeFrame(res)
+			if err != nil {
+				s.logger.Errorf("encode frame error:%v", err)
+				continue
+			}
+
+			err = conn.conn.WriteMessage(msgType, data)
+			if err == nil {
+				metrics.FramesOut.WithLabelValues(metrics.MsgId(res.msgId)).Inc()
+				continue
+			}
+
+			if neterr, ok := err.(net.Error); ok && neterr.Timeout() {
+				s.logger.Errorf("write timeout, slow consumer, ip:%s", conn.RemoteAddr())
+				conn.DisconnectSlowConsumer()
+			} else {
+				s.logger.Errorf("write message error:%v", err)
+				_ = conn.Close()
+			}
+			return
 		}
 
 	}
@@ -162,7 +280,39 @@ func (s *ChatServer) startClientWriter(ctx context.Context, conn *Client) {
 // websocketHandler 用户认证成功后, 需要添加到redis中
 func (s *ChatServer) websocketHandler(conn *websocket.Conn, r *http.Request) {
 	defer conn.Close()
-	cli := NewClient(conn)
+	cli := NewClient(conn, s.config.WriteOptions)
+	cli.deflate = s.ws.CompressionNegotiated(r)
+
+	s.serveClient(cli, r, conn.Subprotocol(), nil)
+}
+
+// serveClient websocket和tcp连接共用的处理流程: 协商、认证, 然后循环读取请求
+// r为握手请求, tcp连接由登录帧转换而来; onAuthed在认证通过后、开始读取请求前调用
+func (s *ChatServer) serveClient(cli *Client, r *http.Request, subprotocol string, onAuthed func()) {
+	conn := cli.conn
+
+	s.activeConns.Add(1)
+	defer s.activeConns.Add(-1)
+
+	// 正在排空, 不再接收新连接
+	if s.Draining() {
+		_ = cli.Kick(websocket.CloseServiceRestart, DrainReason)
+		return
+	}
+
+	// 选择编解码方式
+	if cli.codec = CodecFromRequest(r); cli.codec == nil {
+		_ = cli.Kick(websocket.CloseUnsupportedData, "unsupported codec")
+		return
+	}
+
+	// 协商协议版本
+	version, err := negotiateVersion(r, subprotocol)
+	if err != nil {
+		_ = cli.Kick(consts.CloseUnsupportedVersion, err.Error())
+		return
+	}
+	cli.protocolVersion = version
 	// 调用握手后的处理方法
 	if s.afterHandshakeHandler != nil {
 		if !s.afterHandshakeHandler(r, cli) {
@@ -171,18 +321,22 @@ func (s *ChatServer) websocketHandler(conn *websocket.Conn, r *http.Request) {
 	}
 
 	// 调用客户端被关闭后的handler
-	if s.afterClientCloseHandler != nil {
-		defer s.afterClientCloseHandler(cli)
-	}
+	defer s.clientClosed(cli)
 
-	// 设置心跳
-	if s.config.HeartBeat > 0 {
-		conn.SetPingHandler(func(_ string) error {
-			conn.WriteControl(websocket.PongMessage, nil, time.Unix(0, 0))
-			return conn.SetReadDeadline(time.Now().Add(s.config.HeartBeat))
-		})
+	if onAuthed != nil {
+		onAuthed()
 	}
 
+	// 设置心跳, 收到ping或pong时延长读超时
+	conn.SetPingHandler(func(appData string) error {
+		_ = conn.WriteControl(websocket.PongMessage, []byte(appData), ControlDeadline())
+		return conn.SetReadDeadline(s.readDeadline())
+	})
+	conn.SetPongHandler(func(appData string) error {
+		cli.pong(appData, time.Now())
+		return conn.SetReadDeadline(s.readDeadline())
+	})
+
 	// 启动writer
 	ctx, cancelFunc := context.WithCancel(s.ctx)
 	defer cancelFunc()
@@ -195,7 +349,7 @@ func (s *ChatServer) websocketHandler(conn *websocket.Conn, r *http.Request) {
 	s.logger.Debugf("[new connection] addr: %s, id: %d", conn.RemoteAddr(), id)
 
 	for {
-		err := conn.SetReadDeadline(time.Now().Add(s.config.HeartBeat))
+		err := conn.SetReadDeadline(s.readDeadline())
 		if err != nil {
 			s.logger.Errorf("set heartbeat error:%v", err)
 			return
@@ -222,21 +376,61 @@ func (s *ChatServer) websocketHandler(conn *websocket.Conn, r *http.Request) {
 			return
 		}
 
-		if len(data) < MessageTypeLen {
+		cli.touch(time.Now())
+
+		// 解析帧头, 同时支持旧格式和V1格式
+		header, body, err := cli.codec.Decode(data)
+		if err == xframe.ErrFrameTooShort {
 			s.logger.Errorf("data invalid")
 			return
 		}
+		if err != nil {
+			metrics.FramesIn.WithLabelValues(metrics.Unknown).Inc()
+			_ = cli.WriteError(ErrBadRequest.Code, err.Error(), header.MsgId)
+			continue
+		}
 
-		// 获取messageType
-		msgType := binary.LittleEndian.Uint32(data[:MessageTypeLen])
+		cli.setFrameVersion(header.Version)
 
 		msg := &Message{
-			MsgId:     msgType,
-			RawData:   data,
-			ProtoData: data[MessageTypeLen:],
+			MsgId:     header.MsgId,
+			Version:   header.Version,
+			Flags:     header.Flags,
+			RequestId: header.RequestId,
+			ProtoData: body,
+		}
+		// 生成转发给其它服务器的数据
+		// V1帧去掉消息ID前面的部分即可, 压缩过的数据需要使用解压后的数据重新生成
+		// json数据在HandlerAnyFunc解析消息体之后生成
+		if cli.codec == ProtoCodec {
+			if header.HasFlag(xframe.FlagCompressed) {
+				msg.RawData = xframe.Encode(xframe.Header{MsgId: header.MsgId}, body)
+			} else {
+				msg.RawData = data[header.Len()-MessageTypeLen:]
+			}
 		}
 
+		// 客户端的协议版本不支持该消息
+		if !cli.Supports(msg.MsgId) {
+			metrics.FramesIn.WithLabelValues(metrics.MsgId(msg.MsgId)).Inc()
+			ctx := newContext(cli, msg)
+			_ = ctx.WriteError(ErrUnsupportedVersion.Code, ErrUnsupportedVersion.Message)
+			freeContext(ctx)
+			continue
+		}
+
+		start := time.Now()
 		err = s.handleRequest(cli, msg)
+		if err == NoSuchHandlersError {
+			metrics.FramesIn.WithLabelValues(metrics.Unknown).Inc()
+			ctx := newContext(cli, msg)
+			_ = ctx.WriteError(ErrUnknownMessage.Code, ErrUnknownMessage.Message)
+			freeContext(ctx)
+			continue
+		}
+		msgId := metrics.MsgId(msg.MsgId)
+		metrics.FramesIn.WithLabelValues(msgId).Inc()
+		metrics.HandlerDuration.WithLabelValues(msgId).Observe(time.Since(start).Seconds())
 		if err != nil {
 			s.logger.Errorf("handle request error:%v", err)
 			return
@@ -272,6 +466,7 @@ func (s *ChatServer) HandlerFunc(id uint32, handler HandlerFunc) {
 // HandlerAnyFunc 传入的函数必须遵循下面规则：
 // 一个入参：func(ctx *Context) proto.Message类型指针返回值 或 没有返回值
 // 两个入参: func(ctx *Context, proto.Message类型的指针) *proto.Message类型指针返回值 或没有返回值
+// 返回值的最后可以增加一个error, 不为nil时会转换为错误帧发送给客户端, 参考Error
 func (s *ChatServer) HandlerAnyFunc(id uint32, handler AnyFunc) {
 	s.messageHandler.HandlerAnyFunc(id, handler)
 }
@@ -284,19 +479,30 @@ func (s *ChatServer) GetCtx() context.Context {
 	return s.ctx
 }
 
+// Shutdown 先排空连接, 然后调用RegisterOnShutdown注册的函数, 最后停止所有的goroutine
 func (s *ChatServer) Shutdown() error {
-	s.cancel()
-	ctx, cancelFunc := context.WithTimeout(context.Background(), time.Second*30)
+	ctx, cancelFunc := context.WithTimeout(context.Background(), s.config.DrainTimeout)
 	defer cancelFunc()
-	err := s.ws.Shutdown(ctx)
+	err := s.Drain(ctx)
 
+	for _, fn := range s.onShutdown {
+		fn()
+	}
+
+	// 等待被强制关闭的连接清理路由
+	graceCtx, graceCancel := context.WithTimeout(context.Background(), closeGraceDuration)
+	defer graceCancel()
+	_ = s.waitConnections(graceCtx)
+
+	s.cancel()
 	s.waitgroup.Wait()
 
 	return err
 }
 
+// RegisterOnShutdown 注册排空连接之后调用的函数, 此时仍然没有关闭的连接需要在这里关闭
 func (s *ChatServer) RegisterOnShutdown(fn func()) {
-	s.ws.RegisterOnShutdown(fn)
+	s.onShutdown = append(s.onShutdown, fn)
 }
 
 func isControl(frameType int) bool {
@@ -0,0 +1,298 @@
+package chatserver
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/mangohow/imchat/pkg/common/xframe"
+	"github.com/mangohow/imchat/pkg/consts"
+	"github.com/mangohow/imchat/proto/pb"
+	"google.golang.org/protobuf/proto"
+)
+
+/*
+	tcp传输层, 没有websocket的分帧开销, 给移动端使用
+
+	帧格式: 4字节小端长度 + 1字节类型 + 数据, 长度包括类型
+	类型使用websocket的定义: 1文本 2二进制 8关闭 9ping 10pong
+	数据帧的内容和websocket的完全相同, 参考xframe; 关闭帧的内容为2字节大端关闭码 + 原因, 和websocket一致
+
+	连接建立后客户端需要在LoginTimeout内发送登录帧(LoginRequest + pb.Login),
+	服务器将它转换为握手请求, 和websocket连接一样经过AfterHandshakeHandler认证,
+	认证通过后回复LoginReply, 失败时发送关闭帧并关闭连接
+	服务器会定时发送ping, 客户端需要回复数据相同的pong, 参考heartbeat.go
+*/
+
+const (
+	// TCPMaxFrameSize 客户端发送的帧的最大长度
+	TCPMaxFrameSize = 4 << 20
+	// LoginTimeout 等待登录帧的时间
+	LoginTimeout = time.Second * 10
+
+	tcpHeaderLen = 5
+)
+
+var (
+	ErrFrameTooLarge = errors.New("frame too large")
+	ErrBadFrameType  = errors.New("bad frame type")
+	ErrLoginRequired = errors.New("login required")
+	errWriteTimeout  = errors.New("write timeout")
+)
+
+type tcpConn struct {
+	conn   net.Conn
+	reader *bufio.Reader
+
+	// 保护写操作, 使用chan可以在等待时超时
+	writeMux chan struct{}
+	// WriteMessage使用的写超时, WriteControl会临时修改, 读写都需要持有writeMux
+	writeDeadline time.Time
+
+	pingHandler func(appData string) error
+	pongHandler func(appData string) error
+}
+
+func newTCPConn(conn net.Conn) *tcpConn {
+	c := &tcpConn{
+		conn:     conn,
+		reader:   bufio.NewReader(conn),
+		writeMux: make(chan struct{}, 1),
+	}
+	c.pingHandler = func(appData string) error {
+		return c.WriteControl(websocket.PongMessage, []byte(appData), ControlDeadline())
+	}
+
+	return c
+}
+
+func (c *tcpConn) ReadMessage() (int, []byte, error) {
+	for {
+		messageType, data, err := c.readFrame()
+		if err != nil {
+			return 0, nil, err
+		}
+
+		switch messageType {
+		case websocket.TextMessage, websocket.BinaryMessage:
+			return messageType, data, nil
+		case websocket.PingMessage:
+			if err = c.pingHandler(string(data)); err != nil {
+				return 0, nil, err
+			}
+		case websocket.PongMessage:
+			if c.pongHandler == nil {
+				continue
+			}
+			if err = c.pongHandler(string(data)); err != nil {
+				return 0, nil, err
+			}
+		case websocket.CloseMessage:
+			closeErr := &websocket.CloseError{Code: websocket.CloseNoStatusReceived}
+			if len(data) >= 2 {
+				closeErr.Code = int(binary.BigEndian.Uint16(data))
+				closeErr.Text = string(data[2:])
+			}
+			return 0, nil, closeErr
+		default:
+			return 0, nil, ErrBadFrameType
+		}
+	}
+}
+
+func (c *tcpConn) readFrame() (int, []byte, error) {
+	var header [tcpHeaderLen]byte
+	if _, err := io.ReadFull(c.reader, header[:]); err != nil {
+		return 0, nil, err
+	}
+
+	length := binary.LittleEndian.Uint32(header[:4])
+	if length == 0 {
+		return 0, nil, ErrBadFrameType
+	}
+	if length > TCPMaxFrameSize {
+		return 0, nil, ErrFrameTooLarge
+	}
+
+	data := make([]byte, length-1)
+	if _, err := io.ReadFull(c.reader, data); err != nil {
+		return 0, nil, err
+	}
+
+	return int(header[4]), data, nil
+}
+
+func (c *tcpConn) WriteMessage(messageType int, data []byte) error {
+	c.writeMux <- struct{}{}
+	defer func() { <-c.writeMux }()
+
+	return c.writeFrame(messageType, data)
+}
+
+func (c *tcpConn) WriteControl(messageType int, data []byte, deadline time.Time) error {
+	var timer <-chan time.Time
+	if !deadline.IsZero() {
+		d := time.Until(deadline)
+		if d < 0 {
+			return errWriteTimeout
+		}
+		t := time.NewTimer(d)
+		defer t.Stop()
+		timer = t.C
+	}
+
+	select {
+	case c.writeMux <- struct{}{}:
+	case <-timer:
+		return errWriteTimeout
+	}
+	defer func() { <-c.writeMux }()
+
+	_ = c.conn.SetWriteDeadline(deadline)
+	err := c.writeFrame(messageType, data)
+	_ = c.conn.SetWriteDeadline(c.writeDeadline)
+
+	return err
+}
+
+func (c *tcpConn) writeFrame(messageType int, data []byte) error {
+	buf := make([]byte, tcpHeaderLen, tcpHeaderLen+len(data))
+	binary.LittleEndian.PutUint32(buf, uint32(len(data)+1))
+	buf[4] = byte(messageType)
+	_, err := c.conn.Write(append(buf, data...))
+
+	return err
+}
+
+func (c *tcpConn) SetReadDeadline(t time.Time) error {
+	return c.conn.SetReadDeadline(t)
+}
+
+// SetWriteDeadline 和WriteControl一样需要持有writeMux, WriteControl可能在其它goroutine中读取writeDeadline
+func (c *tcpConn) SetWriteDeadline(t time.Time) error {
+	c.writeMux <- struct{}{}
+	defer func() { <-c.writeMux }()
+
+	c.writeDeadline = t
+	return c.conn.SetWriteDeadline(t)
+}
+
+func (c *tcpConn) SetPingHandler(h func(appData string) error) {
+	if h == nil {
+		return
+	}
+	c.pingHandler = h
+}
+
+func (c *tcpConn) SetPongHandler(h func(appData string) error) {
+	c.pongHandler = h
+}
+
+func (c *tcpConn) Close() error {
+	return c.conn.Close()
+}
+
+func (c *tcpConn) RemoteAddr() net.Addr {
+	return c.conn.RemoteAddr()
+}
+
+// 读取登录帧, 转换为握手请求, 之后的认证、协商过程和websocket相同
+func readLogin(conn Transport, remoteAddr string) (*http.Request, error) {
+	messageType, data, err := conn.ReadMessage()
+	if err != nil {
+		return nil, err
+	}
+	if messageType != websocket.BinaryMessage {
+		return nil, ErrLoginRequired
+	}
+
+	header, body, err := xframe.Decode(data)
+	if err != nil {
+		return nil, err
+	}
+	if header.MsgId != consts.LoginRequest {
+		return nil, ErrLoginRequired
+	}
+
+	login := new(pb.Login)
+	if err = proto.Unmarshal(body, login); err != nil {
+		return nil, err
+	}
+
+	return loginRequest(login, remoteAddr), nil
+}
+
+func loginRequest(login *pb.Login, remoteAddr string) *http.Request {
+	r := &http.Request{
+		Method:     http.MethodGet,
+		URL:        &url.URL{},
+		Header:     make(http.Header),
+		RemoteAddr: remoteAddr,
+	}
+
+	set := func(key, val string) {
+		if val != "" {
+			r.Header.Set(key, val)
+		}
+	}
+	set("authorization", login.Token)
+	set("platform", login.Platform)
+	set("device", login.Device)
+	set(CodecParam, login.Codec)
+	if login.ProtocolVersion != 0 {
+		set(consts.ProtocolVersionHeader, strconv.Itoa(int(login.ProtocolVersion)))
+	}
+
+	return r
+}
+
+// 接收tcp连接, 直到listener被关闭
+func (s *ChatServer) serveTCP(ln net.Listener) {
+	var delay time.Duration
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			// 文件描述符耗尽等临时错误, 等待一段时间后重试
+			if delay == 0 {
+				delay = time.Millisecond * 5
+			} else if delay *= 2; delay > time.Second {
+				delay = time.Second
+			}
+			s.logger.Errorf("accept tcp connection error:%v, retry in %v", err, delay)
+			time.Sleep(delay)
+			continue
+		}
+		delay = 0
+
+		go s.tcpHandler(conn)
+	}
+}
+
+func (s *ChatServer) tcpHandler(netConn net.Conn) {
+	conn := newTCPConn(netConn)
+	defer conn.Close()
+
+	_ = conn.SetReadDeadline(time.Now().Add(LoginTimeout))
+	r, err := readLogin(conn, netConn.RemoteAddr().String())
+	if err != nil {
+		s.logger.Errorf("read login frame error:%v, addr:%s", err, netConn.RemoteAddr())
+		_ = conn.WriteControl(websocket.CloseMessage,
+			websocket.FormatCloseMessage(websocket.ClosePolicyViolation, ErrLoginRequired.Error()), ControlDeadline())
+		return
+	}
+
+	cli := NewClient(conn, s.config.WriteOptions)
+	s.serveClient(cli, r, "", func() {
+		_ = cli.WriteProtoMessage(consts.LoginReply, &pb.LoginReply{ProtocolVersion: int32(cli.ProtocolVersion())})
+	})
+}
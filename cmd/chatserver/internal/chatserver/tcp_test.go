@@ -0,0 +1,214 @@
+package chatserver
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/mangohow/imchat/cmd/chatserver/internal/log"
+	"github.com/mangohow/imchat/pkg/common/xframe"
+	ws "github.com/mangohow/imchat/pkg/common/xwebsocket"
+	"github.com/mangohow/imchat/pkg/consts"
+	"github.com/mangohow/imchat/proto/pb"
+	"google.golang.org/protobuf/proto"
+)
+
+// 启动只有tcp监听的服务器, 认证通过的连接使用device作为uid加入ClientManagerInstance
+func newTestTCPServer(t *testing.T, opts ...func(c *Config)) (*ChatServer, string) {
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &ChatServer{
+		messageHandler: NewMessageHandler(),
+		clientManager:  ClientManagerInstance,
+		ws:             ws.New("/ws/chat"),
+		logger:         log.Logger(),
+		config:         &Config{HeartBeat: time.Second * 5, WriteOptions: DefaultWriteOptions, DrainTimeout: time.Second * 5},
+		ctx:            ctx,
+		cancel:         cancel,
+	}
+	for _, opt := range opts {
+		opt(s.config)
+	}
+	s.SetAfterHandshakeHandler(func(r *http.Request, conn *Client) bool {
+		if r.Header.Get("authorization") != "token" {
+			_ = conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.ClosePolicyViolation, "unauthorized"), time.Now().Add(time.Second))
+			return false
+		}
+		uid, _ := strconv.ParseInt(r.Header.Get("device"), 10, 64)
+		conn.Set("id", uid)
+		conn.Set("device", r.Header.Get("device"))
+		conn.Set("platform", r.Header.Get("platform"))
+		conn.SetAuthed()
+		ClientManagerInstance.Replace(uid, conn)
+		return true
+	})
+	s.SetClientCloseHandler(func(conn *Client) {
+		if conn.Authed() {
+			ClientManagerInstance.Remove(conn.GetUid(), conn)
+		}
+	})
+	s.HandlerAnyFunc(consts.HelloRequest, func(ctx *Context, hello *pb.Hello) *pb.Hello {
+		ctx.SetRespId(consts.HelloReply)
+		platform, _ := ctx.GetString("platform")
+		return &pb.Hello{Message: hello.Message + " from " + platform}
+	})
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.tcpListener = ln
+	go s.serveTCP(ln)
+	t.Cleanup(func() {
+		cancel()
+		_ = ln.Close()
+	})
+
+	return s, ln.Addr().String()
+}
+
+func dialTestTCP(t *testing.T, addr string, login *pb.Login) *tcpConn {
+	netConn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn := newTCPConn(netConn)
+	t.Cleanup(func() { conn.Close() })
+	_ = conn.SetReadDeadline(time.Now().Add(time.Second * 5))
+
+	writeTestTCPFrame(t, conn, xframe.Header{MsgId: consts.LoginRequest}, login)
+
+	return conn
+}
+
+func writeTestTCPFrame(t *testing.T, conn *tcpConn, header xframe.Header, m proto.Message) {
+	body, err := proto.Marshal(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = conn.WriteMessage(websocket.BinaryMessage, xframe.Encode(header, body)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func readTestTCPFrame(t *testing.T, conn *tcpConn, m proto.Message) xframe.Header {
+	_, data, err := conn.ReadMessage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	header, body, err := xframe.Decode(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = proto.Unmarshal(body, m); err != nil {
+		t.Fatal(err)
+	}
+	return header
+}
+
+func TestTCPTransport(t *testing.T) {
+	_, addr := newTestTCPServer(t)
+	conn := dialTestTCP(t, addr, &pb.Login{Token: "token", Platform: "ios", ProtocolVersion: consts.ProtocolV2})
+
+	reply := new(pb.LoginReply)
+	if header := readTestTCPFrame(t, conn, reply); header.MsgId != consts.LoginReply {
+		t.Fatalf("expect login reply, got %d", header.MsgId)
+	}
+	if reply.ProtocolVersion != consts.ProtocolV2 {
+		t.Fatalf("expect protocol v2, got %d", reply.ProtocolVersion)
+	}
+
+	writeTestTCPFrame(t, conn, xframe.Header{Version: xframe.Version1, MsgId: consts.HelloRequest, RequestId: 7}, &pb.Hello{Message: "hello"})
+	hello := new(pb.Hello)
+	header := readTestTCPFrame(t, conn, hello)
+	if header.MsgId != consts.HelloReply || header.RequestId != 7 {
+		t.Fatalf("unexpected header: %+v", header)
+	}
+	if hello.Message != "hello from ios" {
+		t.Fatalf("unexpected reply: %s", hello.Message)
+	}
+
+	// ping帧由服务器回复pong, 不会交给消息处理器
+	pong := make(chan string, 1)
+	if err := conn.WriteControl(websocket.PingMessage, []byte("ping"), time.Now().Add(time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		frameType, data, err := conn.readFrame()
+		if err == nil && frameType == websocket.PongMessage {
+			pong <- string(data)
+		}
+		close(pong)
+	}()
+	select {
+	case data := <-pong:
+		if data != "ping" {
+			t.Fatalf("expect pong with ping data, got %q", data)
+		}
+	case <-time.After(time.Second * 5):
+		t.Fatal("no pong received")
+	}
+}
+
+func TestTCPLoginRequired(t *testing.T) {
+	_, addr := newTestTCPServer(t)
+
+	cases := []struct {
+		name  string
+		login func(conn *tcpConn)
+		code  int
+	}{
+		{"unauthorized", func(conn *tcpConn) {
+			writeTestTCPFrame(t, conn, xframe.Header{MsgId: consts.LoginRequest}, &pb.Login{Token: "bad"})
+		}, websocket.ClosePolicyViolation},
+		{"not login frame", func(conn *tcpConn) {
+			writeTestTCPFrame(t, conn, xframe.Header{MsgId: consts.HelloRequest}, &pb.Hello{})
+		}, websocket.ClosePolicyViolation},
+		{"unsupported version", func(conn *tcpConn) {
+			writeTestTCPFrame(t, conn, xframe.Header{MsgId: consts.LoginRequest}, &pb.Login{Token: "token", ProtocolVersion: 100})
+		}, consts.CloseUnsupportedVersion},
+	}
+	for _, c := range cases {
+		netConn, err := net.Dial("tcp", addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		conn := newTCPConn(netConn)
+		_ = conn.SetReadDeadline(time.Now().Add(time.Second * 5))
+		c.login(conn)
+
+		_, _, err = conn.ReadMessage()
+		closeErr, ok := err.(*websocket.CloseError)
+		if !ok || closeErr.Code != c.code {
+			t.Fatalf("%s: expect close code %d, got %v", c.name, c.code, err)
+		}
+		conn.Close()
+	}
+}
+
+// 心跳的WriteControl和写goroutine的SetWriteDeadline并发执行, 使用-race检查
+func TestTCPWriteDeadlineConcurrent(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+	go io.Copy(io.Discard, client)
+
+	conn := newTCPConn(server)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			_ = conn.SetWriteDeadline(time.Now().Add(time.Second))
+		}
+	}()
+	for i := 0; i < 100; i++ {
+		if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(time.Second)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	<-done
+}
@@ -0,0 +1,32 @@
+package chatserver
+
+import (
+	"net"
+	"time"
+)
+
+/*
+	客户端连接的传输层, 目前有websocket和tcp两种
+
+	方法的语义和gorilla/websocket一致, *websocket.Conn可以直接作为Transport使用:
+	1. 消息类型使用websocket的定义, 如BinaryMessage、CloseMessage
+	2. WriteMessage不支持并发调用, 只在写goroutine中调用; WriteControl可以并发调用
+	3. 收到对方的关闭帧时ReadMessage返回*websocket.CloseError
+*/
+
+type Transport interface {
+	// ReadMessage 读取一个完整的数据帧, 控制帧在内部处理
+	ReadMessage() (messageType int, data []byte, err error)
+	WriteMessage(messageType int, data []byte) error
+	WriteControl(messageType int, data []byte, deadline time.Time) error
+
+	SetReadDeadline(t time.Time) error
+	SetWriteDeadline(t time.Time) error
+	// SetPingHandler 收到ping帧时调用
+	SetPingHandler(h func(appData string) error)
+	// SetPongHandler 收到pong帧时调用
+	SetPongHandler(h func(appData string) error)
+
+	Close() error
+	RemoteAddr() net.Addr
+}
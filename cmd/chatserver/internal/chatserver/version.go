@@ -0,0 +1,97 @@
+package chatserver
+
+import (
+	"encoding/binary"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/websocket"
+	"github.com/mangohow/imchat/pkg/common/xframe"
+	"github.com/mangohow/imchat/pkg/consts"
+)
+
+/*
+	协议版本协商
+	客户端在握手时通过子协议(Sec-WebSocket-Protocol: imchat.v2)或者protocol-version header声明协议版本,
+	浏览器不能设置header, 只能使用子协议
+	没有声明的客户端按最低版本处理, 声明了不支持的版本时使用CloseUnsupportedVersion关闭连接
+
+	每个消息ID可以注册最低协议版本:
+	1. 低于该版本的客户端发送该消息时, 会收到ErrUnsupportedVersion错误帧
+	2. 服务器不会推送该消息给低于该版本的客户端
+*/
+
+var errUnsupportedVersion = errors.New("unsupported protocol version")
+
+// 服务端支持的子协议, 版本高的优先
+func subprotocols() []string {
+	res := make([]string, 0, consts.MaxProtocolVersion-consts.MinProtocolVersion+1)
+	for v := consts.MaxProtocolVersion; v >= consts.MinProtocolVersion; v-- {
+		res = append(res, consts.Subprotocol(v))
+	}
+	return res
+}
+
+// 根据握手请求和协商出的子协议获取客户端的协议版本
+func negotiateVersion(r *http.Request, subprotocol string) (int, error) {
+	if subprotocol != "" {
+		version, ok := consts.ParseSubprotocol(subprotocol)
+		if !ok {
+			return 0, errUnsupportedVersion
+		}
+		return version, nil
+	}
+
+	// 客户端提供了协议版本的子协议, 但是没有服务端支持的
+	// 其它子协议如token.<jwt>不用于协商版本
+	for _, protocol := range websocket.Subprotocols(r) {
+		if strings.HasPrefix(protocol, consts.SubprotocolPrefix) {
+			return 0, errUnsupportedVersion
+		}
+	}
+
+	header := r.Header.Get(consts.ProtocolVersionHeader)
+	if header == "" {
+		return consts.MinProtocolVersion, nil
+	}
+
+	version, err := strconv.Atoi(header)
+	if err != nil || version < consts.MinProtocolVersion || version > consts.MaxProtocolVersion {
+		return 0, errUnsupportedVersion
+	}
+
+	return version, nil
+}
+
+// 消息ID需要的最低协议版本
+var minVersions = make(map[uint32]int)
+
+// RegisterMinVersion 注册消息ID需要的最低协议版本, 需要在服务启动前注册
+func RegisterMinVersion(id uint32, version int) {
+	minVersions[id] = version
+}
+
+// MinVersion 消息ID需要的最低协议版本
+func MinVersion(id uint32) int {
+	if v, ok := minVersions[id]; ok {
+		return v
+	}
+	return consts.MinProtocolVersion
+}
+
+// Supports 客户端的协议版本是否支持该消息
+func (c *Client) Supports(id uint32) bool {
+	return c.protocolVersion >= MinVersion(id)
+}
+
+// 客户端是否支持写队列中的数据, 只检查服务器之间转发的旧格式protobuf帧
+// 其它数据都是对客户端请求的响应, 在处理请求前已经检查过了
+func (c *Client) supportsFrame(res writeData) bool {
+	if len(minVersions) == 0 || res.wsMsgType != websocket.BinaryMessage ||
+		len(res.data) < MessageTypeLen || res.data[3] != xframe.Version0 {
+		return true
+	}
+	return c.Supports(binary.LittleEndian.Uint32(res.data[:MessageTypeLen]))
+}
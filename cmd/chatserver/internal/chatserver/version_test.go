@@ -0,0 +1,82 @@
+package chatserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/websocket"
+	"github.com/mangohow/imchat/pkg/common/xframe"
+	ws "github.com/mangohow/imchat/pkg/common/xwebsocket"
+	"github.com/mangohow/imchat/pkg/consts"
+)
+
+func TestNegotiateVersion(t *testing.T) {
+	versions := make(chan int, 1)
+	server := ws.New("/ws/chat")
+	server.Subprotocols = subprotocols()
+	server.HandleWebSocket(func(conn *websocket.Conn, r *http.Request) {
+		version, err := negotiateVersion(r, conn.Subprotocol())
+		if err != nil {
+			version = -1
+		}
+		versions <- version
+		conn.Close()
+	})
+	s := httptest.NewServer(server.Handler)
+	defer s.Close()
+	url := "ws" + strings.TrimPrefix(s.URL, "http") + "/ws/chat"
+
+	cases := []struct {
+		name         string
+		subprotocols []string
+		header       string
+		expect       int
+	}{
+		{"default", nil, "", consts.MinProtocolVersion},
+		{"subprotocol", []string{consts.Subprotocol(consts.ProtocolV1)}, "", consts.ProtocolV1},
+		{"highest subprotocol", []string{consts.Subprotocol(consts.ProtocolV1), consts.Subprotocol(consts.ProtocolV2)}, "", consts.ProtocolV2},
+		{"unsupported subprotocol", []string{consts.Subprotocol(consts.MaxProtocolVersion + 1)}, "", -1},
+		{"token subprotocol", []string{consts.TokenSubprotocolPrefix + "jwt"}, "", consts.MinProtocolVersion},
+		{"header", nil, "2", consts.ProtocolV2},
+		{"unsupported header", nil, "100", -1},
+	}
+	for _, c := range cases {
+		dialer := *websocket.DefaultDialer
+		dialer.Subprotocols = c.subprotocols
+		header := http.Header{}
+		if c.header != "" {
+			header.Set(consts.ProtocolVersionHeader, c.header)
+		}
+		conn, _, err := dialer.Dial(url, header)
+		if err != nil {
+			t.Fatalf("%s: %v", c.name, err)
+		}
+		if version := <-versions; version != c.expect {
+			t.Fatalf("%s: expect version %d, got %d", c.name, c.expect, version)
+		}
+		conn.Close()
+	}
+}
+
+func TestMinVersion(t *testing.T) {
+	RegisterMinVersion(consts.RecallMessage, consts.ProtocolV2)
+	defer delete(minVersions, consts.RecallMessage)
+
+	c := NewClient(nil, nil)
+	if c.Supports(consts.RecallMessage) || !c.Supports(consts.SingleChatMessage) {
+		t.Fatal("v1 client should only support v1 messages")
+	}
+
+	// 低版本的客户端收不到不支持的推送
+	push := writeData{wsMsgType: websocket.BinaryMessage, data: xframe.Encode(xframe.Header{MsgId: consts.RecallMessage}, nil)}
+	if c.supportsFrame(push) {
+		t.Fatal("v1 client should not receive recall")
+	}
+
+	c.protocolVersion = consts.ProtocolV2
+	if !c.Supports(consts.RecallMessage) || !c.supportsFrame(push) {
+		t.Fatal("v2 client should support recall")
+	}
+}
@@ -0,0 +1,52 @@
+package chatserver
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// 写队列满时的处理策略
+const (
+	// SlowConsumerDisconnect 丢弃数据并断开连接
+	SlowConsumerDisconnect = "disconnect"
+	// SlowConsumerSpill 丢弃数据, 交给SpillFunc保存到离线存储中, 由客户端主动拉取
+	SlowConsumerSpill = "spill"
+)
+
+const (
+	// WriteQueueLen 写队列的长度
+	WriteQueueLen = 1024
+
+	SlowConsumerReason = "slow consumer"
+)
+
+// SpillFunc 数据没有写入写队列时调用, messageType为websocket消息类型
+// BinaryMessage的data为V0或V1帧, 使用xframe.PeekMsgId读取消息ID, json客户端也是一样, 发送时才转换为json
+// 其它类型为关闭帧等控制数据
+type SpillFunc func(c *Client, messageType int, data []byte)
+
+// WriteOptions 客户端写队列的配置
+type WriteOptions struct {
+	// 写数据到socket的超时时间, 超时后断开连接, 0表示不超时
+	WriteTimeout time.Duration
+	// 写队列最多缓存的字节数, 0表示只限制队列长度
+	MaxQueueBytes int64
+	// 写队列满时的处理策略
+	SlowConsumerPolicy string
+	// spill策略下处理被丢弃的数据
+	Spill SpillFunc
+	// 应用层压缩的配置, 为nil时不压缩
+	Compress *CompressOptions
+}
+
+var DefaultWriteOptions = &WriteOptions{
+	SlowConsumerPolicy: SlowConsumerDisconnect,
+}
+
+// 因为接收太慢被断开的连接数
+var slowConsumerDisconnects atomic.Int64
+
+// SlowConsumerDisconnects 返回因为接收太慢被断开的连接数
+func SlowConsumerDisconnects() int64 {
+	return slowConsumerDisconnects.Load()
+}
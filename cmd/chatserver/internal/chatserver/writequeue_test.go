@@ -0,0 +1,81 @@
+package chatserver
+
+import (
+	"testing"
+
+	"github.com/gorilla/websocket"
+	"github.com/mangohow/imchat/pkg/common/xframe"
+	"github.com/mangohow/imchat/pkg/consts"
+)
+
+func TestWriteQueueSpill(t *testing.T) {
+	spilled := 0
+	opts := &WriteOptions{
+		MaxQueueBytes:      10,
+		SlowConsumerPolicy: SlowConsumerSpill,
+		Spill: func(c *Client, messageType int, data []byte) {
+			spilled++
+		},
+	}
+	c := NewClient(nil, opts)
+
+	c.Write(make([]byte, 6))
+	if c.QueueBytes() != 6 || c.QueueLen() != 1 {
+		t.Fatalf("unexpected queue state: %d bytes, %d messages", c.QueueBytes(), c.QueueLen())
+	}
+
+	// 超过字节数限制
+	c.Write(make([]byte, 6))
+	if spilled != 1 || c.QueueBytes() != 6 || c.QueueLen() != 1 {
+		t.Fatalf("expect data to be spilled, spilled:%d bytes:%d", spilled, c.QueueBytes())
+	}
+
+	// 取出数据后可以继续写入
+	c.dequeued(<-c.ch)
+	c.Write(make([]byte, 6))
+	if spilled != 1 || c.QueueBytes() != 6 {
+		t.Fatalf("expect data to be queued, spilled:%d bytes:%d", spilled, c.QueueBytes())
+	}
+}
+
+func TestWriteQueueFull(t *testing.T) {
+	spilled := 0
+	opts := &WriteOptions{
+		SlowConsumerPolicy: SlowConsumerSpill,
+		Spill: func(c *Client, messageType int, data []byte) {
+			spilled++
+		},
+	}
+	c := NewClient(nil, opts)
+
+	// 写队列满时不会阻塞
+	for i := 0; i < WriteQueueLen+10; i++ {
+		c.Write([]byte{1})
+	}
+	if spilled != 10 || c.QueueLen() != WriteQueueLen {
+		t.Fatalf("unexpected spilled:%d len:%d", spilled, c.QueueLen())
+	}
+}
+
+// json客户端的写队列中也是protobuf帧, 发送时才转换, spill时可以读取消息ID
+func TestWriteQueueSpillJSONClient(t *testing.T) {
+	var spilledType int
+	var spilledId uint32
+	opts := &WriteOptions{
+		SlowConsumerPolicy: SlowConsumerSpill,
+		Spill: func(c *Client, messageType int, data []byte) {
+			spilledType = messageType
+			spilledId, _ = xframe.PeekMsgId(data)
+		},
+	}
+	c := NewClient(nil, opts)
+	c.codec = JSONCodec
+	for i := 0; i < WriteQueueLen; i++ {
+		c.Write([]byte{1})
+	}
+
+	c.Write(xframe.Encode(xframe.Header{Version: xframe.Version1, MsgId: consts.GroupChatAck, RequestId: 1}, nil))
+	if spilledType != websocket.BinaryMessage || spilledId != consts.GroupChatAck {
+		t.Fatalf("unexpected spilled frame type:%d msgId:%d", spilledType, spilledId)
+	}
+}
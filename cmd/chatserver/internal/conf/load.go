@@ -4,6 +4,7 @@ import (
 	"path/filepath"
 	"strings"
 
+	"github.com/mangohow/imchat/cmd/chatserver/internal/consts"
 	"github.com/mangohow/imchat/pkg/common/xconfig"
 	"github.com/spf13/viper"
 )
@@ -14,6 +15,18 @@ var (
 	RedisConf *xconfig.RedisConfig
 	MqConf *xconfig.RabbitMqConfig
 	MongoConf *xconfig.MongoConfig
+	MysqlConf *xconfig.MysqlConfig
+	SessionConf *xconfig.SessionConfig
+	MessageConf *xconfig.MessageConfig
+	WriteQueueConf *xconfig.WriteQueueConfig
+	RateLimitConf *xconfig.RateLimitConfig
+	CompressionConf *xconfig.CompressionConfig
+	WebSocketConf *xconfig.WebSocketConfig
+	DrainConf *xconfig.DrainConfig
+	HeartbeatConf *xconfig.HeartbeatConfig
+	AdminConf *xconfig.AdminConfig
+	MetricsConf *xconfig.MetricsConfig
+	RegistryConf *xconfig.RegistryConfig
 )
 
 
@@ -38,12 +51,41 @@ func LoadConf(path string) error {
 	initLogConf()
 	initMqConf()
 	initMongoConf()
+	initMysqlConf()
+	initSessionConf()
+	initMessageConf()
+	initWriteQueueConf()
+	if err = initRateLimitConf(); err != nil {
+		return err
+	}
+	if err = initCompressionConf(); err != nil {
+		return err
+	}
+	initWebSocketConf()
+	initDrainConf()
+	initHeartbeatConf()
+	initAdminConf()
+	initMetricsConf()
+	initRegistryConf()
 
 	return nil
 }
 
 func setDefault() {
-
+	viper.SetDefault("session.policy", "platform")
+	viper.SetDefault("message.recallWindow", "2m")
+	viper.SetDefault("writeQueue.writeTimeout", "10s")
+	viper.SetDefault("writeQueue.maxQueueBytes", 4 << 20)
+	viper.SetDefault("writeQueue.slowConsumerPolicy", "disconnect")
+	viper.SetDefault("rateLimit.maxViolations", 20)
+	viper.SetDefault("rateLimit.violationWindow", "1m")
+	viper.SetDefault("compression.level", 1)
+	viper.SetDefault("drain.timeout", "30s")
+	viper.SetDefault("heartbeat.timeout", consts.HeartBeatTime)
+	viper.SetDefault("admin.host", "127.0.0.1")
+	viper.SetDefault("metrics.host", "127.0.0.1")
+	viper.SetDefault("metrics.port", 6389)
+	viper.SetDefault("registry.leaseTTL", "30s")
 }
 
 func initServerConf() {
@@ -52,7 +94,12 @@ func initServerConf() {
 		Port: viper.GetInt("server.port"),
 		Name: viper.GetString("server.name"),
 		Mode: viper.GetString("server.mode"),
-
+		TCPPort: viper.GetInt("server.tcpPort"),
+		CertFile: viper.GetString("server.certFile"),
+		KeyFile: viper.GetString("server.keyFile"),
+		ClientCAFile: viper.GetString("server.clientCAFile"),
+		RequireClientCert: viper.GetBool("server.requireClientCert"),
+		CertReloadInterval: viper.GetDuration("server.certReloadInterval"),
 	}
 }
 
@@ -93,4 +140,93 @@ func initMongoConf() {
 		MaxPoolSize: viper.GetInt("mongo.maxPoolSize"),
 		MinPoolSize: viper.GetInt("mongo.minPoolSize"),
 	}
-}
\ No newline at end of file
+}
+
+func initMysqlConf() {
+	MysqlConf = &xconfig.MysqlConfig{
+		DataSourceName: viper.GetString("mysql.dataSourceName"),
+		MaxOpenConns:   viper.GetInt("mysql.maxOpenConns"),
+		MaxIdleConns:   viper.GetInt("mysql.maxIdleConns"),
+	}
+}
+
+func initSessionConf() {
+	SessionConf = &xconfig.SessionConfig{
+		Policy: viper.GetString("session.policy"),
+	}
+}
+
+func initMessageConf() {
+	MessageConf = &xconfig.MessageConfig{
+		RecallWindow: viper.GetDuration("message.recallWindow"),
+	}
+}
+
+func initWriteQueueConf() {
+	WriteQueueConf = &xconfig.WriteQueueConfig{
+		WriteTimeout:       viper.GetDuration("writeQueue.writeTimeout"),
+		MaxQueueBytes:      viper.GetInt64("writeQueue.maxQueueBytes"),
+		SlowConsumerPolicy: viper.GetString("writeQueue.slowConsumerPolicy"),
+	}
+}
+
+func initRateLimitConf() error {
+	RateLimitConf = &xconfig.RateLimitConfig{
+		Enable:          viper.GetBool("rateLimit.enable"),
+		MaxViolations:   viper.GetInt("rateLimit.maxViolations"),
+		ViolationWindow: viper.GetDuration("rateLimit.violationWindow"),
+	}
+	return viper.UnmarshalKey("rateLimit.rules", &RateLimitConf.Rules)
+}
+
+func initCompressionConf() error {
+	CompressionConf = &xconfig.CompressionConfig{
+		Deflate: viper.GetBool("compression.deflate"),
+		Level:   viper.GetInt("compression.level"),
+		MinSize: viper.GetInt("compression.minSize"),
+	}
+	return viper.UnmarshalKey("compression.msgIds", &CompressionConf.MsgIds)
+}
+
+func initWebSocketConf() {
+	WebSocketConf = &xconfig.WebSocketConfig{
+		AllowedOrigins: viper.GetStringSlice("websocket.allowedOrigins"),
+	}
+}
+
+func initDrainConf() {
+	DrainConf = &xconfig.DrainConfig{
+		Timeout: viper.GetDuration("drain.timeout"),
+		Nodes:   viper.GetStringSlice("drain.nodes"),
+	}
+}
+
+func initHeartbeatConf() {
+	HeartbeatConf = &xconfig.HeartbeatConfig{
+		Timeout:      viper.GetDuration("heartbeat.timeout"),
+		PingInterval: viper.GetDuration("heartbeat.pingInterval"),
+		IdleTimeout:  viper.GetDuration("heartbeat.idleTimeout"),
+	}
+}
+
+func initAdminConf() {
+	AdminConf = &xconfig.AdminConfig{
+		Host:  viper.GetString("admin.host"),
+		Port:  viper.GetInt("admin.port"),
+		Token: viper.GetString("admin.token"),
+	}
+}
+
+func initMetricsConf() {
+	MetricsConf = &xconfig.MetricsConfig{
+		Host: viper.GetString("metrics.host"),
+		Port: viper.GetInt("metrics.port"),
+	}
+}
+
+func initRegistryConf() {
+	RegistryConf = &xconfig.RegistryConfig{
+		LeaseTTL:      viper.GetDuration("registry.leaseTTL"),
+		AdvertiseAddr: viper.GetString("registry.advertiseAddr"),
+	}
+}
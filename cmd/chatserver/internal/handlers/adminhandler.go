@@ -0,0 +1,383 @@
+package handlers
+
+import (
+	"context"
+	"crypto/subtle"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+	"github.com/mangohow/easygin"
+	"github.com/mangohow/imchat/cmd/chatserver/internal/chatserver"
+	"github.com/mangohow/imchat/cmd/chatserver/internal/log"
+	"github.com/mangohow/imchat/cmd/chatserver/internal/rdsconn"
+	"github.com/mangohow/imchat/pkg/consts"
+	"github.com/mangohow/imchat/pkg/consts/redisconsts"
+	"github.com/mangohow/imchat/proto/pb"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/protobuf/proto"
+)
+
+/*
+	管理接口, 使用单独的端口, 所有请求都需要在authorization header中携带admin token
+	GET  /admin/clients?uid=   本服务器上的连接, uid为空时返回所有
+	GET  /admin/stats          本服务器的统计
+	GET  /admin/nodes          根据redis中的路由统计每台服务器上的会话数
+	POST /admin/kick           将用户下线, json: {uid, platform, device, reason}
+	POST /admin/send           发送帧给用户, json: {uid, platform, device, msgId, data}, data为base64编码的protobuf数据
+	POST /admin/announce       发布系统公告, 参考AnnouncementHandler
+
+	下线和发送会根据redis中的路由转发给用户所在的服务器, 不在线的用户直接忽略
+*/
+
+// 管理接口的结果码
+const (
+	AdminParamInvalid = iota + 1
+	AdminQueryFailed
+)
+
+// DefaultKickReason 没有指定原因时使用
+const DefaultKickReason = "kicked by admin"
+
+type AdminHandler struct {
+	logger   *logrus.Logger
+	redis    *redis.Client
+	serverId string
+	server   *chatserver.ChatServer
+}
+
+func NewAdminHandler(server *chatserver.ChatServer) *AdminHandler {
+	return &AdminHandler{
+		logger:   log.Logger(),
+		redis:    rdsconn.RedisConn(),
+		serverId: server.ServerId(),
+		server:   server,
+	}
+}
+
+// AdminAuth 检查admin token, token为空时拒绝所有请求
+func AdminAuth(token string) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		got := ctx.GetHeader("authorization")
+		if token == "" || subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+			log.Logger().Warnf("admin unauthorized, ip:%s", ctx.Request.RemoteAddr)
+			ctx.JSON(http.StatusUnauthorized, &easygin.Error(http.StatusUnauthorized, -1).R)
+			ctx.Abort()
+			return
+		}
+
+		ctx.Next()
+	}
+}
+
+type ClientInfo struct {
+	Uid         int64  `json:"uid"`
+	Platform    string `json:"platform"`
+	Device      string `json:"device"`
+	RemoteAddr  string `json:"remoteAddr"`
+	ConnectTime int64  `json:"connectTime"`
+	LastActive  int64  `json:"lastActive"`
+	RTT         int64  `json:"rtt"`
+	QueueLen    int    `json:"queueLen"`
+	QueueBytes  int64  `json:"queueBytes"`
+}
+
+// Clients 本服务器上的连接, 时间为毫秒时间戳, rtt为毫秒
+// GET /admin/clients?uid=
+func (h *AdminHandler) Clients(ctx *gin.Context) *easygin.Result {
+	var uid int64
+	if s := ctx.Query("uid"); s != "" {
+		var err error
+		if uid, err = strconv.ParseInt(s, 10, 64); err != nil {
+			return easygin.Fail(AdminParamInvalid)
+		}
+	}
+
+	clients := make([]*ClientInfo, 0)
+	add := func(id int64, c *chatserver.Client) {
+		clients = append(clients, &ClientInfo{
+			Uid:         id,
+			Platform:    c.GetPlatform(),
+			Device:      c.GetDevice(),
+			RemoteAddr:  c.RemoteAddr(),
+			ConnectTime: c.CreateTime().UnixMilli(),
+			LastActive:  c.LastActive().UnixMilli(),
+			RTT:         c.RTT().Milliseconds(),
+			QueueLen:    c.QueueLen(),
+			QueueBytes:  c.QueueBytes(),
+		})
+	}
+	if uid != 0 {
+		for _, c := range chatserver.ClientManagerInstance.Get(uid) {
+			add(uid, c)
+		}
+	} else {
+		chatserver.ClientManagerInstance.Range(func(id int64, c *chatserver.Client) bool {
+			add(id, c)
+			return true
+		})
+	}
+
+	return easygin.Ok(clients)
+}
+
+type NodeStats struct {
+	ServerId       string `json:"serverId"`
+	Connections    int64  `json:"connections"`
+	Clients        int    `json:"clients"`
+	Users          int    `json:"users"`
+	QueuedMessages int    `json:"queuedMessages"`
+	SlowConsumers  int64  `json:"slowConsumers"`
+	Draining       bool   `json:"draining"`
+}
+
+// Stats 本服务器的统计, connections包括还没有认证的连接
+// GET /admin/stats
+func (h *AdminHandler) Stats(ctx *gin.Context) *easygin.Result {
+	stats := &NodeStats{
+		ServerId:      h.serverId,
+		Connections:   h.server.Connections(),
+		SlowConsumers: chatserver.SlowConsumerDisconnects(),
+		Draining:      h.server.Draining(),
+	}
+	users := make(map[int64]struct{})
+	chatserver.ClientManagerInstance.Range(func(id int64, c *chatserver.Client) bool {
+		stats.Clients++
+		stats.QueuedMessages += c.QueueLen()
+		users[id] = struct{}{}
+		return true
+	})
+	stats.Users = len(users)
+
+	return easygin.Ok(stats)
+}
+
+// 扫描路由时每批的数量
+const nodeScanCount = 1000
+
+// Nodes 根据redis中的路由统计每台服务器上的会话数, 需要扫描所有用户的路由, 只在排查问题时使用
+// GET /admin/nodes
+func (h *AdminHandler) Nodes(ctx *gin.Context) *easygin.Result {
+	nodes, err := h.countSessions(ctx.Request.Context())
+	if err != nil {
+		h.logger.Errorf("count sessions error:%v", err)
+		return easygin.Fail(AdminQueryFailed)
+	}
+
+	return easygin.Ok(nodes)
+}
+
+func (h *AdminHandler) countSessions(ctx context.Context) (map[string]int, error) {
+	nodes := make(map[string]int)
+	var cursor uint64
+	for {
+		keys, next, err := h.redis.Scan(ctx, cursor, redisconsts.ChatServerClientKey+"*", nodeScanCount).Result()
+		if err != nil {
+			return nil, err
+		}
+
+		pip := h.redis.Pipeline()
+		cmds := make([]*redis.StringSliceCmd, len(keys))
+		for i, key := range keys {
+			cmds[i] = pip.HVals(ctx, key)
+		}
+		if len(keys) > 0 {
+			if _, err = pip.Exec(ctx); err != nil && err != redis.Nil {
+				return nil, err
+			}
+		}
+		for _, cmd := range cmds {
+			for _, serverId := range cmd.Val() {
+				nodes[serverId]++
+			}
+		}
+
+		if cursor = next; cursor == 0 {
+			return nodes, nil
+		}
+	}
+}
+
+// platform和device为空时不限制
+type AdminKickRequest struct {
+	Uid      int64  `json:"uid"`
+	Platform string `json:"platform"`
+	Device   string `json:"device"`
+	Reason   string `json:"reason"`
+}
+
+type AdminSendRequest struct {
+	Uid      int64  `json:"uid"`
+	Platform string `json:"platform"`
+	Device   string `json:"device"`
+	MsgId    uint32 `json:"msgId"`
+	Data     []byte `json:"data"`
+}
+
+// AdminResult 下线和发送的结果, local为本服务器上处理的连接数, nodes为转发到的其它服务器
+type AdminResult struct {
+	Local int      `json:"local"`
+	Nodes []string `json:"nodes"`
+}
+
+// Kick 将用户下线, platform和device都为空时下线所有设备
+// POST /admin/kick json: {uid, platform, device, reason}
+func (h *AdminHandler) Kick(ctx *gin.Context, req *AdminKickRequest) *easygin.Result {
+	if req.Uid <= 0 {
+		return easygin.Fail(AdminParamInvalid)
+	}
+	if req.Reason == "" {
+		req.Reason = DefaultKickReason
+	}
+
+	kick := &pb.KickOut{
+		Uid:       req.Uid,
+		LoginTime: time.Now().UnixMicro(),
+		Reason:    req.Reason,
+		Device:    req.Device,
+		Platform:  req.Platform,
+	}
+	local := kickLocal(kick)
+	res, err := h.dispatch(req.Uid, req.Platform, req.Device, consts.AdminKickNotify, kick)
+	if err != nil {
+		h.logger.Errorf("kick error:%v", err)
+		return easygin.Fail(AdminQueryFailed)
+	}
+	res.Local = local
+	h.logger.Infof("admin kick uid:%d, platform:%s, device:%s, reason:%s, local:%d, nodes:%v",
+		req.Uid, req.Platform, req.Device, req.Reason, res.Local, res.Nodes)
+
+	return easygin.Ok(res)
+}
+
+// Send 发送帧给用户, 客户端收到的消息ID为msgId, 数据为data
+// msgId需要注册过protobuf类型, 参考chatserver.RegisterMessageType, 否则返回400
+// POST /admin/send json: {uid, platform, device, msgId, data}
+func (h *AdminHandler) Send(ctx *gin.Context, req *AdminSendRequest) *easygin.Result {
+	if req.Uid <= 0 || req.MsgId == 0 {
+		return easygin.Fail(AdminParamInvalid)
+	}
+	// 发送时才转换为客户端使用的格式, 没有注册的消息发送给使用JSON的客户端时会失败
+	if !chatserver.MessageTypeRegistered(req.MsgId) {
+		return easygin.Error(http.StatusBadRequest, AdminParamInvalid)
+	}
+
+	frame := &pb.AdminFrame{
+		Uid:      req.Uid,
+		MsgId:    req.MsgId,
+		Data:     req.Data,
+		Device:   req.Device,
+		Platform: req.Platform,
+	}
+	local := sendLocal(frame)
+	res, err := h.dispatch(req.Uid, req.Platform, req.Device, consts.AdminFrameNotify, frame)
+	if err != nil {
+		h.logger.Errorf("send frame error:%v", err)
+		return easygin.Fail(AdminQueryFailed)
+	}
+	res.Local = local
+
+	return easygin.Ok(res)
+}
+
+// 转发给用户所在的其它服务器, 指定了platform或device时只转发给匹配的设备所在的服务器
+func (h *AdminHandler) dispatch(uid int64, platform, device string, id uint32, message proto.Message) (*AdminResult, error) {
+	sessions, err := h.redis.HGetAll(context.Background(), clientKey(uid)).Result()
+	if err != nil && err != redis.Nil {
+		return nil, err
+	}
+
+	servers := make(map[string]struct{})
+	for field, serverId := range sessions {
+		if p, d := parseSessionField(field); !deviceMatch(platform, device, p, d) {
+			continue
+		}
+		if serverId != h.serverId {
+			servers[serverId] = struct{}{}
+		}
+	}
+	filterAlive(servers)
+
+	res := &AdminResult{Nodes: make([]string, 0, len(servers))}
+	if len(servers) == 0 {
+		return res, nil
+	}
+
+	data, err := chatserver.MarshalProtoMessage(id, message)
+	if err != nil {
+		return nil, err
+	}
+	for serverId := range servers {
+		res.Nodes = append(res.Nodes, serverId)
+	}
+	if err = publishToServers(servers, data); err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+// KickOut 收到其它服务器管理接口的下线通知
+func (h *AdminHandler) KickOut(data []byte) error {
+	kick := new(pb.KickOut)
+	if err := proto.Unmarshal(data[chatserver.MessageTypeLen:], kick); err != nil {
+		return err
+	}
+
+	kickLocal(kick)
+	return nil
+}
+
+// SendFrame 收到其它服务器管理接口发送的帧
+func (h *AdminHandler) SendFrame(data []byte) error {
+	frame := new(pb.AdminFrame)
+	if err := proto.Unmarshal(data[chatserver.MessageTypeLen:], frame); err != nil {
+		return err
+	}
+
+	sendLocal(frame)
+	return nil
+}
+
+// 将本服务器上在loginTime之前建立的连接下线, 返回下线的连接数
+func kickLocal(kick *pb.KickOut) int {
+	n := 0
+	for _, c := range localClients(kick.Uid, kick.Platform, kick.Device) {
+		if !c.CreateTime().Before(time.UnixMicro(kick.LoginTime)) {
+			continue
+		}
+		_ = c.Kick(consts.CloseKicked, kick.Reason)
+		n++
+	}
+	return n
+}
+
+func sendLocal(frame *pb.AdminFrame) int {
+	clients := localClients(frame.Uid, frame.Platform, frame.Device)
+	for _, c := range clients {
+		c.WriteData(frame.MsgId, frame.Data)
+	}
+	return len(clients)
+}
+
+// 本服务器上用户的连接, platform和device为空时不限制
+func localClients(uid int64, platform, device string) []*chatserver.Client {
+	clients := chatserver.ClientManagerInstance.Get(uid)
+	if platform == "" && device == "" {
+		return clients
+	}
+
+	res := make([]*chatserver.Client, 0, len(clients))
+	for _, c := range clients {
+		if deviceMatch(platform, device, c.GetPlatform(), c.GetDevice()) {
+			res = append(res, c)
+		}
+	}
+	return res
+}
+
+func deviceMatch(platform, device, p, d string) bool {
+	return (platform == "" || platform == p) && (device == "" || device == d)
+}
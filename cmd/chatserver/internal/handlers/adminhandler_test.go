@@ -0,0 +1,113 @@
+package handlers
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mangohow/imchat/cmd/chatserver/internal/chatserver"
+	"github.com/mangohow/imchat/cmd/chatserver/internal/conf"
+	"github.com/mangohow/imchat/cmd/chatserver/internal/log"
+	"github.com/mangohow/imchat/pkg/common/xconfig"
+	"github.com/mangohow/imchat/proto/pb"
+)
+
+func TestMain(m *testing.M) {
+	conf.LoggerConf = &xconfig.LogConfig{Level: "fatal"}
+	if err := log.InitLogger(); err != nil {
+		panic(err)
+	}
+	os.Exit(m.Run())
+}
+
+func TestAdminAuth(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cases := []struct {
+		token  string
+		header string
+		status int
+	}{
+		{"secret", "secret", http.StatusOK},
+		{"secret", "wrong", http.StatusUnauthorized},
+		{"secret", "", http.StatusUnauthorized},
+		// 没有配置token时拒绝所有请求
+		{"", "", http.StatusUnauthorized},
+	}
+	for _, c := range cases {
+		engine := gin.New()
+		engine.Use(AdminAuth(c.token))
+		engine.GET("/admin/stats", func(ctx *gin.Context) {
+			ctx.Status(http.StatusOK)
+		})
+
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, "/admin/stats", nil)
+		r.Header.Set("authorization", c.header)
+		engine.ServeHTTP(w, r)
+		if w.Code != c.status {
+			t.Fatalf("token %q header %q: expect %d, got %d", c.token, c.header, c.status, w.Code)
+		}
+	}
+}
+
+// 只记录是否被关闭的连接
+type fakeTransport struct {
+	closed bool
+}
+
+func (f *fakeTransport) ReadMessage() (int, []byte, error)         { return 0, nil, nil }
+func (f *fakeTransport) WriteMessage(int, []byte) error            { return nil }
+func (f *fakeTransport) WriteControl(int, []byte, time.Time) error { return nil }
+func (f *fakeTransport) SetReadDeadline(time.Time) error           { return nil }
+func (f *fakeTransport) SetWriteDeadline(time.Time) error          { return nil }
+func (f *fakeTransport) SetPingHandler(func(string) error)         {}
+func (f *fakeTransport) SetPongHandler(func(string) error)         {}
+func (f *fakeTransport) Close() error                              { f.closed = true; return nil }
+func (f *fakeTransport) RemoteAddr() net.Addr                      { return &net.TCPAddr{} }
+
+// 没有注册的消息ID不能转换为JSON, 发送之前拒绝
+func TestAdminSendUnregistered(t *testing.T) {
+	h := &AdminHandler{logger: log.Logger()}
+	res := h.Send(nil, &AdminSendRequest{Uid: 1, MsgId: 65001})
+	if res.Status != http.StatusBadRequest {
+		t.Fatalf("expect 400 for unregistered msgId, got %d", res.Status)
+	}
+}
+
+func TestKickLocal(t *testing.T) {
+	const uid = 1001
+	transports := map[string]*fakeTransport{}
+	for _, device := range []string{"phone", "pc"} {
+		transports[device] = new(fakeTransport)
+		c := chatserver.NewClient(transports[device], nil)
+		c.Set("id", int64(uid))
+		c.Set("device", device)
+		chatserver.ClientManagerInstance.Replace(uid, c)
+	}
+	t.Cleanup(func() {
+		chatserver.ClientManagerInstance.Del(uid)
+	})
+
+	// 下线通知之后建立的连接不受影响
+	if n := kickLocal(&pb.KickOut{Uid: uid, LoginTime: time.Now().Add(-time.Hour).UnixMicro()}); n != 0 {
+		t.Fatalf("expect no kick for newer connections, got %d", n)
+	}
+
+	if n := kickLocal(&pb.KickOut{Uid: uid, LoginTime: time.Now().UnixMicro(), Device: "pc"}); n != 1 {
+		t.Fatalf("expect 1 kick, got %d", n)
+	}
+	if !transports["pc"].closed || transports["phone"].closed {
+		t.Fatalf("expect only pc closed, pc:%v phone:%v", transports["pc"].closed, transports["phone"].closed)
+	}
+
+	if n := kickLocal(&pb.KickOut{Uid: uid, LoginTime: time.Now().UnixMicro()}); n != 2 {
+		t.Fatalf("expect all devices kicked, got %d", n)
+	}
+	if !transports["phone"].closed {
+		t.Fatal("expect phone closed")
+	}
+}
@@ -0,0 +1,100 @@
+package handlers
+
+import (
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mangohow/easygin"
+	"github.com/mangohow/imchat/cmd/chatserver/internal/chatserver"
+	"github.com/mangohow/imchat/cmd/chatserver/internal/log"
+	"github.com/mangohow/imchat/cmd/chatserver/internal/mongodb/dao"
+	"github.com/mangohow/imchat/cmd/chatserver/internal/mq"
+	"github.com/mangohow/imchat/pkg/consts"
+	"github.com/mangohow/imchat/pkg/consts/mqconsts"
+	"github.com/mangohow/imchat/pkg/model"
+	"github.com/mangohow/imchat/proto/pb"
+	"github.com/sirupsen/logrus"
+)
+
+// AnnouncementHandler 系统公告
+// 1. 管理接口发布公告时先保存到mongo中, 然后发送到fanout交换机, 只发送一次
+// 2. 每台服务器从自己的公告队列中收到公告, 推送给本服务器上的所有连接, 公告队列只在服务器运行时存在
+// 3. 离线的用户上线后从messageserver拉取, 客户端保存收到的最后一条公告的位置(createTime, id), 推送和拉取都会更新
+//    拉取时带上该位置, 只拉取之后的公告, 每个设备独立保存, 已经收到过的公告不会重复
+type AnnouncementHandler struct {
+	logger          *logrus.Logger
+	announcementDao *dao.AnnouncementDao
+}
+
+func NewAnnouncementHandler() *AnnouncementHandler {
+	return &AnnouncementHandler{
+		logger:          log.Logger(),
+		announcementDao: dao.NewAnnouncementDao(),
+	}
+}
+
+type AnnounceRequest struct {
+	Title   string `json:"title"`
+	Content string `json:"content"`
+	// 过期时间, 毫秒时间戳, 为0时不过期
+	ExpireTime int64 `json:"expireTime"`
+}
+
+// Announce 发布系统公告, 返回公告ID
+// POST /admin/announce json: {title, content, expireTime}
+func (h *AnnouncementHandler) Announce(ctx *gin.Context, req *AnnounceRequest) *easygin.Result {
+	now := time.Now().UnixMilli()
+	if req.Content == "" || (req.ExpireTime != 0 && req.ExpireTime <= now) {
+		return easygin.Fail(AdminParamInvalid)
+	}
+
+	record := &model.Announcement{
+		Title:      req.Title,
+		Content:    req.Content,
+		CreateTime: now,
+		ExpireTime: req.ExpireTime,
+	}
+	id, err := h.announcementDao.PersistAnnouncement(record)
+	if err != nil {
+		h.logger.Errorf("persist announcement error:%v", err)
+		return easygin.Fail(AdminQueryFailed)
+	}
+
+	data, err := chatserver.MarshalProtoMessage(consts.SystemAnnouncement, &pb.Announcement{
+		Id:         id.Hex(),
+		Title:      record.Title,
+		Content:    record.Content,
+		CreateTime: record.CreateTime,
+		ExpireTime: record.ExpireTime,
+	})
+	if err != nil {
+		h.logger.Errorf("marshal error:%v", err)
+		return easygin.Fail(AdminQueryFailed)
+	}
+
+	// 已经保存了, 发送失败时在线用户也可以通过拉取获取到
+	if err = mq.ProducerInstance.Broadcast(mqconsts.AnnouncementExchange, data); err != nil {
+		h.logger.Errorf("broadcast announcement error:%v", err)
+		return easygin.Fail(AdminQueryFailed)
+	}
+	h.logger.Infof("announcement published, id:%s", id.Hex())
+
+	return easygin.Ok(id.Hex())
+}
+
+// Deliver 收到公告, 推送给本服务器上的所有连接
+// 先取出所有连接再发送, 不在ClientManager的锁中写数据
+func (h *AnnouncementHandler) Deliver(data []byte) error {
+	var clients []*chatserver.Client
+	chatserver.ClientManagerInstance.Range(func(id int64, c *chatserver.Client) bool {
+		clients = append(clients, c)
+		return true
+	})
+
+	for _, c := range clients {
+		c.Write(data)
+	}
+	h.logger.Debugf("announcement delivered to %d clients", len(clients))
+
+	return nil
+}
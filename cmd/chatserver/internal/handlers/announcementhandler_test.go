@@ -0,0 +1,39 @@
+package handlers
+
+import (
+	"testing"
+
+	"github.com/mangohow/imchat/cmd/chatserver/internal/chatserver"
+	"github.com/mangohow/imchat/cmd/chatserver/internal/log"
+	"github.com/mangohow/imchat/pkg/consts"
+	"github.com/mangohow/imchat/proto/pb"
+)
+
+func TestDeliverAnnouncement(t *testing.T) {
+	var clients []*chatserver.Client
+	for _, uid := range []int64{2001, 2002} {
+		c := chatserver.NewClient(new(fakeTransport), nil)
+		c.Set("id", uid)
+		c.Set("device", "phone")
+		chatserver.ClientManagerInstance.Replace(uid, c)
+		clients = append(clients, c)
+	}
+	t.Cleanup(func() {
+		chatserver.ClientManagerInstance.Del(2001)
+		chatserver.ClientManagerInstance.Del(2002)
+	})
+
+	data, err := chatserver.MarshalProtoMessage(consts.SystemAnnouncement, &pb.Announcement{Id: "1", Content: "maintenance"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := &AnnouncementHandler{logger: log.Logger()}
+	if err = h.Deliver(data); err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range clients {
+		if c.QueueLen() != 1 {
+			t.Fatalf("uid %d: expect 1 queued announcement, got %d", c.GetUid(), c.QueueLen())
+		}
+	}
+}
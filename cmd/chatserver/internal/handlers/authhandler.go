@@ -4,43 +4,54 @@ import (
 	"context"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/go-redis/redis/v8"
 	"github.com/gorilla/websocket"
 	"github.com/mangohow/imchat/cmd/chatserver/internal/chatserver"
 	"github.com/mangohow/imchat/cmd/chatserver/internal/log"
+	"github.com/mangohow/imchat/cmd/chatserver/internal/mq"
 	"github.com/mangohow/imchat/cmd/chatserver/internal/rdsconn"
+	"github.com/mangohow/imchat/pkg/consts"
 	"github.com/mangohow/imchat/pkg/consts/redisconsts"
 	"github.com/mangohow/imchat/pkg/utils"
+	"github.com/mangohow/imchat/proto/pb"
 	"github.com/sirupsen/logrus"
+	"google.golang.org/protobuf/proto"
 )
 
 type AuthHandler struct {
 	logger *logrus.Logger
 	redis *redis.Client
-	heartBeat time.Duration
 	serverId string
+	// 多设备登录策略
+	policy string
+	presenceHandler IPresenceHandler
 }
 
-func NewAuthHandler(heartBeat time.Duration, serverId string) *AuthHandler {
+func NewAuthHandler(serverId string, policy string, presenceHandler IPresenceHandler) *AuthHandler {
 	return &AuthHandler{
 		logger: log.Logger(),
 		redis: rdsconn.RedisConn(),
 		serverId: serverId,
-		heartBeat: heartBeat,
+		policy: policy,
+		presenceHandler: presenceHandler,
 	}
 }
 
-var UnauthorizedMessage = []byte("unauthorized")
+// UnauthorizedMessage 认证失败时发送的关闭帧, websocket和tcp连接都使用相同的格式
+var UnauthorizedMessage = websocket.FormatCloseMessage(websocket.ClosePolicyViolation, "unauthorized")
 
 func (h *AuthHandler) Auth(r *http.Request, conn *chatserver.Client) bool {
 	h.logger.Debug("auth handler")
-	token := r.Header.Get("authorization")
+	token, source := getToken(r, h.redeemTicket)
 	if token == "" {
 		h.logger.Errorf("no authorization, addr:%s", r.RemoteAddr)
+		_ = conn.WriteControl(websocket.CloseMessage, UnauthorizedMessage, chatserver.ControlDeadline())
 		return false
 	}
+	h.logger.Debugf("token from %s, addr:%s", source, r.RemoteAddr)
 
 	for {
 		id, username, err := utils.ParseToken(token)
@@ -65,31 +76,44 @@ func (h *AuthHandler) Auth(r *http.Request, conn *chatserver.Client) bool {
 		// 验证通过 保存客户端信息到redis
 		conn.Set("id", id)
 		conn.Set("username", username)
+		platform, device := getDeviceInfo(r)
+		conn.Set("platform", platform)
+		conn.Set("device", device)
 
-		clientKey := redisconsts.ChatServerClientKey + strconv.Itoa(int(id))
-		setVal := h.serverId
-		s, err := h.redis.GetSet(context.Background(), clientKey, setVal).Result()
-		if err != nil && err != redis.Nil {
+		conn.SetAuthed()
+
+		// 添加到manager中, 如果本服务器上已经存在该设备的连接, 会被替换掉
+		old := chatserver.ClientManagerInstance.Replace(id, conn)
+
+		// 注册会话, 并获取该用户的其它会话
+		sessions, err := h.registerSession(conn)
+		if err != nil {
 			h.logger.Errorf("set client key error:%v", err)
+			chatserver.ClientManagerInstance.Remove(id, conn)
 			return false
 		}
 
-		// 判断是否重复登录, 如果重复登录，就让另一端下线
-		// 如果s != "" 则说明该用户已经登录, 因此不能重复登录
-		if s != "" {
-			h.logger.Debug("duplicate login:", s)
-			h.handleDuplicateLogin(id, s)
-		}
+		// 租约过期的服务器上的会话已经不存在了
+		h.dropDeadSessions(conn, sessions)
 
-		conn.SetAuthed()
+		// 判断是否重复登录, 如果同一设备重复登录或者违反了多设备登录策略，就让另一端下线
+		if old != nil && old != conn {
+			h.logger.Debug("duplicate login on device:", device)
+			_ = old.Kick(consts.CloseLoggedInElsewhere, LoggedInElsewhereReason)
+		}
+		h.handleDuplicateLogin(conn, sessions)
 
-		// 添加到manager中
-		chatserver.ClientManagerInstance.Add(id, conn)
+		// 用户之前没有任何会话, 通知好友上线
+		if len(sessions) == 0 {
+			go h.presenceHandler.Online(id)
+		}
+		// 推送当前在线的好友, 客户端不再需要查询
+		go h.presenceHandler.SyncFriends(conn)
 
 		return true
 	}
 
-	_ = conn.WriteControl(websocket.CloseMessage, UnauthorizedMessage, time.Now().Add(h.heartBeat))
+	_ = conn.WriteControl(websocket.CloseMessage, UnauthorizedMessage, chatserver.ControlDeadline())
 	return false
 }
 
@@ -103,22 +127,232 @@ func (h *AuthHandler) CheckAuthMiddleware(ctx *chatserver.Context) {
 	}
 }
 
-// TODO
-func (h *AuthHandler) handleDuplicateLogin(uid int64, serverId string) {
+const LoggedInElsewhereReason = "logged in elsewhere"
+
+// 多设备登录策略
+const (
+	SessionPolicyMulti    = "multi"
+	SessionPolicyPlatform = "platform"
+	SessionPolicySingle   = "single"
+)
+
+// token的来源
+const (
+	TokenFromHeader      = "header"
+	TokenFromSubprotocol = "subprotocol"
+	TokenFromTicket      = "ticket"
+	TokenFromCookie      = "cookie"
+)
+
+// 获取握手请求中的token, 浏览器不能设置authorization header, 可以使用下面几种方式:
+// 1. 子协议: Sec-WebSocket-Protocol: imchat.v2, token.<jwt>
+// 2. 票据: 从authserver获取一次性票据, 通过url参数ticket传入
+// 3. cookie: 登录时authserver设置的cookie, 需要配置允许的Origin防止跨站劫持
+func getToken(r *http.Request, redeemTicket func(ticket string) string) (token, source string) {
+	if token = r.Header.Get("authorization"); token != "" {
+		return token, TokenFromHeader
+	}
+
+	for _, protocol := range websocket.Subprotocols(r) {
+		if strings.HasPrefix(protocol, consts.TokenSubprotocolPrefix) {
+			return strings.TrimPrefix(protocol, consts.TokenSubprotocolPrefix), TokenFromSubprotocol
+		}
+	}
+
+	if ticket := r.URL.Query().Get("ticket"); ticket != "" {
+		return redeemTicket(ticket), TokenFromTicket
+	}
+
+	if cookie, err := r.Cookie(consts.TokenCookie); err == nil && cookie.Value != "" {
+		return cookie.Value, TokenFromCookie
+	}
+
+	return "", ""
+}
+
+// 使用票据换取token, 票据只能使用一次
+func (h *AuthHandler) redeemTicket(ticket string) string {
+	token, err := h.redis.GetDel(context.Background(), redisconsts.WsTicketKey+ticket).Result()
+	if err != nil {
+		if err != redis.Nil {
+			h.logger.Errorf("redeem ticket error:%v", err)
+		}
+		return ""
+	}
+
+	return token
+}
+
+// 从握手请求的header或者url参数中获取客户端平台和设备ID
+// 没有传入设备ID的客户端, 同一平台上视为同一个设备
+func getDeviceInfo(r *http.Request) (platform, device string) {
+	platform = r.Header.Get("platform")
+	if platform == "" {
+		platform = r.URL.Query().Get("platform")
+	}
+	device = r.Header.Get("device")
+	if device == "" {
+		device = r.URL.Query().Get("device")
+	}
+
+	platform = strings.ReplaceAll(strings.ToLower(platform), ":", "_")
+	if platform == "" {
+		platform = "unknown"
+	}
+	if device == "" {
+		device = "default"
+	}
 
+	return
+}
+
+// 保存本会话所在的服务器, 返回该用户在保存之前的所有会话 field -> serverId
+var registerSessionScript = redis.NewScript(`
+local all = redis.call('HGETALL', KEYS[1])
+redis.call('HSET', KEYS[1], ARGV[1], ARGV[2])
+return all
+`)
+
+func (h *AuthHandler) registerSession(conn *chatserver.Client) (map[string]string, error) {
+	res, err := registerSessionScript.Run(context.Background(), h.redis,
+		[]string{clientKey(conn.GetUid())}, sessionField(conn), h.serverId).StringSlice()
+	if err != nil && err != redis.Nil {
+		return nil, err
+	}
+
+	sessions := make(map[string]string, len(res)/2)
+	for i := 0; i+1 < len(res); i += 2 {
+		sessions[res[i]] = res[i+1]
+	}
+
+	return sessions, nil
+}
+
+// dropDeadSessions 删除在租约过期的服务器上的会话, 本设备的记录已经被覆盖了, 不需要删除
+func (h *AuthHandler) dropDeadSessions(conn *chatserver.Client, sessions map[string]string) {
+	self := sessionField(conn)
+	for field, serverId := range sessions {
+		if serverId == h.serverId || serverAlive(serverId) {
+			continue
+		}
+
+		delete(sessions, field)
+		if field == self {
+			continue
+		}
+		if _, err := delSession(h.redis, conn.GetUid(), field, serverId); err != nil {
+			h.logger.Errorf("del session error:%v", err)
+		}
+	}
+}
+
+// 根据多设备登录策略, 判断已有的会话是否需要下线
+func (h *AuthHandler) conflicted(conn *chatserver.Client, field string) bool {
+	if field == sessionField(conn) {
+		return true
+	}
+
+	switch h.policy {
+	case SessionPolicySingle:
+		return true
+	case SessionPolicyPlatform:
+		platform, _ := parseSessionField(field)
+		return platform == conn.GetPlatform()
+	}
+
+	return false
+}
+
+// handleDuplicateLogin 让冲突的会话下线
+// 1. 旧连接在本服务器上, 直接发送关闭帧并关闭连接
+// 2. 旧连接在其它服务器上, 通过该服务器的消息队列通知它将连接下线
+func (h *AuthHandler) handleDuplicateLogin(conn *chatserver.Client, sessions map[string]string) {
+	self := sessionField(conn)
+	for field, serverId := range sessions {
+		if !h.conflicted(conn, field) {
+			continue
+		}
+
+		h.logger.Debugf("duplicate login, uid:%d, session:%s, server:%s", conn.GetUid(), field, serverId)
+		platform, device := parseSessionField(field)
+
+		// 同一设备的记录已经被本会话覆盖了, 其它的需要删除
+		if field != self {
+			if _, err := delSession(h.redis, conn.GetUid(), field, serverId); err != nil {
+				h.logger.Errorf("del session error:%v", err)
+			}
+		}
+
+		if serverId == h.serverId {
+			old := chatserver.ClientManagerInstance.GetDevice(conn.GetUid(), platform, device)
+			if old != nil && old != conn {
+				_ = old.Kick(consts.CloseLoggedInElsewhere, LoggedInElsewhereReason)
+			}
+			continue
+		}
+
+		kick := &pb.KickOut{
+			Uid:       conn.GetUid(),
+			LoginTime: conn.CreateTime().UnixMicro(),
+			Reason:    LoggedInElsewhereReason,
+			Device:    device,
+			Platform:  platform,
+		}
+		data, err := chatserver.MarshalProtoMessage(consts.KickOutNotify, kick)
+		if err != nil {
+			h.logger.Errorf("marshal error:%v", err)
+			continue
+		}
+
+		err = mq.ProducerInstance.Publish(redisconsts.ServerConsumerKey+serverId, data)
+		if err != nil {
+			h.logger.Errorf("publish kick out error:%v", err)
+		}
+	}
+}
+
+// KickOut 收到其它服务器的下线通知, 将本服务器上的旧连接下线
+func (h *AuthHandler) KickOut(data []byte) error {
+	kick := new(pb.KickOut)
+	err := proto.Unmarshal(data[4:], kick)
+	if err != nil {
+		return err
+	}
+
+	client := chatserver.ClientManagerInstance.GetDevice(kick.Uid, kick.Platform, kick.Device)
+	if client == nil {
+		return nil
+	}
+
+	// 本服务器上的连接比发起下线的连接还要新, 不处理
+	if !client.CreateTime().Before(time.UnixMicro(kick.LoginTime)) {
+		return nil
+	}
+
+	return client.Kick(consts.CloseLoggedInElsewhere, kick.Reason)
 }
 
 func (h *AuthHandler) ClientCloseHandler(conn *chatserver.Client) {
-	// 将key从redis删除
 	val, exist := conn.Get("id")
 	if !exist {
 		return
 	}
 	id := val.(int64)
-	clientKey := redisconsts.ChatServerClientKey + strconv.Itoa(int(id))
-	h.redis.Del(context.Background(), clientKey)
 
-	// 将conn从manager中删除
-	chatserver.ClientManagerInstance.Del(id)
-}
+	// 将conn从manager中删除, 如果已经被新的连接替换了, 则不需要清理
+	if !chatserver.ClientManagerInstance.Remove(id, conn) {
+		return
+	}
 
+	// 将会话从redis删除
+	remain, err := delSession(h.redis, id, sessionField(conn), h.serverId)
+	if err != nil {
+		h.logger.Errorf("del client key error:%v", err)
+		return
+	}
+
+	// 用户的所有设备都下线了, 通知好友下线
+	if remain == 0 {
+		go h.presenceHandler.Offline(id)
+	}
+}
@@ -0,0 +1,52 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/mangohow/imchat/pkg/consts"
+)
+
+func TestGetToken(t *testing.T) {
+	redeem := func(ticket string) string {
+		if ticket == "valid" {
+			return "ticket-token"
+		}
+		return ""
+	}
+
+	cases := []struct {
+		name   string
+		setup  func(r *http.Request)
+		token  string
+		source string
+	}{
+		{"none", func(r *http.Request) {}, "", ""},
+		{"header", func(r *http.Request) {
+			r.Header.Set("authorization", "header-token")
+			r.AddCookie(&http.Cookie{Name: consts.TokenCookie, Value: "cookie-token"})
+		}, "header-token", TokenFromHeader},
+		{"subprotocol", func(r *http.Request) {
+			r.Header.Set("Sec-WebSocket-Protocol", consts.Subprotocol(consts.ProtocolV2)+", "+consts.TokenSubprotocolPrefix+"jwt-token")
+		}, "jwt-token", TokenFromSubprotocol},
+		{"ticket", func(r *http.Request) {
+			r.URL.RawQuery = "ticket=valid"
+		}, "ticket-token", TokenFromTicket},
+		{"invalid ticket", func(r *http.Request) {
+			r.URL.RawQuery = "ticket=invalid"
+		}, "", TokenFromTicket},
+		{"cookie", func(r *http.Request) {
+			r.AddCookie(&http.Cookie{Name: consts.TokenCookie, Value: "cookie-token"})
+		}, "cookie-token", TokenFromCookie},
+	}
+
+	for _, c := range cases {
+		r := httptest.NewRequest(http.MethodGet, "/ws/chat", nil)
+		c.setup(r)
+		token, source := getToken(r, redeem)
+		if token != c.token || source != c.source {
+			t.Fatalf("%s: expect (%q, %q), got (%q, %q)", c.name, c.token, c.source, token, source)
+		}
+	}
+}
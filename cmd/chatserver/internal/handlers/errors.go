@@ -0,0 +1,15 @@
+package handlers
+
+import (
+	"github.com/mangohow/imchat/cmd/chatserver/internal/chatserver"
+	"github.com/mangohow/imchat/pkg/consts"
+)
+
+// 处理器返回的错误, 会作为错误帧发送给客户端
+var (
+	ErrInvalidSender     = chatserver.NewError(consts.ErrCodeInvalidParam, "invalid sender")
+	ErrInvalidMessageSeq = chatserver.NewError(consts.ErrCodeInvalidParam, "invalid message seq")
+	ErrSendToSelf        = chatserver.NewError(consts.ErrCodeInvalidParam, "can not send to self")
+	ErrNotFriend         = chatserver.NewError(consts.ErrCodeNotFriend, "not friend")
+	ErrNotGroupMember    = chatserver.NewError(consts.ErrCodeNotGroupMember, "not group member")
+)
@@ -0,0 +1,207 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/mangohow/imchat/cmd/chatserver/internal/chatserver"
+	"github.com/mangohow/imchat/cmd/chatserver/internal/log"
+	"github.com/mangohow/imchat/cmd/chatserver/internal/mongodb/dao"
+	mysqldao "github.com/mangohow/imchat/cmd/chatserver/internal/mysqldb/dao"
+	"github.com/mangohow/imchat/cmd/chatserver/internal/rdsconn"
+	"github.com/mangohow/imchat/pkg/consts"
+	"github.com/mangohow/imchat/pkg/consts/redisconsts"
+	"github.com/mangohow/imchat/pkg/model"
+	"github.com/mangohow/imchat/pkg/utils"
+	"github.com/mangohow/imchat/proto/pb"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/protobuf/proto"
+)
+
+type GroupChatHandler struct {
+	logger     *logrus.Logger
+	redis      *redis.Client
+	messageDao *dao.GroupMessageDao
+	serverId   string
+	// 缓存中没有群成员时从数据库查询
+	findMembers func(groupId int64) ([]int64, error)
+}
+
+func NewGroupChatHandler(serverId string) *GroupChatHandler {
+	return &GroupChatHandler{
+		logger:      log.Logger(),
+		redis:       rdsconn.RedisConn(),
+		messageDao:  dao.NewGroupMessageDao("groupChat"),
+		serverId:    serverId,
+		findMembers: mysqldao.NewGroupDao().FindMemberIds,
+	}
+}
+
+// ForwardMessage 转发群消息
+// 1. 先将消息持久化
+// 2. 在同一服务器上的群成员设备(包括发送者的其它设备)，直接发送
+// 3. 在其它服务器上的群成员，按服务器分组，每台服务器只发送一次到其消息队列中
+//    由该服务器发送给它上面的群成员
+// 4. 不在线的群成员，上线后主动拉取群消息
+func (h *GroupChatHandler) ForwardMessage(ctx *chatserver.Context, req *pb.GroupChat) (*pb.ChatAck, error) {
+	members, err := h.checkUserParam(ctx, req)
+	if err != nil {
+		h.logger.Warningf("user req parm invalid:%v", err)
+		return nil, err
+	}
+
+	req.CreateTime = time.Now().UnixMicro()
+
+	// 1.先将消息持久化消息到数据库中
+	record := &model.GroupChatRecord{
+		Sender:      req.Sender,
+		GroupId:     req.Group,
+		Message:     req.Message,
+		CreateTime:  req.CreateTime,
+		MessageType: int32(req.MsgType),
+	}
+	objId, err := h.messageDao.PersistMessage(record)
+	if err != nil {
+		h.logger.Errorf("persist group message error:%v", err)
+		return nil, err
+	}
+	req.MessageId = objId.Hex()
+
+	ctx.SetRespId(consts.GroupChatAck)
+	ack := &pb.ChatAck{MessageSeq: req.MsgSeq, MessageId: req.MessageId}
+
+	// 生成转发数据
+	forwardData, err := proto.Marshal(req)
+	if err != nil {
+		h.logger.Errorf("marshal error:%v", err)
+		return nil, err
+	}
+
+	forwardbuf := bytes.NewBuffer(nil)
+	// 写入消息ID
+	forwardbuf.Write(ctx.Message.RawData[:4])
+	forwardbuf.Write(forwardData)
+
+	h.logger.Debugf("[sender]:%d, [group]:%d, [message]:%s",
+		req.Sender, req.Group, req.Message)
+
+	// 2.发送给同一服务器上的群成员
+	h.sendToLocalMembers(forwardbuf.Bytes(), ctx.Client, members)
+
+	// 3.发送到其它服务器的消息队列中
+	if err = h.sendToOtherServers(forwardbuf.Bytes(), members); err != nil {
+		h.logger.Errorf("send async error:%v", err)
+	}
+
+	return ack, nil
+}
+
+// 检查参数, 返回群成员ID
+func (h *GroupChatHandler) checkUserParam(ctx *chatserver.Context, req *pb.GroupChat) ([]int64, error) {
+	id, ok := ctx.GetInt64("id")
+	if !ok || req.Sender != id {
+		return nil, ErrInvalidSender
+	}
+
+	// 检查消息序列是否合法
+	if req.MsgSeq>>32 == 0 {
+		return nil, ErrInvalidMessageSeq
+	}
+
+	// 检查是否是群成员，如果不是则不允许发送
+	members, err := h.getMembers(req.Group)
+	if err != nil {
+		h.logger.Errorf("get group members error:%v", err)
+		return nil, err
+	}
+	for _, member := range members {
+		if member == id {
+			return members, nil
+		}
+	}
+
+	return nil, ErrNotGroupMember
+}
+
+// getMembers 先从缓存中查询群成员, 缓存过期或者被清理时从数据库查询并重新写入缓存
+func (h *GroupChatHandler) getMembers(groupId int64) ([]int64, error) {
+	key := redisconsts.GroupMembersKey + strconv.Itoa(int(groupId))
+	res, err := h.redis.SMembers(context.Background(), key).Result()
+	if err != nil {
+		return nil, err
+	}
+	if len(res) == 0 {
+		return h.loadMembers(key, groupId)
+	}
+
+	members := make([]int64, 0, len(res))
+	for i := range res {
+		id, err := strconv.ParseInt(res[i], 10, 64)
+		if err != nil {
+			continue
+		}
+		members = append(members, id)
+	}
+
+	return members, nil
+}
+
+func (h *GroupChatHandler) loadMembers(key string, groupId int64) ([]int64, error) {
+	members, err := h.findMembers(groupId)
+	if err != nil || len(members) == 0 {
+		return members, err
+	}
+
+	if err = h.redis.SAdd(context.Background(), key, utils.ToInterfaceSlice(members)...).Err(); err != nil {
+		h.logger.Errorf("cache group members error:%v", err)
+	}
+
+	return members, nil
+}
+
+// 发送给本服务器上的群成员, except为发送消息的连接
+func (h *GroupChatHandler) sendToLocalMembers(data []byte, except *chatserver.Client, members []int64) {
+	for _, member := range members {
+		writeToLocal(member, data, except)
+	}
+}
+
+// 查询群成员所在的服务器, 每台服务器只发送一次
+func (h *GroupChatHandler) sendToOtherServers(data []byte, members []int64) error {
+	if len(members) == 0 {
+		return nil
+	}
+
+	servers, err := getUserServers(h.redis, h.serverId, members...)
+	if err != nil {
+		return err
+	}
+
+	err = publishToServers(servers, data)
+	if err != nil {
+		h.logger.Errorf("publish message error:%v", err)
+	}
+
+	return nil
+}
+
+// SendMessage 从消息队列中读取到群消息后，发送给本服务器上的群成员
+func (h *GroupChatHandler) SendMessage(data []byte) error {
+	msg := new(pb.GroupChat)
+	err := proto.Unmarshal(data[4:], msg)
+	if err != nil {
+		return err
+	}
+
+	members, err := h.getMembers(msg.Group)
+	if err != nil {
+		return err
+	}
+
+	h.sendToLocalMembers(data, nil, members)
+
+	return nil
+}
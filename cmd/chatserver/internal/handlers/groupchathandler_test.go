@@ -0,0 +1,91 @@
+package handlers
+
+import (
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+	"github.com/mangohow/imchat/cmd/chatserver/internal/chatserver"
+	"github.com/mangohow/imchat/cmd/chatserver/internal/log"
+	"github.com/mangohow/imchat/pkg/consts"
+	"github.com/mangohow/imchat/proto/pb"
+)
+
+func newTestRedis(t *testing.T) (*miniredis.Miniredis, *redis.Client) {
+	s := miniredis.RunT(t)
+	rds := redis.NewClient(&redis.Options{Addr: s.Addr()})
+	t.Cleanup(func() {
+		_ = rds.Close()
+	})
+	return s, rds
+}
+
+// 缓存中没有群成员时从数据库查询, 并重新写入缓存
+func TestGroupMembersFallback(t *testing.T) {
+	s, rds := newTestRedis(t)
+	queries := 0
+	h := &GroupChatHandler{
+		logger: log.Logger(),
+		redis:  rds,
+		findMembers: func(groupId int64) ([]int64, error) {
+			queries++
+			return []int64{1, 2, 3}, nil
+		},
+	}
+
+	for i := 0; i < 2; i++ {
+		members, err := h.getMembers(7)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(members) != 3 {
+			t.Fatalf("expect 3 members, got %v", members)
+		}
+	}
+	if queries != 1 {
+		t.Fatalf("expect 1 database query, got %d", queries)
+	}
+	if ok, _ := s.SIsMember("group:members:7", "2"); !ok {
+		t.Fatal("members not cached")
+	}
+}
+
+// 从消息队列收到的群消息只发送给本服务器上的群成员
+func TestGroupSendMessage(t *testing.T) {
+	s, rds := newTestRedis(t)
+	if _, err := s.SAdd("group:members:8", "2001", "2002"); err != nil {
+		t.Fatal(err)
+	}
+	h := &GroupChatHandler{
+		logger: log.Logger(),
+		redis:  rds,
+		findMembers: func(groupId int64) ([]int64, error) {
+			t.Fatal("members should be read from cache")
+			return nil, nil
+		},
+	}
+
+	clients := make(map[int64]*chatserver.Client)
+	for _, uid := range []int64{2001, 2003} {
+		c := chatserver.NewClient(new(fakeTransport), nil)
+		c.Set("id", uid)
+		c.Set("device", "pc")
+		chatserver.ClientManagerInstance.Replace(uid, c)
+		clients[uid] = c
+	}
+	t.Cleanup(func() {
+		chatserver.ClientManagerInstance.Del(2001)
+		chatserver.ClientManagerInstance.Del(2003)
+	})
+
+	data, err := chatserver.MarshalProtoMessage(consts.GroupChatMessage, &pb.GroupChat{Sender: 2002, Group: 8})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = h.SendMessage(data); err != nil {
+		t.Fatal(err)
+	}
+	if clients[2001].QueueLen() != 1 || clients[2003].QueueLen() != 0 {
+		t.Fatalf("expect only member notified, member:%d other:%d", clients[2001].QueueLen(), clients[2003].QueueLen())
+	}
+}
@@ -0,0 +1,144 @@
+package handlers
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	"github.com/mangohow/imchat/cmd/chatserver/internal/chatserver"
+	"github.com/mangohow/imchat/cmd/chatserver/internal/log"
+	"github.com/mangohow/imchat/cmd/chatserver/internal/metrics"
+	"github.com/mangohow/imchat/cmd/chatserver/internal/mq"
+	"github.com/sirupsen/logrus"
+	"github.com/streadway/amqp"
+)
+
+// MQHandler 从本服务器的消息队列中读取其它服务器转发过来的数据
+// 数据格式与客户端的数据相同: 4字节消息ID + protobuf数据
+// 根据消息ID分发给注册的处理函数
+type MQHandler struct {
+	logger *logrus.Logger
+	handlers map[uint32]MQHandlerFunc
+	wg sync.WaitGroup
+}
+
+// MQHandlerFunc 处理转发过来的数据, data包含消息ID
+type MQHandlerFunc func(data []byte) error
+
+func NewMQHandler() *MQHandler {
+	return &MQHandler{
+		logger: log.Logger(),
+		handlers: make(map[uint32]MQHandlerFunc),
+	}
+}
+
+// Register 注册处理函数, 必须在Start之前调用
+func (h *MQHandler) Register(id uint32, handler MQHandlerFunc) {
+	if _, ok := h.handlers[id]; ok {
+		panic(fmt.Sprintf("duplicate mq handler for %d", id))
+	}
+	h.handlers[id] = handler
+}
+
+// Start 启动worker个goroutine从消息队列中读取数据
+func (h *MQHandler) Start(ctx context.Context, worker int) {
+	for i := 0; i < worker; i++ {
+		h.wg.Add(1)
+		go func() {
+			defer h.wg.Done()
+			h.consume(ctx)
+		}()
+	}
+}
+
+// MQStopTimeout 停止消费时等待正在处理的数据的最长时间
+const MQStopTimeout = time.Second * 5
+
+// Stop 停止从消息队列中读取数据, 等待已经收到的数据处理完成
+// 队列中剩余的数据留给本服务器重启后处理, 这些消息已经保存到数据库中, 客户端重连后也会拉取
+func (h *MQHandler) Stop() {
+	if err := mq.ConsumerInstance.Stop(); err != nil {
+		h.logger.Errorf("stop mq consumer error:%v", err)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		h.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(MQStopTimeout):
+		h.logger.Errorf("wait mq workers timeout")
+	}
+}
+
+func (h *MQHandler) consume(ctx context.Context) {
+	deliveries, announcements := mq.ConsumerInstance.DeliveryChan, mq.ConsumerInstance.AnnouncementChan
+	for deliveries != nil || announcements != nil {
+		var delivery amqp.Delivery
+		var ok bool
+		select {
+		case <-ctx.Done():
+			return
+		case delivery, ok = <- deliveries:
+			// 停止消费或者连接断开
+			if !ok {
+				deliveries = nil
+				continue
+			}
+		case delivery, ok = <- announcements:
+			if !ok {
+				announcements = nil
+				continue
+			}
+		}
+
+		msgId := mqMsgId(delivery.Body)
+		metrics.MQConsumed.WithLabelValues(msgId).Inc()
+		if err := h.handle(&delivery); err != nil {
+			metrics.MQConsumeErrors.WithLabelValues(msgId).Inc()
+			h.logger.Errorf("deliver message error:%v", err)
+		}
+
+		if err := delivery.Ack(false); err != nil {
+			h.logger.Errorf("mq ack error:%v", err)
+		}
+	}
+}
+
+var InvalidMQDataError = errors.New("invalid mq data")
+
+// 监控使用的消息ID标签, 数据是其它服务器发送的, 消息ID的数量是有限的
+func mqMsgId(data []byte) string {
+	if len(data) < chatserver.MessageTypeLen {
+		return metrics.Unknown
+	}
+	return metrics.MsgId(binary.LittleEndian.Uint32(data[:chatserver.MessageTypeLen]))
+}
+
+func (h *MQHandler) handle(delivery *amqp.Delivery) (err error) {
+	// 处理函数panic时不能导致服务崩溃
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("mq handler panic:%v\n%s", r, debug.Stack())
+		}
+	}()
+
+	data := delivery.Body
+	if len(data) < chatserver.MessageTypeLen {
+		return InvalidMQDataError
+	}
+
+	id := binary.LittleEndian.Uint32(data[:chatserver.MessageTypeLen])
+	handler, ok := h.handlers[id]
+	if !ok {
+		return fmt.Errorf("no mq handler for %d", id)
+	}
+
+	return handler(data)
+}
@@ -0,0 +1,429 @@
+package handlers
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/mangohow/imchat/cmd/chatserver/internal/chatserver"
+	"github.com/mangohow/imchat/cmd/chatserver/internal/log"
+	"github.com/mangohow/imchat/cmd/chatserver/internal/mq"
+	"github.com/mangohow/imchat/cmd/chatserver/internal/rdsconn"
+	"github.com/mangohow/imchat/pkg/consts/redisconsts"
+	"github.com/sirupsen/logrus"
+)
+
+/*
+	节点注册
+	1. 每台服务器在redis中保存带过期时间的租约 chat:node:<serverId>, 包括地址和负载, 每1/3有效期续期一次
+	2. 注册过的服务器ID保存在 chat:nodes 中, 用于发现租约已经过期的服务器
+	3. 路由到注册过但是租约过期的服务器的用户视为离线, 不再向该服务器的队列发送数据
+	   没有注册过的服务器(如滚动升级时还在运行的旧版本)视为存活
+	4. 存活的服务器通过锁选出一台回收宕机服务器的路由和队列, 队列中剩余的消息已经保存过, 用户上线后拉取离线消息
+	5. 服务器启动时如果上次运行还没有被回收, 先删除上次运行留下的路由, 关闭时删除租约, 由其它服务器回收
+	6. 续期时发现租约丢失, 只有本服务器的回收锁被其它服务器持有时才认为已经被回收
+	   redis重启、数据被清空、主从切换导致的租约丢失在续期时已经重新注册, 继续运行
+*/
+
+// NodeInfo 节点租约中的信息, load为连接数
+type NodeInfo struct {
+	ServerId   string `json:"serverId"`
+	Address    string `json:"address"`
+	Load       int64  `json:"load"`
+	Draining   bool   `json:"draining"`
+	UpdateTime int64  `json:"updateTime"`
+}
+
+type NodeRegistry struct {
+	logger          *logrus.Logger
+	redis           *redis.Client
+	server          *chatserver.ChatServer
+	serverId        string
+	address         string
+	ttl             time.Duration
+	presenceHandler IPresenceHandler
+
+	// 上次刷新时租约有效的其它服务器和注册过但是租约已经过期的服务器
+	mux   sync.RWMutex
+	nodes map[string]*NodeInfo
+	dead  map[string]struct{}
+
+	// 删除宕机服务器的消息队列, 返回丢弃的消息数
+	deleteQueue func(name string) (int, error)
+	// 租约丢失后还没有确认是否被回收, 下次续期时继续检查
+	leaseMissing bool
+
+	reclaiming atomic.Bool
+	cancel     context.CancelFunc
+	done       chan struct{}
+}
+
+// NewNodeRegistry address为建议客户端重连时使用的地址, presenceHandler用于回收路由时通知好友下线, 可以为nil
+func NewNodeRegistry(server *chatserver.ChatServer, address string, ttl time.Duration, presenceHandler IPresenceHandler) *NodeRegistry {
+	return &NodeRegistry{
+		logger:          log.Logger(),
+		redis:           rdsconn.RedisConn(),
+		server:          server,
+		serverId:        server.ServerId(),
+		address:         address,
+		ttl:             ttl,
+		presenceHandler: presenceHandler,
+		nodes:           make(map[string]*NodeInfo),
+		deleteQueue: func(name string) (int, error) {
+			return mq.ProducerInstance.DeleteQueue(name)
+		},
+	}
+}
+
+func nodeKey(serverId string) string {
+	return redisconsts.ChatServerNodeKey + serverId
+}
+
+// Start 删除本服务器上次运行留下的路由并注册租约, 需要在开始接收连接之前调用
+// 租约被其它服务器回收时调用onLost, 此时本服务器的路由和队列可能已经被删除了
+func (r *NodeRegistry) Start(onLost func()) error {
+	// 没有注册过或者已经被其它服务器回收了, 不会有上次运行留下的路由, 不需要扫描
+	registered, err := r.redis.SIsMember(context.Background(), redisconsts.ChatServerNodesKey, r.serverId).Result()
+	if err != nil {
+		return err
+	}
+	if registered {
+		n, err := r.reclaimRoutes(context.Background(), r.serverId)
+		if err != nil {
+			return err
+		}
+		if n > 0 {
+			r.logger.Infof("removed %d stale sessions of last run", n)
+		}
+	}
+
+	if existed, err := r.renew(); err != nil {
+		return err
+	} else if existed {
+		r.logger.Warnf("lease of server %s already exists, restarted too fast or duplicated server id", r.serverId)
+	}
+	r.refresh()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	r.cancel = cancel
+	r.done = make(chan struct{})
+	go r.loop(ctx, onLost)
+
+	return nil
+}
+
+// Stop 停止续期并删除租约, 需要在连接都断开之后调用
+func (r *NodeRegistry) Stop() {
+	if r.cancel == nil {
+		return
+	}
+	r.cancel()
+	<-r.done
+
+	if err := r.redis.Del(context.Background(), nodeKey(r.serverId)).Err(); err != nil {
+		r.logger.Errorf("delete lease error:%v", err)
+	}
+}
+
+func (r *NodeRegistry) loop(ctx context.Context, onLost func()) {
+	defer close(r.done)
+
+	ticker := time.NewTicker(r.ttl / 3)
+	defer ticker.Stop()
+	lost := false
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		reclaimed, err := r.checkLease()
+		if err != nil {
+			r.logger.Errorf("renew lease error:%v", err)
+		} else if reclaimed && !lost {
+			lost = true
+			r.logger.Errorf("server %s reclaimed by other server", r.serverId)
+			if onLost != nil {
+				go onLost()
+			}
+		}
+
+		r.reclaim(r.refresh())
+	}
+}
+
+// checkLease 续期租约, 返回本服务器是否已经被其它服务器回收
+// 租约丢失但是回收锁不存在时, 是redis重启、数据被清空等原因导致的, 续期时已经重新注册
+func (r *NodeRegistry) checkLease() (bool, error) {
+	existed, err := r.renew()
+	if err != nil {
+		return false, err
+	}
+	if existed && !r.leaseMissing {
+		return false, nil
+	}
+
+	// 查询失败时下次续期再检查
+	r.leaseMissing = true
+	holder, err := r.redis.Get(context.Background(), redisconsts.ChatServerReclaimKey+r.serverId).Result()
+	if err == redis.Nil {
+		r.leaseMissing = false
+		r.logger.Warnf("lease of server %s lost but not reclaimed, registered again", r.serverId)
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	r.leaseMissing = false
+
+	return holder != r.serverId, nil
+}
+
+// 续期租约, 返回续期之前租约是否存在
+var renewLeaseScript = redis.NewScript(`
+local existed = redis.call('EXISTS', KEYS[1])
+redis.call('HSET', KEYS[1], 'address', ARGV[1], 'load', ARGV[2], 'draining', ARGV[3], 'updateTime', ARGV[4])
+redis.call('PEXPIRE', KEYS[1], ARGV[5])
+redis.call('SADD', KEYS[2], ARGV[6])
+return existed
+`)
+
+func (r *NodeRegistry) renew() (bool, error) {
+	draining := "0"
+	if r.server.Draining() {
+		draining = "1"
+	}
+	existed, err := renewLeaseScript.Run(context.Background(), r.redis,
+		[]string{nodeKey(r.serverId), redisconsts.ChatServerNodesKey},
+		r.address, r.server.Connections(), draining, time.Now().UnixMilli(), r.ttl.Milliseconds(), r.serverId).Int64()
+	if err != nil {
+		return false, err
+	}
+	return existed == 1, nil
+}
+
+// refresh 读取所有服务器的租约, 返回租约已经过期的服务器
+func (r *NodeRegistry) refresh() []string {
+	ctx := context.Background()
+	members, err := r.redis.SMembers(ctx, redisconsts.ChatServerNodesKey).Result()
+	if err != nil {
+		r.logger.Errorf("get nodes error:%v", err)
+		return nil
+	}
+
+	pip := r.redis.Pipeline()
+	cmds := make(map[string]*redis.StringStringMapCmd, len(members))
+	for _, serverId := range members {
+		if serverId != r.serverId {
+			cmds[serverId] = pip.HGetAll(ctx, nodeKey(serverId))
+		}
+	}
+	if len(cmds) > 0 {
+		if _, err = pip.Exec(ctx); err != nil && err != redis.Nil {
+			r.logger.Errorf("get leases error:%v", err)
+			return nil
+		}
+	}
+
+	nodes := make(map[string]*NodeInfo, len(cmds))
+	deadSet := make(map[string]struct{})
+	var dead []string
+	for serverId, cmd := range cmds {
+		lease := cmd.Val()
+		if len(lease) == 0 {
+			dead = append(dead, serverId)
+			deadSet[serverId] = struct{}{}
+			continue
+		}
+		load, _ := strconv.ParseInt(lease["load"], 10, 64)
+		updateTime, _ := strconv.ParseInt(lease["updateTime"], 10, 64)
+		nodes[serverId] = &NodeInfo{
+			ServerId:   serverId,
+			Address:    lease["address"],
+			Load:       load,
+			Draining:   lease["draining"] == "1",
+			UpdateTime: updateTime,
+		}
+	}
+
+	r.mux.Lock()
+	r.nodes = nodes
+	r.dead = deadSet
+	r.mux.Unlock()
+
+	return dead
+}
+
+// Alive 服务器是否存活, 只使用上次刷新的结果, 发送每条消息时调用, 不查询redis
+// 只有上次刷新时注册过并且租约过期的服务器才视为宕机
+// 没有注册过的服务器是不支持租约的旧版本, 上次刷新之后才启动的服务器还不在注册表中, 都视为存活
+func (r *NodeRegistry) Alive(serverId string) bool {
+	if serverId == r.serverId {
+		return true
+	}
+	r.mux.RLock()
+	_, dead := r.dead[serverId]
+	r.mux.RUnlock()
+
+	return !dead
+}
+
+// Nodes 租约有效的其它服务器
+func (r *NodeRegistry) Nodes() []*NodeInfo {
+	r.mux.RLock()
+	defer r.mux.RUnlock()
+	nodes := make([]*NodeInfo, 0, len(r.nodes))
+	for _, node := range r.nodes {
+		nodes = append(nodes, node)
+	}
+	return nodes
+}
+
+// Suggest 从负载最低的一半服务器中选择一台建议客户端重连, 同一用户的所有设备选择同一台服务器
+// 不会选择正在排空的服务器, 没有可选的服务器时返回空
+func (r *NodeRegistry) Suggest(c *chatserver.Client) string {
+	nodes := make([]*NodeInfo, 0)
+	for _, node := range r.Nodes() {
+		if !node.Draining && node.Address != "" {
+			nodes = append(nodes, node)
+		}
+	}
+	if len(nodes) == 0 {
+		return ""
+	}
+
+	sort.Slice(nodes, func(i, j int) bool {
+		if nodes[i].Load != nodes[j].Load {
+			return nodes[i].Load < nodes[j].Load
+		}
+		return nodes[i].ServerId < nodes[j].ServerId
+	})
+	nodes = nodes[:(len(nodes)+1)/2]
+
+	return nodes[uint64(c.GetUid())%uint64(len(nodes))].Address
+}
+
+// reclaim 回收租约过期的服务器, 同一时间只有一个回收任务, 不阻塞续期
+func (r *NodeRegistry) reclaim(dead []string) {
+	if len(dead) == 0 || !r.reclaiming.CompareAndSwap(false, true) {
+		return
+	}
+
+	go func() {
+		defer r.reclaiming.Store(false)
+		for _, serverId := range dead {
+			ok, err := r.redis.SetNX(context.Background(), redisconsts.ChatServerReclaimKey+serverId,
+				r.serverId, redisconsts.NodeReclaimLockDuration).Result()
+			if err != nil {
+				r.logger.Errorf("lock reclaim error:%v", err)
+				continue
+			}
+			if ok {
+				r.reclaimNode(serverId)
+			}
+		}
+	}()
+}
+
+// reclaimNode 删除宕机服务器的路由和队列, 并从注册表中移除
+// 每一步之前都检查租约, 服务器重新启动后不再回收, 队列有消费者时也不会被删除
+func (r *NodeRegistry) reclaimNode(serverId string) {
+	ctx := context.Background()
+	alive := func() bool {
+		n, err := r.redis.Exists(ctx, nodeKey(serverId)).Result()
+		if err != nil {
+			r.logger.Errorf("check lease error:%v", err)
+			return true
+		}
+		return n > 0
+	}
+	if alive() {
+		// 还没有回收任何数据, 释放锁, 否则该服务器续期时会认为已经被回收了
+		if err := r.redis.Del(ctx, redisconsts.ChatServerReclaimKey+serverId).Err(); err != nil {
+			r.logger.Errorf("release reclaim lock error:%v", err)
+		}
+		return
+	}
+
+	r.logger.Infof("reclaim server %s", serverId)
+	n, err := r.reclaimRoutes(ctx, serverId)
+	if err != nil {
+		r.logger.Errorf("reclaim routes of %s error:%v", serverId, err)
+		return
+	}
+	if alive() {
+		return
+	}
+
+	dropped, err := r.deleteQueue(redisconsts.ServerConsumerKey + serverId)
+	if err != nil {
+		r.logger.Errorf("delete queue of %s error:%v", serverId, err)
+		return
+	}
+	if alive() {
+		return
+	}
+
+	if err = r.redis.SRem(ctx, redisconsts.ChatServerNodesKey, serverId).Err(); err != nil {
+		r.logger.Errorf("remove node %s error:%v", serverId, err)
+		return
+	}
+	r.logger.Infof("server %s reclaimed, sessions:%d, dropped messages:%d", serverId, n, dropped)
+}
+
+// reclaimRoutes 扫描所有用户的路由, 删除指向该服务器的会话, 返回删除的会话数
+// 用户的所有设备都下线时通知好友下线
+func (r *NodeRegistry) reclaimRoutes(ctx context.Context, serverId string) (int, error) {
+	total := 0
+	var cursor uint64
+	for {
+		keys, next, err := r.redis.Scan(ctx, cursor, redisconsts.ChatServerClientKey+"*", nodeScanCount).Result()
+		if err != nil {
+			return total, err
+		}
+
+		pip := r.redis.Pipeline()
+		cmds := make([]*redis.StringStringMapCmd, len(keys))
+		for i, key := range keys {
+			cmds[i] = pip.HGetAll(ctx, key)
+		}
+		if len(keys) > 0 {
+			if _, err = pip.Exec(ctx); err != nil && err != redis.Nil {
+				return total, err
+			}
+		}
+
+		for i, cmd := range cmds {
+			uid, err := strconv.ParseInt(strings.TrimPrefix(keys[i], redisconsts.ChatServerClientKey), 10, 64)
+			if err != nil {
+				continue
+			}
+			for field, id := range cmd.Val() {
+				if id != serverId {
+					continue
+				}
+				remain, err := delSession(r.redis, uid, field, serverId)
+				if err != nil {
+					return total, err
+				}
+				if remain < 0 {
+					continue
+				}
+				total++
+				if remain == 0 && r.presenceHandler != nil {
+					r.presenceHandler.Offline(uid)
+				}
+			}
+		}
+
+		if cursor = next; cursor == 0 {
+			return total, nil
+		}
+	}
+}
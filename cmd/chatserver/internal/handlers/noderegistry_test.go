@@ -0,0 +1,180 @@
+package handlers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/mangohow/imchat/cmd/chatserver/internal/chatserver"
+	"github.com/mangohow/imchat/cmd/chatserver/internal/log"
+	"github.com/mangohow/imchat/pkg/consts/redisconsts"
+)
+
+func TestSuggest(t *testing.T) {
+	r := &NodeRegistry{serverId: "self", nodes: map[string]*NodeInfo{
+		"a": {ServerId: "a", Address: "10.0.0.1:8080", Load: 10},
+		"b": {ServerId: "b", Address: "10.0.0.2:8080", Load: 500},
+		"c": {ServerId: "c", Address: "10.0.0.3:8080", Load: 20},
+		"d": {ServerId: "d", Address: "10.0.0.4:8080", Load: 1, Draining: true},
+	}}
+
+	// 负载最低的一半: a, c
+	got := make(map[string]bool)
+	for uid := int64(1); uid <= 10; uid++ {
+		c := chatserver.NewClient(new(fakeTransport), nil)
+		c.Set("id", uid)
+		got[r.Suggest(c)] = true
+	}
+	if len(got) != 2 || !got["10.0.0.1:8080"] || !got["10.0.0.3:8080"] {
+		t.Fatalf("expect least loaded nodes, got %v", got)
+	}
+
+	if node := (&NodeRegistry{}).Suggest(chatserver.NewClient(new(fakeTransport), nil)); node != "" {
+		t.Fatalf("expect no node, got %s", node)
+	}
+}
+
+func TestFilterAlive(t *testing.T) {
+	SetNodeRegistry(&NodeRegistry{serverId: "self", nodes: map[string]*NodeInfo{"a": {ServerId: "a"}}})
+	t.Cleanup(func() {
+		SetNodeRegistry(nil)
+	})
+
+	servers := map[string]struct{}{"self": {}, "a": {}}
+	filterAlive(servers)
+	if len(servers) != 2 {
+		t.Fatalf("expect alive servers kept, got %v", servers)
+	}
+}
+
+func newTestRegistry(rds *redis.Client, serverId string) *NodeRegistry {
+	return &NodeRegistry{
+		logger:   log.Logger(),
+		redis:    rds,
+		server:   new(chatserver.ChatServer),
+		serverId: serverId,
+		address:  "127.0.0.1:8080",
+		ttl:      time.Second * 3,
+		nodes:    make(map[string]*NodeInfo),
+		deleteQueue: func(name string) (int, error) {
+			return 0, nil
+		},
+	}
+}
+
+// 租约过期但是没有被回收时重新注册, 被其它服务器回收时才需要关闭
+func TestNodeRegistryLeaseLost(t *testing.T) {
+	s, rds := newTestRedis(t)
+	r := newTestRegistry(rds, "self")
+
+	if reclaimed, err := r.checkLease(); err != nil || reclaimed {
+		t.Fatalf("first registration: reclaimed:%v err:%v", reclaimed, err)
+	}
+
+	// 模拟redis重启导致租约丢失
+	s.FastForward(r.ttl * 2)
+	if s.Exists(nodeKey("self")) {
+		t.Fatalf("lease should expire")
+	}
+	if reclaimed, err := r.checkLease(); err != nil || reclaimed {
+		t.Fatalf("lease lost without reclaim should not shut down, reclaimed:%v err:%v", reclaimed, err)
+	}
+	if !s.Exists(nodeKey("self")) {
+		t.Fatalf("lease should be registered again")
+	}
+
+	// 其它服务器持有回收锁
+	s.FastForward(r.ttl * 2)
+	s.Set(redisconsts.ChatServerReclaimKey+"self", "other")
+	if reclaimed, err := r.checkLease(); err != nil || !reclaimed {
+		t.Fatalf("expect reclaimed, reclaimed:%v err:%v", reclaimed, err)
+	}
+}
+
+func TestNodeRegistryReclaim(t *testing.T) {
+	s, rds := newTestRedis(t)
+	r := newTestRegistry(rds, "self")
+	var deleted []string
+	r.deleteQueue = func(name string) (int, error) {
+		deleted = append(deleted, name)
+		return 1, nil
+	}
+
+	s.SAdd(redisconsts.ChatServerNodesKey, "self", "dead")
+	s.HSet(clientKey(1), "pc:1", "dead", "phone:2", "live")
+	s.HSet(clientKey(2), "pc:1", "dead")
+	// 旧版本的服务器不注册租约
+	s.HSet(clientKey(3), "pc:1", "legacy")
+
+	if err := r.Start(nil); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(r.Stop)
+
+	if r.Alive("dead") {
+		t.Fatalf("registered server without lease should be dead")
+	}
+	if !r.Alive("legacy") {
+		t.Fatalf("unregistered server should be treated as alive")
+	}
+
+	// 刷新之后才启动的服务器在下次刷新之前视为存活, 之后租约过期的在下次刷新时视为宕机
+	other := newTestRegistry(rds, "other")
+	if _, err := other.checkLease(); err != nil {
+		t.Fatal(err)
+	}
+	if !r.Alive("other") {
+		t.Fatalf("server started after refresh should be alive")
+	}
+	s.Del(nodeKey("other"))
+	if !r.Alive("other") {
+		t.Fatalf("alive should only use the last refresh")
+	}
+	r.refresh()
+	if r.Alive("other") {
+		t.Fatalf("expired server should be dead after refresh")
+	}
+	s.SRem(redisconsts.ChatServerNodesKey, "other")
+
+	dead := r.refresh()
+	if len(dead) != 1 || dead[0] != "dead" {
+		t.Fatalf("expect dead server, got %v", dead)
+	}
+	if err := rds.SetNX(context.Background(), redisconsts.ChatServerReclaimKey+"dead", "self", time.Minute).Err(); err != nil {
+		t.Fatal(err)
+	}
+	r.reclaimNode("dead")
+
+	if s.HGet(clientKey(1), "pc:1") != "" || s.HGet(clientKey(1), "phone:2") != "live" {
+		t.Fatalf("only sessions of dead server should be removed")
+	}
+	if s.Exists(clientKey(2)) {
+		t.Fatalf("user without sessions should be removed")
+	}
+	if s.HGet(clientKey(3), "pc:1") != "legacy" {
+		t.Fatalf("sessions of unregistered server should be kept")
+	}
+	if len(deleted) != 1 || deleted[0] != redisconsts.ServerConsumerKey+"dead" {
+		t.Fatalf("expect queue of dead server deleted, got %v", deleted)
+	}
+	if ok, _ := s.SIsMember(redisconsts.ChatServerNodesKey, "dead"); ok {
+		t.Fatalf("dead server should be removed from nodes")
+	}
+}
+
+// 回收之前服务器重新注册了, 释放回收锁, 不会导致该服务器关闭
+func TestNodeRegistryReclaimAlive(t *testing.T) {
+	s, rds := newTestRedis(t)
+	r := newTestRegistry(rds, "self")
+	other := newTestRegistry(rds, "other")
+	if _, err := other.checkLease(); err != nil {
+		t.Fatal(err)
+	}
+
+	s.Set(redisconsts.ChatServerReclaimKey+"other", "self")
+	r.reclaimNode("other")
+	if s.Exists(redisconsts.ChatServerReclaimKey + "other") {
+		t.Fatalf("reclaim lock should be released")
+	}
+}
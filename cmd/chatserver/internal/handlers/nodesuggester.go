@@ -0,0 +1,30 @@
+package handlers
+
+import (
+	"github.com/mangohow/imchat/cmd/chatserver/internal/chatserver"
+)
+
+// NodeSuggester 关闭服务器时, 从配置的服务器列表中选择一台建议客户端重连
+// 同一用户的所有设备选择同一台服务器
+type NodeSuggester struct {
+	nodes []string
+}
+
+// NewNodeSuggester self为本服务器的地址, 不会被选择
+func NewNodeSuggester(nodes []string, self string) *NodeSuggester {
+	s := &NodeSuggester{}
+	for _, node := range nodes {
+		if node != "" && node != self {
+			s.nodes = append(s.nodes, node)
+		}
+	}
+	return s
+}
+
+// Suggest 没有可选的服务器时返回空, 由客户端自己选择
+func (s *NodeSuggester) Suggest(c *chatserver.Client) string {
+	if len(s.nodes) == 0 {
+		return ""
+	}
+	return s.nodes[uint64(c.GetUid())%uint64(len(s.nodes))]
+}
@@ -0,0 +1,212 @@
+package handlers
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/mangohow/imchat/cmd/chatserver/internal/chatserver"
+	"github.com/mangohow/imchat/cmd/chatserver/internal/log"
+	"github.com/mangohow/imchat/cmd/chatserver/internal/mysqldb/dao"
+	"github.com/mangohow/imchat/cmd/chatserver/internal/rdsconn"
+	"github.com/mangohow/imchat/pkg/consts"
+	"github.com/mangohow/imchat/pkg/consts/redisconsts"
+	"github.com/mangohow/imchat/pkg/utils"
+	"github.com/mangohow/imchat/proto/pb"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/protobuf/proto"
+)
+
+type IPresenceHandler interface {
+	// Online 用户的第一个设备上线
+	Online(uid int64)
+
+	// Offline 用户的最后一个设备下线
+	Offline(uid int64)
+
+	// SyncFriends 连接认证成功后, 推送当前在线的好友
+	SyncFriends(conn *chatserver.Client)
+}
+
+// PresenceHandler 用户上线/下线时, 主动推送给在线的好友, 客户端不再需要轮询好友在线状态
+// 登录时推送一次当前在线的好友, 之后只推送状态变化
+type PresenceHandler struct {
+	logger   *logrus.Logger
+	redis    *redis.Client
+	serverId string
+	// 缓存中没有好友列表时从数据库查询
+	findFriends func(uid int64) ([]int64, error)
+}
+
+func NewPresenceHandler(serverId string) *PresenceHandler {
+	return &PresenceHandler{
+		logger:      log.Logger(),
+		redis:       rdsconn.RedisConn(),
+		serverId:    serverId,
+		findFriends: dao.NewFriendDao().FindFriendIds,
+	}
+}
+
+func (h *PresenceHandler) Online(uid int64) {
+	h.push(uid, true)
+}
+
+func (h *PresenceHandler) Offline(uid int64) {
+	h.push(uid, false)
+}
+
+// push 推送状态给好友
+// 1. 在本服务器上的好友, 直接发送
+// 2. 在其它服务器上的好友, 每台服务器只发送一次, 由该服务器发送给它上面的好友
+func (h *PresenceHandler) push(uid int64, online bool) {
+	presence := &pb.Presence{
+		Uid:    uid,
+		Online: online,
+		Time:   time.Now().UnixMicro(),
+	}
+	data, err := chatserver.MarshalProtoMessage(consts.FriendPresence, presence)
+	if err != nil {
+		h.logger.Errorf("marshal error:%v", err)
+		return
+	}
+
+	friends, err := h.getFriends(uid)
+	if err != nil {
+		h.logger.Errorf("get friends error:%v", err)
+		return
+	}
+	if len(friends) == 0 {
+		return
+	}
+
+	h.sendToLocalFriends(data, friends)
+
+	servers, err := getUserServers(h.redis, h.serverId, friends...)
+	if err != nil {
+		h.logger.Errorf("get client error:%v", err)
+		return
+	}
+	if err = publishToServers(servers, data); err != nil {
+		h.logger.Errorf("publish presence error:%v", err)
+	}
+}
+
+// getFriends 先从缓存中查询好友, 缓存过期后从数据库查询并重新写入缓存
+func (h *PresenceHandler) getFriends(uid int64) ([]int64, error) {
+	key := redisconsts.FriendsKey + strconv.Itoa(int(uid))
+	res, err := h.redis.SMembers(context.Background(), key).Result()
+	if err != nil {
+		return nil, err
+	}
+	if len(res) == 0 {
+		return h.loadFriends(key, uid)
+	}
+
+	friends := make([]int64, 0, len(res))
+	for i := range res {
+		id, err := strconv.ParseInt(res[i], 10, 64)
+		if err != nil {
+			continue
+		}
+		friends = append(friends, id)
+	}
+
+	return friends, nil
+}
+
+func (h *PresenceHandler) loadFriends(key string, uid int64) ([]int64, error) {
+	friends, err := h.findFriends(uid)
+	if err != nil || len(friends) == 0 {
+		return friends, err
+	}
+
+	pip := h.redis.Pipeline()
+	pip.SAdd(context.Background(), key, utils.ToInterfaceSlice(friends)...)
+	pip.Expire(context.Background(), key, redisconsts.DefaultCacheDuration)
+	if _, err = pip.Exec(context.Background()); err != nil {
+		h.logger.Errorf("cache friends error:%v", err)
+	}
+
+	return friends, nil
+}
+
+func (h *PresenceHandler) SyncFriends(conn *chatserver.Client) {
+	friends, err := h.getFriends(conn.GetUid())
+	if err != nil {
+		h.logger.Errorf("get friends error:%v", err)
+		return
+	}
+	online, err := h.onlineUsers(friends)
+	if err != nil {
+		h.logger.Errorf("get online friends error:%v", err)
+		return
+	}
+
+	now := time.Now().UnixMicro()
+	for _, friend := range online {
+		data, err := chatserver.MarshalProtoMessage(consts.FriendPresence, &pb.Presence{
+			Uid:      friend,
+			Online:   true,
+			Time:     now,
+			Snapshot: true,
+		})
+		if err != nil {
+			h.logger.Errorf("marshal error:%v", err)
+			return
+		}
+		conn.Write(data)
+	}
+}
+
+// onlineUsers 返回有会话的用户, 只在租约过期的服务器上有会话的用户视为离线
+func (h *PresenceHandler) onlineUsers(uids []int64) ([]int64, error) {
+	if len(uids) == 0 {
+		return nil, nil
+	}
+
+	pip := h.redis.Pipeline()
+	cmds := make([]*redis.StringSliceCmd, len(uids))
+	for i := range uids {
+		cmds[i] = pip.HVals(context.Background(), clientKey(uids[i]))
+	}
+	if _, err := pip.Exec(context.Background()); err != nil && err != redis.Nil {
+		return nil, err
+	}
+
+	online := make([]int64, 0)
+	for i, cmd := range cmds {
+		for _, serverId := range cmd.Val() {
+			if serverAlive(serverId) {
+				online = append(online, uids[i])
+				break
+			}
+		}
+	}
+
+	return online, nil
+}
+
+func (h *PresenceHandler) sendToLocalFriends(data []byte, friends []int64) {
+	for _, friend := range friends {
+		writeToLocal(friend, data, nil)
+	}
+}
+
+// SendPresence 从消息队列中读取到状态变化后，发送给本服务器上的好友
+func (h *PresenceHandler) SendPresence(data []byte) error {
+	presence := new(pb.Presence)
+	err := proto.Unmarshal(data[4:], presence)
+	if err != nil {
+		return err
+	}
+
+	friends, err := h.getFriends(presence.Uid)
+	if err != nil {
+		return err
+	}
+
+	h.sendToLocalFriends(data, friends)
+
+	return nil
+}
@@ -0,0 +1,50 @@
+package handlers
+
+import (
+	"testing"
+
+	"github.com/mangohow/imchat/cmd/chatserver/internal/chatserver"
+	"github.com/mangohow/imchat/cmd/chatserver/internal/log"
+)
+
+// 好友缓存过期后从数据库查询, 登录时只推送在存活的服务器上有会话的好友
+func TestSyncFriends(t *testing.T) {
+	s, rds := newTestRedis(t)
+	SetNodeRegistry(&NodeRegistry{logger: log.Logger(), redis: rds, serverId: "self", nodes: map[string]*NodeInfo{}})
+	t.Cleanup(func() {
+		SetNodeRegistry(nil)
+	})
+	s.HSet("chat:client:11", "web:pc", "self")
+	s.HSet("chat:client:13", "ios:phone", "dead")
+	// 注册过但是租约已经过期
+	s.SAdd("chat:nodes", "dead")
+	nodeRegistry.refresh()
+
+	queries := 0
+	h := &PresenceHandler{
+		logger:   log.Logger(),
+		redis:    rds,
+		serverId: "self",
+		findFriends: func(uid int64) ([]int64, error) {
+			queries++
+			return []int64{11, 12, 13}, nil
+		},
+	}
+
+	c := chatserver.NewClient(new(fakeTransport), nil)
+	c.Set("id", int64(10))
+	h.SyncFriends(c)
+	if n := c.QueueLen(); n != 1 {
+		t.Fatalf("expect 1 online friend, got %d", n)
+	}
+
+	if _, err := h.getFriends(10); err != nil {
+		t.Fatal(err)
+	}
+	if queries != 1 {
+		t.Fatalf("expect 1 database query, got %d", queries)
+	}
+	if s.TTL("friends:id:10") <= 0 {
+		t.Fatal("friends should be cached with expiration")
+	}
+}
@@ -0,0 +1,191 @@
+package handlers
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/mangohow/imchat/cmd/chatserver/internal/chatserver"
+	"github.com/mangohow/imchat/cmd/chatserver/internal/log"
+	"github.com/mangohow/imchat/cmd/chatserver/internal/rdsconn"
+	"github.com/mangohow/imchat/pkg/common/xconfig"
+	"github.com/mangohow/imchat/pkg/consts"
+	"github.com/mangohow/imchat/pkg/consts/redisconsts"
+	"github.com/sirupsen/logrus"
+)
+
+// 令牌桶, 多个key都有令牌时才消耗令牌
+// KEYS: 令牌桶的key  ARGV: 每个key的rate和burst, 最后一个为当前毫秒时间戳
+var tokenBucketScript = redis.NewScript(`
+local now = tonumber(ARGV[#ARGV])
+local tokens = {}
+for i = 1, #KEYS do
+	local rate = tonumber(ARGV[i * 2 - 1])
+	local burst = tonumber(ARGV[i * 2])
+	local v = redis.call('HMGET', KEYS[i], 'tokens', 'ts')
+	local t = tonumber(v[1])
+	local ts = tonumber(v[2])
+	if t == nil then
+		t = burst
+		ts = now
+	end
+	t = math.min(burst, t + math.max(0, now - ts) * rate / 1000)
+	if t < 1 then
+		return 0
+	end
+	tokens[i] = t
+end
+for i = 1, #KEYS do
+	local rate = tonumber(ARGV[i * 2 - 1])
+	local burst = tonumber(ARGV[i * 2])
+	redis.call('HSET', KEYS[i], 'tokens', tokens[i] - 1, 'ts', now)
+	redis.call('PEXPIRE', KEYS[i], math.ceil(burst / rate * 1000) + 1000)
+end
+return 1
+`)
+
+// 客户端超过限制的次数, 保存在Client中
+type rateLimitViolation struct {
+	count int
+	start time.Time
+}
+
+// 不受默认规则限制的消息, 需要时可以单独配置规则
+// ack被限制后服务端收不到确认, 会不停地通知客户端拉取消息
+var defaultRuleExempt = map[uint32]struct{}{
+	consts.SingleChatAck: {},
+	consts.GroupChatAck:  {},
+}
+
+const (
+	rateLimitViolationKey = "rateLimitViolation"
+
+	RateLimitedReason = "rate limited"
+)
+
+// RateLimiter 请求频率限制中间件, 按消息ID配置规则, 分别按用户ID和IP限制
+// 令牌桶保存在redis中, 多个节点共享
+// 超过限制时返回错误帧, 在一段时间内多次超过限制则断开连接
+type RateLimiter struct {
+	logger *logrus.Logger
+	redis  *redis.Client
+
+	rules       map[uint32]xconfig.RateLimitRule
+	defaultRule *xconfig.RateLimitRule
+
+	maxViolations   int
+	violationWindow time.Duration
+	// 保护保存在Client中的rateLimitViolation
+	violationLock sync.Mutex
+}
+
+func NewRateLimiter(conf *xconfig.RateLimitConfig) *RateLimiter {
+	l := &RateLimiter{
+		logger:          log.Logger(),
+		redis:           rdsconn.RedisConn(),
+		rules:           make(map[uint32]xconfig.RateLimitRule),
+		maxViolations:   conf.MaxViolations,
+		violationWindow: conf.ViolationWindow,
+	}
+
+	for i := range conf.Rules {
+		rule := conf.Rules[i]
+		if rule.MsgId == 0 {
+			l.defaultRule = &rule
+			continue
+		}
+		l.rules[rule.MsgId] = rule
+	}
+
+	return l
+}
+
+func (l *RateLimiter) rule(msgId uint32) (xconfig.RateLimitRule, bool) {
+	if rule, ok := l.rules[msgId]; ok {
+		return rule, true
+	}
+	if _, ok := defaultRuleExempt[msgId]; ok {
+		return xconfig.RateLimitRule{}, false
+	}
+	if l.defaultRule != nil {
+		return *l.defaultRule, true
+	}
+	return xconfig.RateLimitRule{}, false
+}
+
+// Middleware 需要在权限验证之后使用, 以获取用户ID
+func (l *RateLimiter) Middleware(ctx *chatserver.Context) {
+	msgId := ctx.Message.MsgId
+	rule, ok := l.rule(msgId)
+	if !ok {
+		return
+	}
+
+	prefix := redisconsts.RateLimitKey + strconv.Itoa(int(msgId))
+	keys := make([]string, 0, 2)
+	args := make([]interface{}, 0, 5)
+	if uid := ctx.GetUid(); uid != 0 && rule.Rate > 0 {
+		keys = append(keys, prefix+":uid:"+strconv.Itoa(int(uid)))
+		args = append(args, rule.Rate, rule.Burst)
+	}
+	if rule.IpRate > 0 {
+		host, _, err := net.SplitHostPort(ctx.RemoteAddr())
+		if err == nil {
+			keys = append(keys, prefix+":ip:"+host)
+			args = append(args, rule.IpRate, rule.IpBurst)
+		}
+	}
+	if len(keys) == 0 {
+		return
+	}
+	args = append(args, time.Now().UnixMilli())
+
+	allowed, err := tokenBucketScript.Run(context.Background(), l.redis, keys, args...).Int()
+	if err != nil {
+		// redis出错时不限制
+		l.logger.Errorf("rate limit error:%v", err)
+		return
+	}
+	if allowed == 1 {
+		return
+	}
+
+	ctx.Abort()
+	l.logger.Infof("rate limited, uid:%d, ip:%s, msgId:%d", ctx.GetUid(), ctx.RemoteAddr(), msgId)
+
+	if l.abused(ctx.Client) {
+		_ = ctx.Kick(consts.CloseRateLimited, RateLimitedReason)
+		return
+	}
+
+	_ = ctx.WriteError(consts.ErrCodeRateLimited, RateLimitedReason)
+}
+
+// 记录超过限制的次数, 返回是否需要断开连接
+// 处理器可能在多个goroutine中并发执行, 需要加锁
+func (l *RateLimiter) abused(c *chatserver.Client) bool {
+	if l.maxViolations <= 0 {
+		return false
+	}
+
+	l.violationLock.Lock()
+	defer l.violationLock.Unlock()
+	now := time.Now()
+	val, ok := c.Get(rateLimitViolationKey)
+	if !ok {
+		c.Set(rateLimitViolationKey, &rateLimitViolation{count: 1, start: now})
+		return l.maxViolations <= 1
+	}
+
+	v := val.(*rateLimitViolation)
+	if now.Sub(v.start) > l.violationWindow {
+		v.count = 0
+		v.start = now
+	}
+	v.count++
+
+	return v.count >= l.maxViolations
+}
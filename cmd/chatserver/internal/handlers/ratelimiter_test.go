@@ -0,0 +1,60 @@
+package handlers
+
+import (
+	"context"
+	"testing"
+
+	"github.com/mangohow/imchat/pkg/common/xconfig"
+	"github.com/mangohow/imchat/pkg/consts"
+)
+
+func TestTokenBucketScript(t *testing.T) {
+	_, rds := newTestRedis(t)
+	run := func(keys []string, args ...interface{}) int {
+		allowed, err := tokenBucketScript.Run(context.Background(), rds, keys, args...).Int()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return allowed
+	}
+
+	const now = 1000000
+	// 每秒1个令牌, 容量为2
+	for i := 0; i < 2; i++ {
+		if run([]string{"uid"}, 1, 2, now) != 1 {
+			t.Fatalf("request %d should be allowed", i)
+		}
+	}
+	if run([]string{"uid"}, 1, 2, now) != 0 {
+		t.Fatalf("bucket should be empty")
+	}
+	// 1秒后产生一个令牌
+	if run([]string{"uid"}, 1, 2, now+1000) != 1 {
+		t.Fatalf("token should be refilled")
+	}
+
+	// 一个key没有令牌时, 其它key的令牌也不会被消耗
+	if run([]string{"uid", "ip"}, 1, 2, 1, 1, now+1000) != 0 {
+		t.Fatalf("request should be limited by uid")
+	}
+	if run([]string{"ip"}, 1, 1, now+1000) != 1 {
+		t.Fatalf("ip token should not be consumed")
+	}
+}
+
+func TestRateLimiterDefaultRuleExempt(t *testing.T) {
+	l := &RateLimiter{
+		rules:       map[uint32]xconfig.RateLimitRule{consts.GroupChatAck: {MsgId: consts.GroupChatAck, Rate: 1}},
+		defaultRule: &xconfig.RateLimitRule{Rate: 20},
+	}
+
+	if _, ok := l.rule(consts.SingleChatAck); ok {
+		t.Fatalf("ack should not be limited by the default rule")
+	}
+	if rule, ok := l.rule(consts.GroupChatAck); !ok || rule.Rate != 1 {
+		t.Fatalf("explicit rule should still apply to ack")
+	}
+	if rule, ok := l.rule(consts.TypingMessage); !ok || rule.Rate != 20 {
+		t.Fatalf("default rule should apply to other messages")
+	}
+}
@@ -0,0 +1,134 @@
+package handlers
+
+import (
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/mangohow/imchat/cmd/chatserver/internal/chatserver"
+	"github.com/mangohow/imchat/cmd/chatserver/internal/log"
+	"github.com/mangohow/imchat/cmd/chatserver/internal/mongodb/dao"
+	"github.com/mangohow/imchat/cmd/chatserver/internal/rdsconn"
+	"github.com/mangohow/imchat/pkg/consts"
+	"github.com/mangohow/imchat/proto/pb"
+	"github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"google.golang.org/protobuf/proto"
+)
+
+// 撤回消息的结果
+const (
+	RecallOk = iota
+	RecallNotAllowed
+	RecallTimeout
+	RecallFailed
+)
+
+type RecallHandler struct {
+	logger     *logrus.Logger
+	redis      *redis.Client
+	messageDao *dao.MessageDao
+	serverId   string
+	// 发送后可以撤回的时间
+	window time.Duration
+}
+
+func NewRecallHandler(serverId string, window time.Duration) *RecallHandler {
+	return &RecallHandler{
+		logger:     log.Logger(),
+		redis:      rdsconn.RedisConn(),
+		messageDao: dao.NewMessageDao("singleChat"),
+		serverId:   serverId,
+		window:     window,
+	}
+}
+
+// RecallMessage 撤回消息
+// 1. 只有消息的发送者可以撤回, 并且只能撤回撤回时间内的消息
+// 2. 将mongo中的消息设置为已撤回
+// 3. 撤回通知的路由方式和消息相同, 发送给接收者的所有设备, 以及发送者的其它设备
+//    不在线的设备, 拉取消息时会得到已撤回的记录
+func (h *RecallHandler) RecallMessage(ctx *chatserver.Context, req *pb.Recall) *pb.RecallAck {
+	ctx.SetRespId(consts.RecallAck)
+	ack := &pb.RecallAck{MessageId: req.MessageId}
+
+	id, err := primitive.ObjectIDFromHex(req.MessageId)
+	if err != nil {
+		ack.Code = RecallNotAllowed
+		return ack
+	}
+
+	uid := ctx.GetUid()
+	record, err := h.messageDao.FindMessage(id)
+	if err != nil {
+		h.logger.Errorf("find message error:%v", err)
+		ack.Code = RecallFailed
+		return ack
+	}
+	if record == nil || record.Sender != uid {
+		ack.Code = RecallNotAllowed
+		return ack
+	}
+
+	now := time.Now()
+	after := now.Add(-h.window).UnixMicro()
+	if record.CreateTime < after {
+		ack.Code = RecallTimeout
+		return ack
+	}
+
+	// 已经撤回过的消息, 直接返回成功
+	if record.Recalled {
+		return ack
+	}
+
+	ok, err := h.messageDao.RecallMessage(id, uid, after, now.UnixMicro())
+	if err != nil {
+		h.logger.Errorf("recall message error:%v", err)
+		ack.Code = RecallFailed
+		return ack
+	}
+	if !ok {
+		ack.Code = RecallTimeout
+		return ack
+	}
+
+	notice := &pb.Recall{
+		MessageId:  req.MessageId,
+		Sender:     record.Sender,
+		Receiver:   record.Receiver,
+		RecallTime: now.UnixMicro(),
+	}
+	data, err := chatserver.MarshalProtoMessage(consts.RecallMessage, notice)
+	if err != nil {
+		h.logger.Errorf("marshal error:%v", err)
+		return ack
+	}
+
+	writeToLocal(notice.Receiver, data, nil)
+	writeToLocal(notice.Sender, data, ctx.Client)
+
+	servers, err := getUserServers(h.redis, h.serverId, notice.Receiver, notice.Sender)
+	if err != nil {
+		h.logger.Errorf("get client error:%v", err)
+		return ack
+	}
+	if err = publishToServers(servers, data); err != nil {
+		h.logger.Errorf("publish recall error:%v", err)
+	}
+
+	return ack
+}
+
+// SendRecall 从消息队列中读取到撤回通知后，发送给本服务器上的接收者和发送者的设备
+func (h *RecallHandler) SendRecall(data []byte) error {
+	notice := new(pb.Recall)
+	err := proto.Unmarshal(data[4:], notice)
+	if err != nil {
+		return err
+	}
+
+	writeToLocal(notice.Receiver, data, nil)
+	writeToLocal(notice.Sender, data, nil)
+
+	return nil
+}
@@ -7,6 +7,7 @@ import (
 	"time"
 
 	"github.com/mangohow/imchat/cmd/chatserver/internal/chatserver"
+	"github.com/mangohow/imchat/cmd/chatserver/internal/metrics"
 	"github.com/mangohow/imchat/pkg/common/commutil"
 	"github.com/mangohow/imchat/pkg/consts"
 )
@@ -88,6 +89,12 @@ func NewRetryHandler(ctx context.Context, worker int, maxRetry int8) IRetryHandl
 
 	handler.cond.L = &handler.hlock
 
+	metrics.GaugeFunc("retry_heap_size", "Users waiting in the retry heap.", func() float64 {
+		handler.hlock.Lock()
+		defer handler.hlock.Unlock()
+		return float64(handler.heap.Len())
+	})
+
 	go handler.handleRetry()
 	for i := 0; i < worker; i++ {
 		go handler.retryWorker()
@@ -167,6 +174,7 @@ func (r *RetryHandler) handleRetry() {
 
 func (r *RetryHandler) retry(item *RetryItem) {
 	r.ch <- item.id
+	metrics.Retries.Inc()
 	// 超过最大重试次数
 	if item.retried + 1 >= r.maxRetry {
 		r.items.Del(item.id)
@@ -187,11 +195,9 @@ func (r *RetryHandler) retryWorker() {
 		case <- r.ctx.Done():
 			return
 		case id := <- r.ch:
-			target := chatserver.ClientManagerInstance.Get(id)
-			if target == nil {
-				return
+			for _, target := range chatserver.ClientManagerInstance.Get(id) {
+				target.WriteData(consts.NewMessage, nil)
 			}
-			target.WriteData(consts.NewMessage, nil)
 		}
 	}
 }
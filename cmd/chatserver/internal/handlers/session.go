@@ -0,0 +1,116 @@
+package handlers
+
+import (
+	"context"
+	"strconv"
+	"strings"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/mangohow/imchat/cmd/chatserver/internal/chatserver"
+	"github.com/mangohow/imchat/cmd/chatserver/internal/mq"
+	"github.com/mangohow/imchat/pkg/consts/redisconsts"
+)
+
+// 用户的会话(路由)信息保存在redis的hash中
+// key: chat:client:<uid>  field: <platform>:<device>  value: serverId
+// 用户的所有设备都下线后key会被删除
+
+func clientKey(uid int64) string {
+	return redisconsts.ChatServerClientKey + strconv.Itoa(int(uid))
+}
+
+func sessionField(c *chatserver.Client) string {
+	return c.DeviceKey()
+}
+
+func parseSessionField(field string) (platform, device string) {
+	platform, device, _ = strings.Cut(field, ":")
+	return
+}
+
+// 只有当field的值为指定的服务器ID时才删除, 防止删除掉同一设备在其它服务器上新登录的记录
+// 删除成功时返回该用户剩余的会话数, 否则返回-1
+var delSessionScript = redis.NewScript(`
+if redis.call('HGET', KEYS[1], ARGV[1]) == ARGV[2] then
+	redis.call('HDEL', KEYS[1], ARGV[1])
+	return redis.call('HLEN', KEYS[1])
+end
+return -1
+`)
+
+func delSession(rds *redis.Client, uid int64, field, serverId string) (int64, error) {
+	remain, err := delSessionScript.Run(context.Background(), rds, []string{clientKey(uid)}, field, serverId).Int64()
+	if err == redis.Nil {
+		return -1, nil
+	}
+	return remain, err
+}
+
+// 节点注册表, 为nil时不检查服务器是否存活
+var nodeRegistry *NodeRegistry
+
+// SetNodeRegistry 设置节点注册表, 之后查询路由时会跳过租约过期的服务器
+func SetNodeRegistry(r *NodeRegistry) {
+	nodeRegistry = r
+}
+
+func serverAlive(serverId string) bool {
+	return nodeRegistry == nil || nodeRegistry.Alive(serverId)
+}
+
+// filterAlive 删除租约过期的服务器, 这些服务器上的用户视为离线
+func filterAlive(servers map[string]struct{}) {
+	for serverId := range servers {
+		if !serverAlive(serverId) {
+			delete(servers, serverId)
+		}
+	}
+}
+
+// getUserServers 查询用户所在的服务器, 不包括本服务器和租约过期的服务器
+func getUserServers(rds *redis.Client, selfId string, uids ...int64) (map[string]struct{}, error) {
+	pip := rds.Pipeline()
+	cmds := make([]*redis.StringSliceCmd, len(uids))
+	for i := range uids {
+		cmds[i] = pip.HVals(context.Background(), clientKey(uids[i]))
+	}
+	_, err := pip.Exec(context.Background())
+	if err != nil && err != redis.Nil {
+		return nil, err
+	}
+
+	servers := make(map[string]struct{})
+	for _, cmd := range cmds {
+		for _, serverId := range cmd.Val() {
+			if serverId != "" && serverId != selfId {
+				servers[serverId] = struct{}{}
+			}
+		}
+	}
+	filterAlive(servers)
+
+	return servers, nil
+}
+
+// publishToServers 发送到其它服务器的消息队列中, 每台服务器只发送一次
+func publishToServers(servers map[string]struct{}, data []byte) (err error) {
+	for serverId := range servers {
+		if e := mq.ProducerInstance.Publish(redisconsts.ServerConsumerKey+serverId, data); e != nil {
+			err = e
+		}
+	}
+	return
+}
+
+// writeToLocal 发送给用户在本服务器上的所有设备, except不为nil时跳过该连接, 返回发送的连接数
+func writeToLocal(uid int64, data []byte, except *chatserver.Client) int {
+	n := 0
+	for _, c := range chatserver.ClientManagerInstance.Get(uid) {
+		if c == except {
+			continue
+		}
+		c.Write(data)
+		n++
+	}
+	return n
+}
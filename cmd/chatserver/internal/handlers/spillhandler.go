@@ -0,0 +1,133 @@
+package handlers
+
+import (
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/mangohow/imchat/cmd/chatserver/internal/chatserver"
+	"github.com/mangohow/imchat/pkg/common/xframe"
+	"github.com/mangohow/imchat/pkg/consts"
+)
+
+// SpillHandler 写队列满了之后, 数据不会再发送给客户端, 只处理发生了丢弃的这一个连接
+// 聊天消息以及撤回、编辑、已读回执在转发之前已经保存到mongo中了, 相当于已经保存到了离线存储中
+// 只需要等写队列空闲后通知这个连接主动拉取, 被丢弃的NewMessage本身就是通知, 同样只记录下来
+// ack没有保存, 缓存起来等写队列空闲后重新发送, 否则发送者会认为消息发送失败
+// 输入状态、上线通知等临时消息直接丢弃
+// 写队列一直没有空闲时按照退避时间重试, 超过最大重试次数后断开连接, 客户端重连后拉取离线消息
+type SpillHandler struct {
+	maxRetry int
+	// 第一次重试的等待时间, 之后每次翻倍
+	backoff time.Duration
+
+	mu     sync.Mutex
+	states map[*chatserver.Client]*spillState
+}
+
+// 一个连接被丢弃的数据
+type spillState struct {
+	// 需要通知客户端拉取离线消息
+	notify bool
+	// 等待重新发送的ack
+	acks    [][]byte
+	retried int
+}
+
+const (
+	MinSpillBackoff = time.Second
+	// 每个连接最多缓存的ack数量, 超过后断开连接
+	MaxSpilledAcks = 256
+)
+
+func NewSpillHandler(maxRetry int) *SpillHandler {
+	return &SpillHandler{
+		maxRetry: maxRetry,
+		backoff:  MinSpillBackoff,
+		states:   make(map[*chatserver.Client]*spillState),
+	}
+}
+
+func (h *SpillHandler) Spill(c *chatserver.Client, messageType int, data []byte) {
+	// 只有帧数据需要处理, 关闭帧等控制数据直接丢弃
+	if messageType != websocket.BinaryMessage {
+		return
+	}
+	msgId, err := xframe.PeekMsgId(data)
+	if err != nil {
+		return
+	}
+
+	ack := false
+	switch msgId {
+	case consts.SingleChatMessage, consts.GroupChatMessage, consts.RecallMessage,
+		consts.EditMessage, consts.ReadReceipt, consts.NewMessage:
+	case consts.SingleChatAck, consts.GroupChatAck, consts.RecallAck, consts.EditAck:
+		ack = true
+	default:
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	state, ok := h.states[c]
+	if !ok {
+		state = &spillState{}
+		h.states[c] = state
+		h.schedule(c, state)
+	}
+	if !ack {
+		state.notify = true
+		return
+	}
+	if len(state.acks) >= MaxSpilledAcks {
+		delete(h.states, c)
+		c.DisconnectSlowConsumer()
+		return
+	}
+	state.acks = append(state.acks, data)
+}
+
+// 调用时需要持有锁
+func (h *SpillHandler) schedule(c *chatserver.Client, state *spillState) {
+	time.AfterFunc(h.backoff<<state.retried, func() {
+		h.flush(c, state)
+	})
+}
+
+// 写队列空闲后重新发送ack并通知客户端拉取离线消息
+func (h *SpillHandler) flush(c *chatserver.Client, state *spillState) {
+	h.mu.Lock()
+	if h.states[c] != state {
+		h.mu.Unlock()
+		return
+	}
+	// 连接已经关闭或者被新的连接替换了, 新的连接登录时会拉取离线消息
+	if chatserver.ClientManagerInstance.GetDevice(c.GetUid(), c.GetPlatform(), c.GetDevice()) != c {
+		delete(h.states, c)
+		h.mu.Unlock()
+		return
+	}
+	if c.Congested() {
+		state.retried++
+		if state.retried >= h.maxRetry {
+			delete(h.states, c)
+			h.mu.Unlock()
+			c.DisconnectSlowConsumer()
+			return
+		}
+		h.schedule(c, state)
+		h.mu.Unlock()
+		return
+	}
+	delete(h.states, c)
+	h.mu.Unlock()
+
+	// 写入时可能再次调用Spill, 不能持有锁
+	for _, ack := range state.acks {
+		c.Write(ack)
+	}
+	if state.notify {
+		c.WriteData(consts.NewMessage, nil)
+	}
+}
@@ -0,0 +1,130 @@
+package handlers
+
+import (
+	"encoding/binary"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/mangohow/imchat/cmd/chatserver/internal/chatserver"
+	"github.com/mangohow/imchat/pkg/common/xframe"
+	"github.com/mangohow/imchat/pkg/consts"
+)
+
+func spillFrame(msgId uint32) []byte {
+	data := make([]byte, chatserver.MessageTypeLen)
+	binary.LittleEndian.PutUint32(data, msgId)
+	return data
+}
+
+func spillFrameV1(msgId uint32) []byte {
+	return xframe.Encode(xframe.Header{Version: xframe.Version1, MsgId: msgId, RequestId: 7}, nil)
+}
+
+func newSpillClients(t *testing.T, uid int64, devices ...string) map[string]*chatserver.Client {
+	clients := make(map[string]*chatserver.Client)
+	transports := make(map[string]*fakeTransport)
+	for _, device := range devices {
+		transports[device] = new(fakeTransport)
+		c := chatserver.NewClient(transports[device], nil)
+		c.Set("id", uid)
+		c.Set("device", device)
+		chatserver.ClientManagerInstance.Replace(uid, c)
+		clients[device] = c
+	}
+	t.Cleanup(func() {
+		chatserver.ClientManagerInstance.Del(uid)
+	})
+	return clients
+}
+
+func TestSpillRedeliversToStalledConnection(t *testing.T) {
+	clients := newSpillClients(t, 2001, "phone", "pc")
+	phone, pc := clients["phone"], clients["pc"]
+
+	h := NewSpillHandler(3)
+	h.backoff = time.Hour
+	h.Spill(phone, websocket.BinaryMessage, spillFrame(consts.SingleChatMessage))
+	// 被丢弃的NewMessage只记录下来, 不会产生新的通知
+	h.Spill(phone, websocket.BinaryMessage, spillFrame(consts.NewMessage))
+	h.Spill(phone, websocket.BinaryMessage, spillFrame(consts.SingleChatAck))
+	h.Spill(phone, websocket.BinaryMessage, spillFrame(consts.TypingMessage))
+
+	state := h.states[phone]
+	if state == nil || !state.notify || len(state.acks) != 1 {
+		t.Fatalf("unexpected spill state %+v", state)
+	}
+
+	h.flush(phone, state)
+	if phone.QueueLen() != 2 {
+		t.Fatalf("expect ack and one NewMessage, got %d", phone.QueueLen())
+	}
+	if pc.QueueLen() != 0 {
+		t.Fatalf("other devices should not be notified, got %d", pc.QueueLen())
+	}
+	if len(h.states) != 0 {
+		t.Fatalf("state should be removed after flush")
+	}
+}
+
+func TestSpillDisconnectsCongestedConnection(t *testing.T) {
+	const uid = 2002
+	transport := new(fakeTransport)
+	c := chatserver.NewClient(transport, nil)
+	c.Set("id", int64(uid))
+	chatserver.ClientManagerInstance.Replace(uid, c)
+	t.Cleanup(func() {
+		chatserver.ClientManagerInstance.Del(uid)
+	})
+	for !c.Congested() {
+		c.WriteData(consts.HelloReply, nil)
+	}
+	queued := c.QueueLen()
+
+	h := NewSpillHandler(3)
+	h.backoff = time.Hour
+	h.Spill(c, websocket.BinaryMessage, spillFrame(consts.GroupChatMessage))
+	state := h.states[c]
+	for i := 0; i < 3; i++ {
+		h.flush(c, state)
+	}
+	if c.QueueLen() != queued {
+		t.Fatalf("nothing should be written while congested")
+	}
+	if len(h.states) != 0 {
+		t.Fatalf("state should be removed after disconnect")
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for !transport.closed && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if !transport.closed {
+		t.Fatalf("congested connection should be disconnected")
+	}
+}
+
+// V1帧按帧头读取消息ID, 关闭帧等非帧数据不处理
+func TestSpillFrameVersions(t *testing.T) {
+	clients := newSpillClients(t, 2003, "phone")
+	phone := clients["phone"]
+
+	h := NewSpillHandler(3)
+	h.backoff = time.Hour
+	h.Spill(phone, websocket.TextMessage, []byte(`{"id":10000}`))
+	h.Spill(phone, websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseServiceRestart, "restart"))
+	if len(h.states) != 0 {
+		t.Fatalf("non binary data should be skipped")
+	}
+
+	ack := spillFrameV1(consts.SingleChatAck)
+	h.Spill(phone, websocket.BinaryMessage, ack)
+	h.Spill(phone, websocket.BinaryMessage, spillFrameV1(consts.ReadReceipt))
+	state := h.states[phone]
+	if state == nil || !state.notify || len(state.acks) != 1 {
+		t.Fatalf("unexpected spill state %+v", state)
+	}
+	if id, _ := xframe.PeekMsgId(state.acks[0]); id != consts.SingleChatAck {
+		t.Fatalf("expect spilled ack kept as is, got msgId %d", id)
+	}
+}
@@ -0,0 +1,154 @@
+package handlers
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/mangohow/imchat/cmd/chatserver/internal/chatserver"
+	"github.com/mangohow/imchat/cmd/chatserver/internal/log"
+	"github.com/mangohow/imchat/cmd/chatserver/internal/rdsconn"
+	"github.com/mangohow/imchat/pkg/consts/redisconsts"
+	"github.com/mangohow/imchat/proto/pb"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	// 同一发送者给不同接收者发送正在输入的最小间隔
+	TypingMinInterval = time.Millisecond * 200
+	// 发给同一接收者的正在输入, 在该时间内只转发一次
+	TypingRepeatInterval = time.Second * 3
+)
+
+type typingState struct {
+	receiver int64
+	typing   bool
+	time     time.Time
+}
+
+// TypingHandler 转发正在输入/停止输入的状态
+// 路由方式和UserChatHandler.ForwardMessage相同, 但是状态是临时的:
+// 不保存到数据库, 不加入重试队列, 对方不在线就直接丢弃
+// 每个发送者都会限流, 防止客户端频繁发送
+type TypingHandler struct {
+	logger   *logrus.Logger
+	redis    *redis.Client
+	serverId string
+
+	mux    sync.Mutex
+	states map[int64]*typingState
+}
+
+func NewTypingHandler(ctx context.Context, serverId string) *TypingHandler {
+	h := &TypingHandler{
+		logger:   log.Logger(),
+		redis:    rdsconn.RedisConn(),
+		serverId: serverId,
+		states:   make(map[int64]*typingState),
+	}
+
+	go h.cleanup(ctx)
+
+	return h
+}
+
+// ForwardTyping 转发输入状态
+// 1. 接收者在同一服务器上的设备，直接发送
+// 2. 在其它服务器上的, 发送到对应服务器的消息队列中
+func (h *TypingHandler) ForwardTyping(ctx *chatserver.Context, req *pb.Typing) error {
+	id, ok := ctx.GetInt64("id")
+	if !ok || req.Sender != id {
+		return ErrInvalidSender
+	}
+	if req.Sender == req.Receiver {
+		return ErrSendToSelf
+	}
+
+	// 检查是否是它的联系人
+	isMember, _ := h.redis.SIsMember(context.Background(), redisconsts.FriendsKey+strconv.Itoa(int(id)), req.Receiver).Result()
+	if !isMember {
+		return ErrNotFriend
+	}
+
+	// 超过频率限制的直接丢弃
+	if !h.allow(req.Sender, req.Receiver, req.Typing) {
+		return nil
+	}
+
+	data := ctx.Message.RawData
+
+	writeToLocal(req.Receiver, data, nil)
+
+	servers, err := getUserServers(h.redis, h.serverId, req.Receiver)
+	if err != nil {
+		h.logger.Errorf("get client error:%v", err)
+		return nil
+	}
+	if err = publishToServers(servers, data); err != nil {
+		h.logger.Errorf("publish typing error:%v", err)
+	}
+
+	return nil
+}
+
+// 限流, 返回是否允许转发
+// 状态变化(包括停止输入)总是转发, 否则对方会一直显示正在输入, 只限制重复的正在输入
+func (h *TypingHandler) allow(sender, receiver int64, typing bool) bool {
+	now := time.Now()
+
+	h.mux.Lock()
+	defer h.mux.Unlock()
+
+	last := h.states[sender]
+	if typing && last != nil {
+		elapsed := now.Sub(last.time)
+		if last.receiver == receiver {
+			if last.typing && elapsed < TypingRepeatInterval {
+				return false
+			}
+		} else if elapsed < TypingMinInterval {
+			return false
+		}
+	}
+
+	h.states[sender] = &typingState{receiver: receiver, typing: typing, time: now}
+
+	return true
+}
+
+// 定时清理过期的限流状态
+func (h *TypingHandler) cleanup(ctx context.Context) {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			now := time.Now()
+			h.mux.Lock()
+			for sender, state := range h.states {
+				if now.Sub(state.time) >= TypingRepeatInterval {
+					delete(h.states, sender)
+				}
+			}
+			h.mux.Unlock()
+		}
+	}
+}
+
+// SendTyping 从消息队列中读取到输入状态后，发送给本服务器上的接收者
+func (h *TypingHandler) SendTyping(data []byte) error {
+	msg := new(pb.Typing)
+	err := proto.Unmarshal(data[4:], msg)
+	if err != nil {
+		return err
+	}
+
+	writeToLocal(msg.Receiver, data, nil)
+
+	return nil
+}
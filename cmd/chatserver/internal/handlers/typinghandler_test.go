@@ -0,0 +1,49 @@
+package handlers
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTypingRateLimit(t *testing.T) {
+	h := &TypingHandler{states: make(map[int64]*typingState)}
+
+	if !h.allow(1, 2, true) {
+		t.Fatal("first typing should be allowed")
+	}
+	// 重复的正在输入在重复间隔内只转发一次
+	if h.allow(1, 2, true) {
+		t.Fatal("expect repeated typing to be limited")
+	}
+	// 停止输入总是转发, 即使间隔很短
+	if !h.allow(1, 2, false) {
+		t.Fatal("stop typing should always be allowed")
+	}
+	if !h.allow(1, 2, true) {
+		t.Fatal("state change should be allowed")
+	}
+	if !h.allow(1, 2, false) {
+		t.Fatal("stop typing should always be allowed")
+	}
+
+	// 超过重复间隔后可以再次转发正在输入
+	h.allow(1, 2, true)
+	h.states[1].time = time.Now().Add(-TypingRepeatInterval)
+	if !h.allow(1, 2, true) {
+		t.Fatal("typing should be allowed after repeat interval")
+	}
+
+	// 快速切换接收者时限流
+	if h.allow(1, 3, true) {
+		t.Fatal("expect typing to another receiver to be limited by min interval")
+	}
+	h.states[1].time = time.Now().Add(-TypingMinInterval)
+	if !h.allow(1, 3, true) {
+		t.Fatal("typing to another receiver should be allowed")
+	}
+
+	// 其它发送者不受影响
+	if !h.allow(2, 1, true) {
+		t.Fatal("other sender should not be limited")
+	}
+}
@@ -10,13 +10,12 @@ import (
 	"github.com/mangohow/imchat/cmd/chatserver/internal/chatserver"
 	"github.com/mangohow/imchat/cmd/chatserver/internal/log"
 	"github.com/mangohow/imchat/cmd/chatserver/internal/mongodb/dao"
-	"github.com/mangohow/imchat/cmd/chatserver/internal/mq"
 	"github.com/mangohow/imchat/cmd/chatserver/internal/rdsconn"
+	"github.com/mangohow/imchat/pkg/consts"
 	"github.com/mangohow/imchat/pkg/consts/redisconsts"
 	"github.com/mangohow/imchat/pkg/model"
 	"github.com/mangohow/imchat/proto/pb"
 	"github.com/sirupsen/logrus"
-	"github.com/streadway/amqp"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"google.golang.org/protobuf/proto"
 )
@@ -26,33 +25,29 @@ type UserChatHandler struct {
 	redis *redis.Client
 	messageDao *dao.MessageDao
 	retryHandler IRetryHandler
+	serverId string
 }
 
-func NewUserChatHandler(ctx context.Context, worker int, retryHandler IRetryHandler) *UserChatHandler {
-	h := &UserChatHandler{
+func NewUserChatHandler(serverId string, retryHandler IRetryHandler) *UserChatHandler {
+	return &UserChatHandler{
 		logger: log.Logger(),
 		redis: rdsconn.RedisConn(),
 		messageDao: dao.NewMessageDao("singleChat"),
 		retryHandler: retryHandler,
+		serverId: serverId,
 	}
-
-	for i := 0; i < worker; i++ {
-		go h.forwardMessage(ctx)
-	}
-
-	return h
 }
 
 // ForwardMessage 转发用户消息
-// 1. 如果Receiver在线
-// 1.1 如果Receiver在同一服务器上，直接发送
-// 1.2 否则，发送到消息队列中
-// 2. 如果Receiver不在线，发送到messageServer的消息队列中
-func (h *UserChatHandler) ForwardMessage(ctx *chatserver.Context, req *pb.SingleChat) *pb.ChatAck {
+// 消息会发送给Receiver的所有设备, 同时同步给Sender的其它设备
+// 1. 如果在线的设备在同一服务器上，直接发送
+// 2. 在其它服务器上的, 发送到对应服务器的消息队列中
+// 3. 如果Receiver不在线，待用户上线后主动拉取离线消息
+func (h *UserChatHandler) ForwardMessage(ctx *chatserver.Context, req *pb.SingleChat) (*pb.ChatAck, error) {
 	// 检查参数合法性
-	if !h.checkUserParam(ctx, req) {
-		h.logger.Warning("user req parm invalid")
-		return nil
+	if err := h.checkUserParam(ctx, req); err != nil {
+		h.logger.Warningf("user req parm invalid:%v", err)
+		return nil, err
 	}
 
 	// createTime 保存毫秒时间戳
@@ -70,18 +65,19 @@ func (h *UserChatHandler) ForwardMessage(ctx *chatserver.Context, req *pb.Single
 	objId, err := h.messageDao.PersistUnreadMessage(record)
 	if err != nil {
 		h.logger.Errorf("persist message error:%v", err)
-		return nil
+		return nil, err
 	}
 	req.MessageId = objId.Hex()
 
 	// 回复
+	ctx.SetRespId(consts.SingleChatAck)
 	ack := &pb.ChatAck{MessageSeq: req.MessageSeq, MessageId: req.MessageId}
 
 	// 生成转发数据
 	forwardData, err := proto.Marshal(req)
 	if err != nil {
 		h.logger.Errorf("marshal error:%v", err)
-		return nil
+		return nil, err
 	}
 
 	forwardbuf := bytes.NewBuffer(nil)
@@ -92,145 +88,92 @@ func (h *UserChatHandler) ForwardMessage(ctx *chatserver.Context, req *pb.Single
 	h.logger.Debugf("[sender]:%d, [receiver]:%d, [message]:%s",
 		req.Sender, req.Receiver, req.Message)
 
-	// 2.检查是否在同一服务器，如果在直接发送
-	err, ok := h.sendIfOnSameServer(forwardbuf.Bytes(), req)
-	if err != nil {
-		h.logger.Errorf("send error:%v", err)
-		return nil
-	}
-	if ok {
-		return ack
-	}
+	// 2.发送给在同一服务器上的设备
+	h.sendOnSameServer(forwardbuf.Bytes(), req, ctx.Client)
 
-	// 3.不在同一台服务器上，查询所在服务器，并发送到对应消息队列
-	err, ok = h.sendIfOnAnotherServer(req, forwardbuf.Bytes())
+	// 3.查询其它设备所在服务器，并发送到对应消息队列
+	err = h.sendOnOtherServers(forwardbuf.Bytes(), req.Receiver, req.Sender)
 	if err != nil {
 		h.logger.Errorf("send async error:%v", err)
-		return nil
-	}
-	if ok {
-		return ack
 	}
 
 	// 4.用户不在线, 数据已经先被持久化到数据库中了
 	// 待用户上线后主动拉取离线消息
 
-	return ack
+	return ack, nil
 }
 
-func (h *UserChatHandler) checkUserParam(ctx *chatserver.Context, req *pb.SingleChat) bool {
+func (h *UserChatHandler) checkUserParam(ctx *chatserver.Context, req *pb.SingleChat) error {
 	// 不能发消息给自己
 	if req.Sender == req.Receiver {
-		return false
+		return ErrSendToSelf
 	}
 
 	id, ok := ctx.GetInt64("id")
-	if !ok {
-		h.invalidOperation(ctx)
-		return false
-	}
-
-	if req.Sender != id {
-		h.invalidOperation(ctx)
-		return false
+	if !ok || req.Sender != id {
+		return ErrInvalidSender
 	}
 
 	// 检查是否是它的联系人，如果不是则不允许发送
 	isMember, _ := h.redis.SIsMember(context.Background(), redisconsts.FriendsKey+strconv.Itoa(int(id)), req.Receiver).Result()
 	if !isMember {
-		h.invalidOperation(ctx)
-		return false
+		return ErrNotFriend
 	}
 
 	// 检查消息序列是否合法, 消息序列由客户端生成, 用于标识一天内的唯一消息
 	// 由32位秒时间戳和counter组成
 	if req.MessageSeq >> 32 == 0 {
-		h.invalidOperation(ctx)
-		return false
+		return ErrInvalidMessageSeq
 	}
 
-	return true
+	return nil
 }
 
-// 在同一服务器上
-func (h *UserChatHandler) sendIfOnSameServer(data []byte, req *pb.SingleChat) (error, bool) {
-	// 先查询是不是在同一台服务器上, 如果是直接转发
-	target := chatserver.ClientManagerInstance.Get(req.Receiver)
-	if target == nil {
-		return nil, false
+// 发送给在同一服务器上的Receiver的设备, 以及Sender的其它设备
+func (h *UserChatHandler) sendOnSameServer(data []byte, req *pb.SingleChat, from *chatserver.Client) {
+	if writeToLocal(req.Receiver, data, nil) > 0 {
+		h.retryHandler.Add(req.Receiver)
 	}
 
-	target.Write(data)
-	h.retryHandler.Add(req.Receiver)
-
-	return nil, true
+	// 同步给发送者的其它设备
+	writeToLocal(req.Sender, data, from)
 }
 
-// 在其它服务器上
-func (h *UserChatHandler) sendIfOnAnotherServer(req *pb.SingleChat, data []byte) (error, bool) {
-	result, err := h.redis.Get(context.Background(), redisconsts.ChatServerClientKey+strconv.Itoa(int(req.Receiver))).Result()
-	if err == redis.Nil {
-		// 用户不在线
-		return nil, false
-	}
-
+// 在其它服务器上, 每台服务器只发送一次, 由该服务器发送给它上面的Receiver和Sender的设备
+func (h *UserChatHandler) sendOnOtherServers(data []byte, uids ...int64) error {
+	servers, err := getUserServers(h.redis, h.serverId, uids...)
 	if err != nil {
 		h.logger.Errorf("get client error:%v", err)
-		return err, false
+		return err
 	}
 
 	// 用户在线, 发送到消息队列
-	queueName := redisconsts.ServerConsumerKey + result
-	err = mq.ProducerInstance.Publish(queueName, data)
+	err = publishToServers(servers, data)
 	if err != nil {
 		h.logger.Errorf("publish message error:%v", err)
-		return err, false
+		return err
 	}
 
-	return nil, true
-}
-
-func (h *UserChatHandler) invalidOperation(ctx *chatserver.Context) {
-	ctx.Abort()
-	ctx.Close()
-}
-
-// forwardMessage 从消息队列中读取消息，并转发给用户
-func (h *UserChatHandler) forwardMessage(ctx context.Context) {
-	for {
-		select {
-		case <-ctx.Done():
-			return
-		case delivery := <- mq.ConsumerInstance.DeliveryChan:
-			if err := h.sendMessage(&delivery); err != nil {
-				h.logger.Errorf("deliver message error:%v", err)
-			}
-
-			if err := delivery.Ack(false); err != nil {
-				h.logger.Errorf("mq ack error:%v", err)
-			}
-		}
-	}
+	return nil
 }
 
-// sendMessage 转发消息给客户端，同时消息会被写入mongo中
+// SendMessage 从消息队列中读取到消息后转发给客户端，消息已经在发送端写入mongo中
 // 用户需要回应ack，以将mongo中的消息设置为已读
-func (h *UserChatHandler) sendMessage(delivery *amqp.Delivery) error {
-	data := delivery.Body
+func (h *UserChatHandler) SendMessage(data []byte) error {
 	msg := new(pb.SingleChat)
 	err := proto.Unmarshal(data[4:], msg)
 	if err != nil {
 		return err
 	}
 
-	client := chatserver.ClientManagerInstance.Get(msg.Receiver)
+	// 同步给发送者在本服务器上的设备
+	writeToLocal(msg.Sender, data, nil)
+
 	// 用户下线了
-	if client == nil {
+	if writeToLocal(msg.Receiver, data, nil) == 0 {
 		return nil
 	}
 
-	client.Write(data)
-
 	h.retryHandler.Add(msg.Receiver)
 
 	return nil
@@ -243,11 +186,128 @@ func (h *UserChatHandler) ConfirmMessage(ctx *chatserver.Context, ack *pb.ChatAc
 		h.logger.Errorf("get objid error:%v", err)
 		return
 	}
-	err = h.messageDao.UpdateMessageRead(id)
+	// 只有接收者可以将消息设置为已读, 同步到发送者其它设备上的消息不需要确认
+	record, err := h.messageDao.UpdateMessageRead(id, ctx.GetUid())
 	if err != nil {
 		h.logger.Errorf("update message status error:%v", err)
 		return
 	}
 
 	h.retryHandler.Remove(ctx.GetUid())
-}
\ No newline at end of file
+
+	// 第一次被设置为已读时, 通知发送者
+	if record != nil {
+		h.pushReadReceipt(record)
+	}
+}
+
+// 推送已读回执给消息的发送者, 路由方式和消息相同
+func (h *UserChatHandler) pushReadReceipt(record *model.ChatRecord) {
+	receipt := &pb.ReadReceipt{
+		Reader:    record.Receiver,
+		Sender:    record.Sender,
+		MessageId: record.Id.Hex(),
+		ReadUpTo:  record.CreateTime,
+		ReadTime:  record.ReadTime,
+	}
+	data, err := chatserver.MarshalProtoMessage(consts.ReadReceipt, receipt)
+	if err != nil {
+		h.logger.Errorf("marshal error:%v", err)
+		return
+	}
+
+	writeToLocal(record.Sender, data, nil)
+
+	servers, err := getUserServers(h.redis, h.serverId, record.Sender)
+	if err != nil {
+		h.logger.Errorf("get client error:%v", err)
+		return
+	}
+	if err = publishToServers(servers, data); err != nil {
+		h.logger.Errorf("publish read receipt error:%v", err)
+	}
+}
+
+// 编辑消息的结果
+const (
+	EditOk = iota
+	EditNotAllowed
+	EditFailed
+)
+
+// EditMessage 编辑自己发送的文本消息
+// 编辑前的内容保存在消息的revisions中, 编辑事件和消息的转发方式相同
+// 发送给接收者的所有设备以及发送者的其它设备, 不在线的设备拉取消息时会得到最新的内容
+func (h *UserChatHandler) EditMessage(ctx *chatserver.Context, req *pb.Edit) *pb.EditAck {
+	ctx.SetRespId(consts.EditAck)
+	ack := &pb.EditAck{MessageId: req.MessageId}
+
+	id, err := primitive.ObjectIDFromHex(req.MessageId)
+	if err != nil || len(req.Message) == 0 {
+		ack.Code = EditNotAllowed
+		return ack
+	}
+
+	editedAt := time.Now().UnixMicro()
+	record, err := h.messageDao.EditMessage(id, ctx.GetUid(), req.Message, editedAt)
+	if err != nil {
+		h.logger.Errorf("edit message error:%v", err)
+		ack.Code = EditFailed
+		return ack
+	}
+	if record == nil {
+		ack.Code = EditNotAllowed
+		return ack
+	}
+	ack.EditedAt = editedAt
+
+	event := &pb.Edit{
+		MessageId: req.MessageId,
+		Sender:    record.Sender,
+		Receiver:  record.Receiver,
+		Message:   record.Message,
+		EditedAt:  editedAt,
+	}
+	data, err := chatserver.MarshalProtoMessage(consts.EditMessage, event)
+	if err != nil {
+		h.logger.Errorf("marshal error:%v", err)
+		return ack
+	}
+
+	writeToLocal(event.Receiver, data, nil)
+	writeToLocal(event.Sender, data, ctx.Client)
+
+	if err = h.sendOnOtherServers(data, event.Receiver, event.Sender); err != nil {
+		h.logger.Errorf("send async error:%v", err)
+	}
+
+	return ack
+}
+
+// SendEdit 从消息队列中读取到编辑事件后，发送给本服务器上的接收者和发送者的设备
+func (h *UserChatHandler) SendEdit(data []byte) error {
+	event := new(pb.Edit)
+	err := proto.Unmarshal(data[4:], event)
+	if err != nil {
+		return err
+	}
+
+	writeToLocal(event.Receiver, data, nil)
+	writeToLocal(event.Sender, data, nil)
+
+	return nil
+}
+
+// SendReadReceipt 从消息队列中读取到已读回执后，发送给本服务器上的发送者设备
+// 回执可能来自其它chatserver或者messageserver
+func (h *UserChatHandler) SendReadReceipt(data []byte) error {
+	receipt := new(pb.ReadReceipt)
+	err := proto.Unmarshal(data[4:], receipt)
+	if err != nil {
+		return err
+	}
+
+	writeToLocal(receipt.Sender, data, nil)
+
+	return nil
+}
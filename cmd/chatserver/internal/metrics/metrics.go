@@ -0,0 +1,109 @@
+package metrics
+
+import (
+	"strconv"
+
+	"github.com/mangohow/imchat/pkg/common/xmetrics"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+/*
+	chatserver的监控指标, 通过metrics端口的/metrics暴露, 不依赖管理接口
+	消息ID作为标签, 客户端发送的未知消息ID统一记为unknown, 防止标签数量无限增长
+*/
+
+const subsystem = "chatserver"
+
+// Unknown 没有注册的消息ID使用的标签
+const Unknown = "unknown"
+
+var (
+	FramesIn = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: xmetrics.Namespace,
+		Subsystem: subsystem,
+		Name:      "frames_in_total",
+		Help:      "Frames received from clients by message id.",
+	}, []string{"msg_id"})
+
+	FramesOut = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: xmetrics.Namespace,
+		Subsystem: subsystem,
+		Name:      "frames_out_total",
+		Help:      "Frames written to clients by message id.",
+	}, []string{"msg_id"})
+
+	HandlerDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: xmetrics.Namespace,
+		Subsystem: subsystem,
+		Name:      "handler_duration_seconds",
+		Help:      "Message handler latency by message id.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"msg_id"})
+
+	Retries = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: xmetrics.Namespace,
+		Subsystem: subsystem,
+		Name:      "retries_total",
+		Help:      "New message notifications sent by the retry handler.",
+	})
+
+	MQPublished = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: xmetrics.Namespace,
+		Subsystem: subsystem,
+		Name:      "mq_published_total",
+		Help:      "Messages published to other nodes' queues by message id.",
+	}, []string{"msg_id"})
+
+	MQPublishErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: xmetrics.Namespace,
+		Subsystem: subsystem,
+		Name:      "mq_publish_errors_total",
+		Help:      "Failed publishes by message id.",
+	}, []string{"msg_id"})
+
+	MQConsumed = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: xmetrics.Namespace,
+		Subsystem: subsystem,
+		Name:      "mq_consumed_total",
+		Help:      "Messages consumed from this node's queue by message id.",
+	}, []string{"msg_id"})
+
+	MQConsumeErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: xmetrics.Namespace,
+		Subsystem: subsystem,
+		Name:      "mq_consume_errors_total",
+		Help:      "Consumed messages whose handler failed by message id.",
+	}, []string{"msg_id"})
+)
+
+// GaugeFunc 注册一个取值时调用fn的指标, 重复注册时忽略
+func GaugeFunc(name, help string, fn func() float64) {
+	err := prometheus.Register(prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: xmetrics.Namespace,
+		Subsystem: subsystem,
+		Name:      name,
+		Help:      help,
+	}, fn))
+	if _, ok := err.(prometheus.AlreadyRegisteredError); err != nil && !ok {
+		panic(err)
+	}
+}
+
+// CounterFunc 注册一个取值时调用fn的计数器, 重复注册时忽略
+func CounterFunc(name, help string, fn func() float64) {
+	err := prometheus.Register(prometheus.NewCounterFunc(prometheus.CounterOpts{
+		Namespace: xmetrics.Namespace,
+		Subsystem: subsystem,
+		Name:      name,
+		Help:      help,
+	}, fn))
+	if _, ok := err.(prometheus.AlreadyRegisteredError); err != nil && !ok {
+		panic(err)
+	}
+}
+
+// MsgId 消息ID标签
+func MsgId(id uint32) string {
+	return strconv.FormatUint(uint64(id), 10)
+}
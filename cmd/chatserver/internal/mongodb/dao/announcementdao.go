@@ -0,0 +1,29 @@
+package dao
+
+import (
+	"context"
+
+	"github.com/mangohow/imchat/cmd/chatserver/internal/mongodb"
+	"github.com/mangohow/imchat/pkg/model"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type AnnouncementDao struct {
+	collection *mongo.Collection
+}
+
+func NewAnnouncementDao() *AnnouncementDao {
+	return &AnnouncementDao{
+		collection: mongodb.MongoDB.Collection(model.AnnouncementCollection),
+	}
+}
+
+// PersistAnnouncement 保存公告, 供离线用户拉取
+func (d *AnnouncementDao) PersistAnnouncement(announcement *model.Announcement) (primitive.ObjectID, error) {
+	res, err := d.collection.InsertOne(context.Background(), announcement)
+	if err != nil {
+		return primitive.NilObjectID, err
+	}
+	return res.InsertedID.(primitive.ObjectID), nil
+}
@@ -0,0 +1,33 @@
+package dao
+
+import (
+	"context"
+
+	"github.com/mangohow/imchat/cmd/chatserver/internal/mongodb"
+	"github.com/mangohow/imchat/pkg/model"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type GroupMessageDao struct {
+	mongo *mongo.Database
+	collection *mongo.Collection
+	collectionName string
+}
+
+func NewGroupMessageDao(collectionName string) *GroupMessageDao {
+	return &GroupMessageDao{
+		collectionName: collectionName,
+		mongo: mongodb.MongoDB,
+		collection: mongodb.MongoDB.Collection(collectionName),
+	}
+}
+
+// PersistMessage 持久化群消息
+func (d *GroupMessageDao) PersistMessage(record *model.GroupChatRecord) (primitive.ObjectID, error) {
+	res, err := d.collection.InsertOne(context.Background(), record)
+	if err != nil {
+		return primitive.NilObjectID, err
+	}
+	return res.InsertedID.(primitive.ObjectID), nil
+}
@@ -2,12 +2,15 @@ package dao
 
 import (
 	"context"
+	"time"
 
 	"github.com/mangohow/imchat/cmd/chatserver/internal/mongodb"
 	"github.com/mangohow/imchat/pkg/model"
+	"github.com/mangohow/imchat/proto/pb"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 type MessageDao struct {
@@ -31,10 +34,86 @@ func (d *MessageDao) PersistUnreadMessage(record *model.ChatRecord) (primitive.O
 	return res.InsertedID.(primitive.ObjectID), err
 }
 
-// UpdateMessageRead 设置消息为已读
-func (d *MessageDao) UpdateMessageRead(id primitive.ObjectID) error {
-	filter := bson.D{{"_id", id}}
-	update := bson.D{{"$set", bson.D{{"status", model.RecordStatusRead}}}}
-	_, err := d.collection.UpdateOne(context.Background(), filter, update)
-	return err
-}
\ No newline at end of file
+// UpdateMessageRead 设置消息为已读, 返回被设置为已读的消息
+// 消息已经是已读状态或者不存在时返回nil
+func (d *MessageDao) UpdateMessageRead(id primitive.ObjectID, receiver int64) (*model.ChatRecord, error) {
+	filter := model.UnreadFilter(receiver)
+	filter["_id"] = id
+	update := model.ReadUpdate(time.Now().UnixMicro())
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After).SetProjection(bson.M{"revisions": 0})
+	record := new(model.ChatRecord)
+	err := d.collection.FindOneAndUpdate(context.Background(), filter, update, opts).Decode(record)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return record, nil
+}
+
+// FindMessage 根据ID查询消息, 不存在时返回nil
+func (d *MessageDao) FindMessage(id primitive.ObjectID) (*model.ChatRecord, error) {
+	record := new(model.ChatRecord)
+	err := d.collection.FindOne(context.Background(), bson.M{"_id": id}).Decode(record)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return record, nil
+}
+
+// RecallMessage 将消息设置为已撤回, 只有发送者可以撤回createTime在after之后的消息
+// 返回是否撤回成功
+func (d *MessageDao) RecallMessage(id primitive.ObjectID, sender int64, after int64, recallTime int64) (bool, error) {
+	filter := bson.M{
+		"_id":        id,
+		"sender":     sender,
+		"createTime": bson.M{"$gte": after},
+		"recalled":   bson.M{"$ne": true},
+	}
+	update := bson.M{"$set": bson.M{"recalled": true, "recallTime": recallTime}}
+	res, err := d.collection.UpdateOne(context.Background(), filter, update)
+	if err != nil {
+		return false, err
+	}
+	return res.ModifiedCount > 0, nil
+}
+
+// EditMessage 编辑发送者自己发送的未撤回的文本消息, 编辑前的内容保存到revisions中
+// 返回编辑后的消息(不包含revisions), 消息不存在或者不允许编辑时返回nil
+func (d *MessageDao) EditMessage(id primitive.ObjectID, sender int64, message []byte, editedAt int64) (*model.ChatRecord, error) {
+	filter := bson.M{
+		"_id":         id,
+		"sender":      sender,
+		"messageType": int32(pb.MsgType_Text),
+		"recalled":    bson.M{"$ne": true},
+	}
+	// 使用聚合管道更新, 将当前内容追加到revisions中
+	revision := bson.M{
+		"message":    "$message",
+		"createTime": bson.M{"$ifNull": bson.A{"$editedAt", "$createTime"}},
+	}
+	update := bson.A{
+		bson.M{"$set": bson.M{
+			"revisions": bson.M{"$concatArrays": bson.A{bson.M{"$ifNull": bson.A{"$revisions", bson.A{}}}, bson.A{revision}}},
+			"message":   message,
+			"edited":    true,
+			"editedAt":  editedAt,
+		}},
+	}
+	opts := options.FindOneAndUpdate().
+		SetReturnDocument(options.After).
+		SetProjection(bson.M{"revisions": 0})
+	record := new(model.ChatRecord)
+	err := d.collection.FindOneAndUpdate(context.Background(), filter, update, opts).Decode(record)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return record, nil
+}
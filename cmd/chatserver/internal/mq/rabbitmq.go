@@ -2,7 +2,10 @@ package mq
 
 import (
 	"github.com/mangohow/imchat/cmd/chatserver/internal/conf"
+	"github.com/mangohow/imchat/cmd/chatserver/internal/metrics"
+	"github.com/mangohow/imchat/pkg/common/xframe"
 	"github.com/mangohow/imchat/pkg/common/xmq"
+	"github.com/mangohow/imchat/pkg/consts/mqconsts"
 	"github.com/streadway/amqp"
 )
 
@@ -17,6 +20,15 @@ type MQConsumer struct {
 	Conn         *amqp.Connection
 	Channel      *amqp.Channel
 	DeliveryChan <-chan amqp.Delivery
+	// 系统公告队列的数据
+	AnnouncementChan <-chan amqp.Delivery
+	// 消费者标识, 停止消费时使用
+	Tag string
+}
+
+// 公告队列的消费者标识
+func announcementTag(tag string) string {
+	return tag + ".announcement"
 }
 
 var (
@@ -66,24 +78,87 @@ func InitMQ(consumerQueueName, consumerName string) error {
 		return err
 	}
 
+	// 系统公告通过fanout交换机发送给所有服务器
+	// 每台服务器使用单独的排他队列, 连接断开或者停止消费后队列被删除, 宕机和排空的服务器不会再积压公告
+	err = consumerChan.ExchangeDeclare(mqconsts.AnnouncementExchange,
+		amqp.ExchangeFanout,
+		true,  // 是否持久化
+		false, // 是否自动删除
+		false, // 是否内部使用
+		false, // nowait
+		nil,
+	)
+	if err != nil {
+		return err
+	}
+	announcementQueue, err := consumerChan.QueueDeclare("",
+		false, // 是否持久化
+		true,  // 是否自动删除
+		true,  // 是否排他
+		false, // nowait
+		nil,
+	)
+	if err != nil {
+		return err
+	}
+	err = consumerChan.QueueBind(announcementQueue.Name, "", mqconsts.AnnouncementExchange, false, nil)
+	if err != nil {
+		return err
+	}
+	announcementCh, err := consumerChan.Consume(
+		announcementQueue.Name,
+		announcementTag(consumerName),
+		false,
+		false,
+		false,
+		false,
+		nil,
+	)
+	if err != nil {
+		return err
+	}
+
 	ConsumerInstance = &MQConsumer{
-		Conn:         conn,
-		Channel:      consumerChan,
-		DeliveryChan: ch,
+		Conn:             conn,
+		Channel:          consumerChan,
+		DeliveryChan:     ch,
+		AnnouncementChan: announcementCh,
+		Tag:              consumerName,
 	}
 
 	return nil
 }
 
 func (p *MQProducer) Publish(queName string, data []byte) error {
-	return p.Channel.Publish("",
-		queName,
+	return p.publish("", queName, data)
+}
+
+// Broadcast 发送到fanout交换机, 绑定了该交换机的所有服务器都会收到
+func (p *MQProducer) Broadcast(exchange string, data []byte) error {
+	return p.publish(exchange, "", data)
+}
+
+func (p *MQProducer) publish(exchange, key string, data []byte) error {
+	err := p.Channel.Publish(exchange,
+		key,
 		false,
 		false,
 		amqp.Publishing{
 			ContentType: "text/plain",
 			Body:        data,
 		})
+
+	msgId := metrics.Unknown
+	if id, e := xframe.PeekMsgId(data); e == nil {
+		msgId = metrics.MsgId(id)
+	}
+	if err != nil {
+		metrics.MQPublishErrors.WithLabelValues(msgId).Inc()
+	} else {
+		metrics.MQPublished.WithLabelValues(msgId).Inc()
+	}
+
+	return err
 }
 
 
@@ -91,3 +166,28 @@ func (p *MQProducer) Publish(queName string, data []byte) error {
 
 
 
+
+// DeleteQueue 删除没有消费者的队列, 队列中剩余的数据会被丢弃, 返回丢弃的数量
+// 队列有消费者时删除失败, 使用单独的channel, 失败时channel会被服务端关闭
+func (p *MQProducer) DeleteQueue(queName string) (int, error) {
+	ch, err := p.Conn.Channel()
+	if err != nil {
+		return 0, err
+	}
+	defer ch.Close()
+
+	return ch.QueueDelete(queName,
+		true,  // 只在没有消费者时删除
+		false, // 不为空时也删除
+		false, // nowait
+	)
+}
+
+// Stop 停止消费, 已经收到的数据处理完后DeliveryChan会被关闭
+// 没有ack的数据会留在队列中, 不会丢失
+func (c *MQConsumer) Stop() error {
+	if err := c.Channel.Cancel(announcementTag(c.Tag), false); err != nil {
+		return err
+	}
+	return c.Channel.Cancel(c.Tag, false)
+}
@@ -0,0 +1,22 @@
+package dao
+
+import (
+	"github.com/mangohow/imchat/cmd/chatserver/internal/mysqldb"
+	"gorm.io/gorm"
+)
+
+type FriendDao struct {
+	db *gorm.DB
+}
+
+func NewFriendDao() *FriendDao {
+	return &FriendDao{
+		db: mysqldb.MysqlDB,
+	}
+}
+
+// FindFriendIds 查询用户所有好友的ID
+func (d *FriendDao) FindFriendIds(userId int64) (ids []int64, err error) {
+	err = d.db.Table("t_friend").Where("user_id = ?", userId).Pluck("friend_id", &ids).Error
+	return
+}
@@ -0,0 +1,22 @@
+package dao
+
+import (
+	"github.com/mangohow/imchat/cmd/chatserver/internal/mysqldb"
+	"gorm.io/gorm"
+)
+
+type GroupDao struct {
+	db *gorm.DB
+}
+
+func NewGroupDao() *GroupDao {
+	return &GroupDao{
+		db: mysqldb.MysqlDB,
+	}
+}
+
+// FindMemberIds 查询群成员ID
+func (d *GroupDao) FindMemberIds(groupId int64) (ids []int64, err error) {
+	err = d.db.Table("t_group_member").Where("group_id = ?", groupId).Pluck("user_id", &ids).Error
+	return
+}
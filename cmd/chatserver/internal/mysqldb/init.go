@@ -0,0 +1,18 @@
+package mysqldb
+
+import (
+	"github.com/mangohow/imchat/cmd/chatserver/internal/conf"
+	"github.com/mangohow/imchat/pkg/common/xmysql"
+	"gorm.io/gorm"
+)
+
+// MysqlDB 和authserver使用同一个数据库, 只在redis缓存没有命中时读取好友和群成员
+var MysqlDB *gorm.DB
+
+func InitMysql() (err error) {
+	MysqlDB, err = xmysql.NewMysqlInstance(conf.MysqlConf)
+	if err == nil && conf.ServerConf.Mode == "dev" {
+		MysqlDB = MysqlDB.Debug()
+	}
+	return
+}
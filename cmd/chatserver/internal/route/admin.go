@@ -0,0 +1,34 @@
+package route
+
+import (
+	"crypto/tls"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mangohow/easygin"
+	"github.com/mangohow/imchat/cmd/chatserver/internal/chatserver"
+	"github.com/mangohow/imchat/cmd/chatserver/internal/handlers"
+)
+
+// NewAdminServer 管理接口, 和客户端连接使用不同的端口, 所有请求都需要携带admin token
+// 排空连接期间仍然可以访问, 需要在ChatServer关闭之后关闭
+func NewAdminServer(s *chatserver.ChatServer, addr, token string, tlsConfig *tls.Config) *http.Server {
+	engine := easygin.NewWithEngine(gin.New())
+	engine.Use(gin.Recovery())
+
+	adminHandler := handlers.NewAdminHandler(s)
+	group := engine.Group("/admin")
+	group.Use(handlers.AdminAuth(token))
+	group.GET("/clients", adminHandler.Clients)
+	group.GET("/stats", adminHandler.Stats)
+	group.GET("/nodes", adminHandler.Nodes)
+	group.POST("/kick", adminHandler.Kick)
+	group.POST("/send", adminHandler.Send)
+	group.POST("/announce", handlers.NewAnnouncementHandler().Announce)
+
+	return &http.Server{
+		Addr:      addr,
+		Handler:   engine.Engine,
+		TLSConfig: tlsConfig,
+	}
+}
@@ -0,0 +1,37 @@
+package route
+
+import (
+	"github.com/mangohow/imchat/cmd/chatserver/internal/chatserver"
+	"github.com/mangohow/imchat/pkg/consts"
+	"github.com/mangohow/imchat/proto/pb"
+)
+
+// 服务器推送给客户端的消息类型
+// 推送的数据都是protobuf格式, 发送给json客户端之前需要根据类型转换
+func registerMessageTypes() {
+	chatserver.RegisterMessageType(consts.SingleChatMessage, &pb.SingleChat{})
+	chatserver.RegisterMessageType(consts.GroupChatMessage, &pb.GroupChat{})
+	chatserver.RegisterMessageType(consts.FriendPresence, &pb.Presence{})
+	chatserver.RegisterMessageType(consts.ReadReceipt, &pb.ReadReceipt{})
+	chatserver.RegisterMessageType(consts.TypingMessage, &pb.Typing{})
+	chatserver.RegisterMessageType(consts.RecallMessage, &pb.Recall{})
+	chatserver.RegisterMessageType(consts.EditMessage, &pb.Edit{})
+	chatserver.RegisterMessageType(consts.ErrorMessage, &pb.Error{})
+	chatserver.RegisterMessageType(consts.SystemAnnouncement, &pb.Announcement{})
+}
+
+// 消息需要的最低协议版本, 没有注册的消息所有版本都支持
+func registerMinVersions() {
+	for _, id := range []uint32{
+		consts.FriendPresence,
+		consts.TypingMessage,
+		consts.ReadReceipt,
+		consts.RecallMessage,
+		consts.RecallAck,
+		consts.EditMessage,
+		consts.EditAck,
+		consts.SystemAnnouncement,
+	} {
+		chatserver.RegisterMinVersion(id, consts.ProtocolV2)
+	}
+}
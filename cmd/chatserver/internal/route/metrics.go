@@ -0,0 +1,19 @@
+package route
+
+import (
+	"net/http"
+
+	"github.com/mangohow/imchat/pkg/common/xmetrics"
+)
+
+// NewMetricsServer 单独的端口暴露/metrics, 不依赖管理接口, 不需要token
+// 排空连接期间仍然可以采集, 需要在ChatServer关闭之后关闭
+func NewMetricsServer(addr string) *http.Server {
+	mux := http.NewServeMux()
+	mux.Handle(xmetrics.Path, xmetrics.Handler())
+
+	return &http.Server{
+		Addr:    addr,
+		Handler: mux,
+	}
+}
@@ -2,18 +2,51 @@ package route
 
 import (
 	"fmt"
+	"os"
 
 	"github.com/mangohow/imchat/cmd/chatserver/internal/chatserver"
 	"github.com/mangohow/imchat/cmd/chatserver/internal/conf"
 	"github.com/mangohow/imchat/cmd/chatserver/internal/handlers"
+	"github.com/mangohow/imchat/cmd/chatserver/internal/log"
 	"github.com/mangohow/imchat/pkg/consts"
 	"github.com/mangohow/imchat/proto/pb"
 )
 
 func Register(s *chatserver.ChatServer) {
+	// 处理其它服务器通过消息队列转发过来的数据
+	mqHandler := handlers.NewMQHandler()
+
+	// 处理器中的panic不会导致服务崩溃, 客户端会收到错误帧
+	s.Use(chatserver.Recovery())
+
+	// 推送给json客户端的消息需要知道protobuf类型
+	registerMessageTypes()
+	// 低版本的客户端不支持的消息
+	registerMinVersions()
+
+	// 其它服务器建议客户端重连到本服务器时使用的地址
+	address := conf.RegistryConf.AdvertiseAddr
+	if address == "" {
+		address = fmt.Sprintf("%s:%d", conf.ServerConf.Host, conf.ServerConf.Port)
+	}
+	var registry *handlers.NodeRegistry
 	if conf.ServerConf.Mode != "test" {
-		authHandler := handlers.NewAuthHandler(s.HeartBeat(), s.ServerId())
-		// 设置权限验证处理器, 在握手阶段需要在header中传入token
+		// 好友上线/下线时推送给在线的好友
+		presenceHandler := handlers.NewPresenceHandler(s.ServerId())
+		mqHandler.Register(consts.FriendPresence, presenceHandler.SendPresence)
+
+		// 注册租约, 其它服务器上的用户如果所在的服务器租约过期了视为离线, 需要在开始接收连接之前注册
+		if conf.RegistryConf.LeaseTTL > 0 {
+			registry = handlers.NewNodeRegistry(s, address, conf.RegistryConf.LeaseTTL, presenceHandler)
+			if err := registry.Start(shutdownSelf); err != nil {
+				panic(fmt.Errorf("register node error:%v", err))
+			}
+			handlers.SetNodeRegistry(registry)
+			s.RegisterOnShutdown(registry.Stop)
+		}
+
+		authHandler := handlers.NewAuthHandler(s.ServerId(), conf.SessionConf.Policy, presenceHandler)
+		// 设置权限验证处理器, websocket在握手阶段传入token, tcp在登录帧中传入
 		s.SetAfterHandshakeHandler(authHandler.Auth)
 
 		// 清理数据
@@ -21,17 +54,86 @@ func Register(s *chatserver.ChatServer) {
 
 		// 权限验证
 		s.Use(authHandler.CheckAuthMiddleware)
+
+		// 重复登录时, 其它服务器通知本服务器将旧连接下线
+		mqHandler.Register(consts.KickOutNotify, authHandler.KickOut)
+	}
+
+	// 请求频率限制, 需要在权限验证之后
+	if conf.RateLimitConf.Enable {
+		s.Use(handlers.NewRateLimiter(conf.RateLimitConf).Middleware)
 	}
 
 	s.HandlerAnyFunc(consts.HelloRequest, func(ctx *chatserver.Context, hello *pb.Hello) *pb.Hello {
 		fmt.Println(hello.Message)
 		ctx.SetRespId(consts.HelloReply)
+		if ctx.ProtocolVersion() >= consts.ProtocolV2 {
+			return &pb.Hello{Message: fmt.Sprintf("hello, protocol v%d", ctx.ProtocolVersion())}
+		}
 		return &pb.Hello{Message: "hello"}
 	})
 
 	retryHandler := handlers.NewRetryHandler(s.GetCtx(), 8, 5)
 
-	userChatHandler := handlers.NewUserChatHandler(s.GetCtx(), 8, retryHandler)
+	// 写队列满时, 等写队列空闲后通知这个连接拉取离线消息
+	s.SetSpillFunc(handlers.NewSpillHandler(5).Spill)
+
+	userChatHandler := handlers.NewUserChatHandler(s.ServerId(), retryHandler)
 	s.HandlerAnyFunc(consts.SingleChatMessage, userChatHandler.ForwardMessage)
 	s.HandlerAnyFunc(consts.SingleChatAck, userChatHandler.ConfirmMessage)
+	mqHandler.Register(consts.SingleChatMessage, userChatHandler.SendMessage)
+	mqHandler.Register(consts.ReadReceipt, userChatHandler.SendReadReceipt)
+	s.HandlerAnyFunc(consts.EditMessage, userChatHandler.EditMessage)
+	mqHandler.Register(consts.EditMessage, userChatHandler.SendEdit)
+
+	recallHandler := handlers.NewRecallHandler(s.ServerId(), conf.MessageConf.RecallWindow)
+	s.HandlerAnyFunc(consts.RecallMessage, recallHandler.RecallMessage)
+	mqHandler.Register(consts.RecallMessage, recallHandler.SendRecall)
+
+	// 输入状态只转发, 不保存也不重试
+	typingHandler := handlers.NewTypingHandler(s.GetCtx(), s.ServerId())
+	s.HandlerAnyFunc(consts.TypingMessage, typingHandler.ForwardTyping)
+	mqHandler.Register(consts.TypingMessage, typingHandler.SendTyping)
+
+	groupChatHandler := handlers.NewGroupChatHandler(s.ServerId())
+	s.HandlerAnyFunc(consts.GroupChatMessage, groupChatHandler.ForwardMessage)
+	mqHandler.Register(consts.GroupChatMessage, groupChatHandler.SendMessage)
+
+	// 其它服务器的管理接口转发过来的下线通知和帧
+	adminHandler := handlers.NewAdminHandler(s)
+	mqHandler.Register(consts.AdminKickNotify, adminHandler.KickOut)
+	mqHandler.Register(consts.AdminFrameNotify, adminHandler.SendFrame)
+
+	// 系统公告, 推送给本服务器上的所有连接
+	announcementHandler := handlers.NewAnnouncementHandler()
+	mqHandler.Register(consts.SystemAnnouncement, announcementHandler.Deliver)
+
+	mqHandler.Start(s.GetCtx(), 8)
+
+	// 关闭服务时, 通知客户端重连到其它服务器, 客户端都断开后停止读取消息队列
+	// 优先选择注册表中负载低的服务器, 没有时使用配置的服务器列表
+	suggester := handlers.NewNodeSuggester(conf.DrainConf.Nodes, address)
+	s.SetSuggestNodeFunc(func(c *chatserver.Client) string {
+		if registry != nil {
+			if node := registry.Suggest(c); node != "" {
+				return node
+			}
+		}
+		return suggester.Suggest(c)
+	})
+	s.RegisterOnDrain(mqHandler.Stop)
+}
+
+// shutdownSelf 租约丢失时, 其它服务器可能已经回收了本服务器的路由和队列, 继续运行会丢失消息
+// 给自己发送中断信号, 走正常的关闭流程通知客户端重连到其它服务器
+func shutdownSelf() {
+	log.Logger().Error("node lease lost, shutting down")
+	p, err := os.FindProcess(os.Getpid())
+	if err == nil {
+		err = p.Signal(os.Interrupt)
+	}
+	if err != nil {
+		log.Logger().Errorf("signal self error:%v", err)
+		os.Exit(1)
+	}
 }
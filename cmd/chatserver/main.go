@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"net/http"
@@ -8,12 +9,13 @@ import (
 	"github.com/mangohow/easygin"
 	"github.com/mangohow/imchat/cmd/chatserver/internal/chatserver"
 	"github.com/mangohow/imchat/cmd/chatserver/internal/conf"
-	"github.com/mangohow/imchat/cmd/chatserver/internal/consts"
 	"github.com/mangohow/imchat/cmd/chatserver/internal/log"
 	"github.com/mangohow/imchat/cmd/chatserver/internal/mongodb"
 	"github.com/mangohow/imchat/cmd/chatserver/internal/mq"
+	"github.com/mangohow/imchat/cmd/chatserver/internal/mysqldb"
 	"github.com/mangohow/imchat/cmd/chatserver/internal/rdsconn"
 	"github.com/mangohow/imchat/cmd/chatserver/internal/route"
+	"github.com/mangohow/imchat/pkg/common/xtls"
 	"github.com/mangohow/imchat/pkg/consts/redisconsts"
 )
 
@@ -30,6 +32,7 @@ func main() {
 	port := flag.Int("port", 0, "specify server listening port")
 	host := flag.String("host", "", "specify server listening host")
 	id := flag.Int("id", 0, "specify server id")
+	tcpPort := flag.Int("tcpPort", 0, "specify tcp transport listening port")
 	flag.Parse()
 	if *port != 0 {
 		conf.ServerConf.Port = *port
@@ -40,6 +43,9 @@ func main() {
 	if *id != 0 {
 		conf.ServerConf.NodeId = *id
 	}
+	if *tcpPort != 0 {
+		conf.ServerConf.TCPPort = *tcpPort
+	}
 
 	if err := rdsconn.InitRedis(); err != nil {
 		panic(fmt.Errorf("init redis error:%v", err))
@@ -49,9 +55,41 @@ func main() {
 		panic(fmt.Errorf("init mongodb error:%v", err))
 	}
 
+	// 好友和群成员的缓存没有命中时从mysql读取
+	if err := mysqldb.InitMysql(); err != nil {
+		panic(fmt.Errorf("init mysql error:%v", err))
+	}
+
+	// 配置了证书时使用wss, 证书更新后不影响已经建立的连接
+	tlsCtx, tlsCancel := context.WithCancel(context.Background())
+	defer tlsCancel()
+	tlsConfig, err := xtls.NewServerConfig(tlsCtx, conf.ServerConf, func(err error) {
+		log.Logger().Errorf("reload certificate error:%v", err)
+	})
+	if err != nil {
+		panic(fmt.Errorf("init tls error:%v", err))
+	}
+
+	var tcpAddr string
+	if conf.ServerConf.TCPPort != 0 {
+		tcpAddr = fmt.Sprintf("%s:%d", conf.ServerConf.Host, conf.ServerConf.TCPPort)
+	}
+
 	server := chatserver.NewServer(&chatserver.Config{
 		Addr:      fmt.Sprintf("%s:%d", conf.ServerConf.Host, conf.ServerConf.Port),
-		HeartBeat: consts.HeartBeatTime,
+		HeartBeat: conf.HeartbeatConf.Timeout,
+		PingInterval: conf.HeartbeatConf.PingInterval,
+		IdleTimeout: conf.HeartbeatConf.IdleTimeout,
+		WriteOptions: &chatserver.WriteOptions{
+			WriteTimeout:       conf.WriteQueueConf.WriteTimeout,
+			MaxQueueBytes:      conf.WriteQueueConf.MaxQueueBytes,
+			SlowConsumerPolicy: conf.WriteQueueConf.SlowConsumerPolicy,
+		},
+		Compression: chatserver.NewCompressOptions(conf.CompressionConf),
+		AllowedOrigins: conf.WebSocketConf.AllowedOrigins,
+		TLSConfig: tlsConfig,
+		TCPAddr: tcpAddr,
+		DrainTimeout: conf.DrainConf.Timeout,
 	})
 
 	// 初始化消息队列
@@ -60,7 +98,7 @@ func main() {
 	}
 
 	server.RegisterOnShutdown(func() {
-		// 关闭server前清空所有连接
+		// 排空超时后仍然没有断开的连接直接关闭
 		chatserver.ClientManagerInstance.Clear()
 	})
 
@@ -72,6 +110,40 @@ func main() {
 		}
 	}()
 
+	// 管理接口
+	var adminServer *http.Server
+	if conf.AdminConf.Port != 0 {
+		if conf.AdminConf.Token == "" {
+			panic("admin token is required when admin port is set")
+		}
+		adminServer = route.NewAdminServer(server, fmt.Sprintf("%s:%d", conf.AdminConf.Host, conf.AdminConf.Port),
+			conf.AdminConf.Token, tlsConfig)
+		go func() {
+			log.Logger().Info("admin listen at: ", adminServer.Addr)
+			var err error
+			if tlsConfig != nil {
+				err = adminServer.ListenAndServeTLS("", "")
+			} else {
+				err = adminServer.ListenAndServe()
+			}
+			if err != nil && err != http.ErrServerClosed {
+				panic(err)
+			}
+		}()
+	}
+
+	// prometheus指标
+	var metricsServer *http.Server
+	if conf.MetricsConf.Port != 0 {
+		metricsServer = route.NewMetricsServer(fmt.Sprintf("%s:%d", conf.MetricsConf.Host, conf.MetricsConf.Port))
+		go func() {
+			log.Logger().Info("metrics listen at: ", metricsServer.Addr)
+			if err := metricsServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				panic(err)
+			}
+		}()
+	}
+
 	// 注册信号, 关闭服务
 	easygin.SetupSignal(func() {
 		err := server.Shutdown()
@@ -80,6 +152,17 @@ func main() {
 		} else {
 			log.Logger().Info("server closed")
 		}
+
+		if adminServer != nil {
+			ctx, cancel := context.WithTimeout(context.Background(), xtls.GraceDuration)
+			defer cancel()
+			_ = adminServer.Shutdown(ctx)
+		}
+		if metricsServer != nil {
+			ctx, cancel := context.WithTimeout(context.Background(), xtls.GraceDuration)
+			defer cancel()
+			_ = metricsServer.Shutdown(ctx)
+		}
 	})
 
 }
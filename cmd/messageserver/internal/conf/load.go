@@ -12,6 +12,10 @@ var (
 	ServerConf *xconfig.ServerConfig
 	LoggerConf *xconfig.LogConfig
 	MongoConf *xconfig.MongoConfig
+	RedisConf *xconfig.RedisConfig
+	MqConf *xconfig.RabbitMqConfig
+	MessageConf *xconfig.MessageConfig
+	CorsConf *xconfig.CorsConfig
 )
 
 func LoadConf(path string) error {
@@ -33,12 +37,17 @@ func LoadConf(path string) error {
 	initServerConf()
 	initLogConf()
 	initMongoConf()
+	initRedisConf()
+	initMqConf()
+	initMessageConf()
+	initCorsConf()
 
 	return nil
 }
 
 func setDefault() {
-
+	viper.SetDefault("message.cleanInterval", "1h")
+	viper.SetDefault("cors.maxAge", "12h")
 }
 
 func initServerConf() {
@@ -48,6 +57,11 @@ func initServerConf() {
 		Name: viper.GetString("server.name"),
 		Mode: viper.GetString("server.mode"),
 		NodeId: viper.GetInt("server.nodeId"),
+		CertFile: viper.GetString("server.certFile"),
+		KeyFile: viper.GetString("server.keyFile"),
+		ClientCAFile: viper.GetString("server.clientCAFile"),
+		RequireClientCert: viper.GetBool("server.requireClientCert"),
+		CertReloadInterval: viper.GetDuration("server.certReloadInterval"),
 	}
 }
 
@@ -70,3 +84,36 @@ func initMongoConf() {
 		MinPoolSize: viper.GetInt("mongo.minPoolSize"),
 	}
 }
+
+func initRedisConf() {
+	RedisConf = &xconfig.RedisConfig{
+		Addr:         viper.GetString("redis.addr"),
+		Password:     viper.GetString("redis.password"),
+		DB:           viper.GetUint32("redis.db"),
+		PoolSize:     viper.GetUint32("redis.poolSize"),
+		MinIdleConns: viper.GetUint32("redis.minIdleConns"),
+	}
+}
+
+func initMqConf() {
+	MqConf = &xconfig.RabbitMqConfig{
+		Host:     viper.GetString("rabbitmq.host"),
+		Port:     viper.GetInt("rabbitmq.port"),
+		Username: viper.GetString("rabbitmq.username"),
+		Password: viper.GetString("rabbitmq.password"),
+	}
+}
+
+func initMessageConf() {
+	MessageConf = &xconfig.MessageConfig{
+		CleanInterval: viper.GetDuration("message.cleanInterval"),
+	}
+}
+
+func initCorsConf() {
+	CorsConf = &xconfig.CorsConfig{
+		AllowOrigins:     viper.GetStringSlice("cors.allowOrigins"),
+		AllowCredentials: viper.GetBool("cors.allowCredentials"),
+		MaxAge:           viper.GetDuration("cors.maxAge"),
+	}
+}
@@ -0,0 +1,59 @@
+package controller
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mangohow/easygin"
+	"github.com/mangohow/imchat/cmd/messageserver/internal/log"
+	"github.com/mangohow/imchat/cmd/messageserver/internal/resultcode"
+	"github.com/mangohow/imchat/cmd/messageserver/internal/service"
+	"github.com/mangohow/imchat/pkg/model"
+	"github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type AnnouncementController struct {
+	logger              *logrus.Logger
+	announcementService *service.AnnouncementService
+}
+
+func NewAnnouncementController() *AnnouncementController {
+	return &AnnouncementController{
+		logger:              log.Logger(),
+		announcementService: service.NewAnnouncementService(),
+	}
+}
+
+// GetAnnouncements 拉取离线期间发布的系统公告, 和离线消息一起拉取
+// since和lastId为客户端收到的最后一条公告的createTime(毫秒)和id, 不传时拉取所有没有过期的公告
+// 返回 {announcements, hasMore}, hasMore为true时以最后一条为位置继续拉取
+// GET /api/message/announcements?since=&lastId=
+func (c *AnnouncementController) GetAnnouncements(ctx *gin.Context) *easygin.Result {
+	if getId(ctx) == -1 {
+		return easygin.Error(http.StatusUnauthorized, resultcode.Unauthorized)
+	}
+
+	var cursor *model.AnnouncementCursor
+	if s := ctx.Query("since"); s != "" {
+		since, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return easygin.Fail(resultcode.ParamInvalid)
+		}
+		cursor = &model.AnnouncementCursor{CreateTime: since}
+		if lastId := ctx.Query("lastId"); lastId != "" {
+			if cursor.LastId, err = primitive.ObjectIDFromHex(lastId); err != nil {
+				return easygin.Fail(resultcode.ParamInvalid)
+			}
+		}
+	}
+
+	page, err := c.announcementService.GetAnnouncements(cursor)
+	if err != nil {
+		c.logger.Errorf("get announcements error:%v", err)
+		return easygin.Fail(resultcode.QueryFailed)
+	}
+
+	return easygin.Ok(page)
+}
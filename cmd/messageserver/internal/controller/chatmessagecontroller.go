@@ -49,18 +49,70 @@ func (c *ChatMessageController) PullOfflineMessages(ctx *gin.Context) *easygin.R
 }
 
 // GetMessages 获取消息, createTime为下一条消息的创建时间, 设置为-1则从最新的开始拉取
+// 返回 {records, readState}, readState为好友读到了自己发送的哪一条消息
 func (c *ChatMessageController) GetMessages(ctx *gin.Context, friendId int64, pageSize int, createTime int64) *easygin.Result {
 	id := getId(ctx)
 	if id == -1 {
 		return easygin.Error(http.StatusUnauthorized, resultcode.Unauthorized)
 	}
-	records, err := c.chatMessageService.GetMessage(id, friendId, pageSize, createTime)
+	history, err := c.chatMessageService.GetHistory(id, friendId, pageSize, createTime)
 	if err != nil {
 		c.logger.Errorf("get message error:%v", err)
 		return easygin.Fail(resultcode.QueryFailed)
 	}
 
-	return easygin.Ok(records)
+	return easygin.Ok(history)
+}
+
+// GetRevisions 查询消息的编辑历史
+func (c *ChatMessageController) GetRevisions(ctx *gin.Context, messageId string) *easygin.Result {
+	id := getId(ctx)
+	if id == -1 {
+		return easygin.Error(http.StatusUnauthorized, resultcode.Unauthorized)
+	}
+	revisions, err := c.chatMessageService.GetRevisions(id, messageId)
+	if err != nil {
+		c.logger.Errorf("get revisions error:%v", err)
+		return easygin.Fail(resultcode.QueryFailed)
+	}
+	if revisions == nil {
+		return easygin.Fail(resultcode.MessageNotExist)
+	}
+
+	return easygin.Ok(revisions)
+}
+
+// DeleteMessage 删除一条消息, 只删除自己这一方的, 对方仍然可以看到
+func (c *ChatMessageController) DeleteMessage(ctx *gin.Context, messageId string) *easygin.Result {
+	id := getId(ctx)
+	if id == -1 {
+		return easygin.Error(http.StatusUnauthorized, resultcode.Unauthorized)
+	}
+	exist, err := c.chatMessageService.DeleteMessage(id, messageId)
+	if err != nil {
+		c.logger.Errorf("delete message error:%v", err)
+		return easygin.Fail(resultcode.DeleteMessageFailed)
+	}
+	if !exist {
+		return easygin.Fail(resultcode.MessageNotExist)
+	}
+
+	return easygin.Ok(nil)
+}
+
+// ClearConversation 清空和好友的聊天记录, 只删除自己这一方的
+func (c *ChatMessageController) ClearConversation(ctx *gin.Context, friendId int64) *easygin.Result {
+	id := getId(ctx)
+	if id == -1 {
+		return easygin.Error(http.StatusUnauthorized, resultcode.Unauthorized)
+	}
+	err := c.chatMessageService.ClearConversation(id, friendId)
+	if err != nil {
+		c.logger.Errorf("clear conversation error:%v", err)
+		return easygin.Fail(resultcode.DeleteMessageFailed)
+	}
+
+	return easygin.Ok(nil)
 }
 
 // UpdateStatus 更新消息状态
@@ -76,6 +128,7 @@ func (c *ChatMessageController) UpdateStatus(ctx *gin.Context) *easygin.Result {
 		c.logger.Errorf("bind message ids error:%v", err)
 		return easygin.Error(http.StatusInternalServerError, resultcode.QueryFailed)
 	}
+	// 消息设置为已读后会推送已读回执给发送者
 	if len(messageIds) > 1 {
 		err =c.chatMessageService.UpdateMany(id, messageIds)
 	} else if len(messageIds) == 1 {
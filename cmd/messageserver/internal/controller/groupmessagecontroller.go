@@ -0,0 +1,42 @@
+package controller
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mangohow/easygin"
+	"github.com/mangohow/imchat/cmd/messageserver/internal/log"
+	"github.com/mangohow/imchat/cmd/messageserver/internal/resultcode"
+	"github.com/mangohow/imchat/cmd/messageserver/internal/service"
+	"github.com/sirupsen/logrus"
+)
+
+type GroupMessageController struct {
+	logger              *logrus.Logger
+	groupMessageService *service.GroupMessageService
+}
+
+func NewGroupMessageController() *GroupMessageController {
+	return &GroupMessageController{
+		logger:              log.Logger(),
+		groupMessageService: service.NewGroupMessageService(),
+	}
+}
+
+// GetMessages 获取群消息, createTime为下一条消息的创建时间, 设置为-1则从最新的开始拉取
+func (c *GroupMessageController) GetMessages(ctx *gin.Context, groupId int64, pageSize int, createTime int64) *easygin.Result {
+	id := getId(ctx)
+	if id == -1 {
+		return easygin.Error(http.StatusUnauthorized, resultcode.Unauthorized)
+	}
+	records, err := c.groupMessageService.GetMessage(id, groupId, pageSize, createTime)
+	if err != nil {
+		if err == service.NotGroupMemberError {
+			return easygin.Fail(resultcode.NotGroupMember)
+		}
+		c.logger.Errorf("get group message error:%v", err)
+		return easygin.Fail(resultcode.QueryFailed)
+	}
+
+	return easygin.Ok(records)
+}
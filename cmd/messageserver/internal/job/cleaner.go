@@ -0,0 +1,37 @@
+package job
+
+import (
+	"context"
+	"time"
+
+	"github.com/mangohow/imchat/cmd/messageserver/internal/log"
+	"github.com/mangohow/imchat/cmd/messageserver/internal/service"
+)
+
+// StartMessageCleaner 定时删除双方都已经删除的消息
+// 多个messageserver同时执行也没有影响
+func StartMessageCleaner(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+
+	logger := log.Logger()
+	chatMessageService := service.NewChatMessageService()
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				n, err := chatMessageService.DeleteRemovedMessages()
+				if err != nil {
+					logger.Errorf("delete removed messages error:%v", err)
+					continue
+				}
+				logger.Debugf("delete removed messages:%d", n)
+			}
+		}
+	}()
+}
@@ -0,0 +1,46 @@
+package mq
+
+import (
+	"github.com/mangohow/imchat/cmd/messageserver/internal/conf"
+	"github.com/mangohow/imchat/pkg/common/xmq"
+	"github.com/streadway/amqp"
+)
+
+// messageserver只需要发送消息到chatserver的消息队列中, 由chatserver推送给客户端
+
+type MQProducer struct {
+	Conn    *amqp.Connection
+	Channel *amqp.Channel
+}
+
+var ProducerInstance *MQProducer
+
+func InitMQ() error {
+	conn, err := xmq.NewRabbitmqInstance(conf.MqConf)
+	if err != nil {
+		return err
+	}
+
+	producerChan, err := conn.Channel()
+	if err != nil {
+		return err
+	}
+
+	ProducerInstance = &MQProducer{
+		Conn:    conn,
+		Channel: producerChan,
+	}
+
+	return nil
+}
+
+func (p *MQProducer) Publish(queName string, data []byte) error {
+	return p.Channel.Publish("",
+		queName,
+		false,
+		false,
+		amqp.Publishing{
+			ContentType: "text/plain",
+			Body:        data,
+		})
+}
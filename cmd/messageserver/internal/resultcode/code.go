@@ -6,12 +6,20 @@ const (
 	Unauthorized = iota + 1
 	UpdateMessageFailed
 	QueryFailed
+	NotGroupMember
+	MessageNotExist
+	DeleteMessageFailed
+	ParamInvalid
 )
 
 
 var messager = map[int]string {
 	UpdateMessageFailed: "更新消息状态失败",
 	QueryFailed: "查询失败",
+	NotGroupMember: "不是群成员",
+	MessageNotExist: "消息不存在",
+	DeleteMessageFailed: "删除消息失败",
+	ParamInvalid: "参数错误",
 }
 
 
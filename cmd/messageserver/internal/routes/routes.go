@@ -2,15 +2,34 @@ package routes
 
 import (
 	"github.com/mangohow/easygin"
+	"github.com/mangohow/imchat/cmd/messageserver/internal/conf"
 	"github.com/mangohow/imchat/cmd/messageserver/internal/controller"
 	"github.com/mangohow/imchat/cmd/messageserver/internal/middleware"
+	"github.com/mangohow/imchat/pkg/common/xcors"
+	"github.com/mangohow/imchat/pkg/common/xmetrics"
 )
 
 func Register(engine *easygin.EasyGin) {
+	// 跨域, 需要在权限验证之前
+	if cors := xcors.Middleware(conf.CorsConf); cors != nil {
+		engine.Use(cors)
+	}
+	// 监控指标, 需要在权限验证之前注册
+	xmetrics.Register(engine.Engine)
+	engine.Use(xmetrics.Middleware())
 	engine.Use(middleware.Authentication())
 	group := engine.Group("/api/message")
 	messageController := controller.NewChatMessageController()
 	group.GET("/offline", messageController.PullOfflineMessages)
 	group.GET("/history", messageController.GetMessages)
 	group.PUT("/status", messageController.UpdateStatus)
+	group.GET("/revisions", messageController.GetRevisions)
+	group.DELETE("/record", messageController.DeleteMessage)
+	group.DELETE("/conversation", messageController.ClearConversation)
+
+	groupMessageController := controller.NewGroupMessageController()
+	group.GET("/group/history", groupMessageController.GetMessages)
+
+	announcementController := controller.NewAnnouncementController()
+	group.GET("/announcements", announcementController.GetAnnouncements)
 }
\ No newline at end of file
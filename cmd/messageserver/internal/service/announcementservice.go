@@ -0,0 +1,51 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"github.com/mangohow/imchat/cmd/messageserver/internal/mongodb"
+	"github.com/mangohow/imchat/pkg/model"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// MaxAnnouncements 一次最多拉取的公告数
+const MaxAnnouncements = 100
+
+// AnnouncementService 系统公告由chatserver的管理接口发布并保存, 这里只提供拉取
+// 拉取的位置由客户端保存并在请求时带上, 服务端不记录
+type AnnouncementService struct {
+	db *mongo.Collection
+}
+
+func NewAnnouncementService() *AnnouncementService {
+	return &AnnouncementService{
+		db: mongodb.MongoDB.Collection(model.AnnouncementCollection),
+	}
+}
+
+// GetAnnouncements 拉取cursor之后发布的并且没有过期的公告, 按发布时间从旧到新排序, cursor为nil时从头拉取
+// 每次最多拉取MaxAnnouncements条, HasMore为true时客户端以最后一条为位置继续拉取
+func (s *AnnouncementService) GetAnnouncements(cursor *model.AnnouncementCursor) (*model.AnnouncementPage, error) {
+	// 多查询一条用于判断是否还有更多
+	opts := options.Find().SetSort(bson.D{{"createTime", 1}, {"_id", 1}}).SetLimit(MaxAnnouncements + 1)
+	res, err := s.db.Find(context.Background(), model.ActiveAnnouncementFilter(cursor, time.Now().UnixMilli()), opts)
+	if err != nil {
+		return nil, err
+	}
+
+	records := make([]model.Announcement, 0)
+	if err = res.All(context.Background(), &records); err != nil {
+		return nil, err
+	}
+
+	page := &model.AnnouncementPage{Announcements: records}
+	if len(records) > MaxAnnouncements {
+		page.Announcements = records[:MaxAnnouncements]
+		page.HasMore = true
+	}
+
+	return page, nil
+}
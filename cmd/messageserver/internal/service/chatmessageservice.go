@@ -2,19 +2,31 @@ package service
 
 import (
 	"context"
+	"encoding/binary"
+	"strconv"
+	"time"
 
+	"github.com/elliotchance/pie/v2"
+	"github.com/go-redis/redis/v8"
 	"github.com/mangohow/imchat/cmd/messageserver/internal/log"
 	"github.com/mangohow/imchat/cmd/messageserver/internal/mongodb"
+	"github.com/mangohow/imchat/cmd/messageserver/internal/mq"
+	"github.com/mangohow/imchat/cmd/messageserver/internal/rdsconn"
+	"github.com/mangohow/imchat/pkg/consts"
+	"github.com/mangohow/imchat/pkg/consts/redisconsts"
 	"github.com/mangohow/imchat/pkg/model"
+	"github.com/mangohow/imchat/proto/pb"
 	"github.com/sirupsen/logrus"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
+	"google.golang.org/protobuf/proto"
 )
 
 type ChatMessageService struct {
 	db *mongo.Collection
+	redis *redis.Client
 	logger *logrus.Logger
 }
 
@@ -22,45 +34,147 @@ type ChatMessageService struct {
 func NewChatMessageService() *ChatMessageService {
 	return &ChatMessageService{
 		db: mongodb.MongoDB.Collection("singleChat"),
+		redis: rdsconn.RedisConn(),
 		logger: log.Logger(),
 	}
 }
 
 
+// UpdateMany 将消息设置为已读, 并推送已读回执给发送者
+// 同一个会话中的消息只推送一条回执, 表示已经读到了其中最新的一条消息
 func (s *ChatMessageService) UpdateMany(uid int64, msgIds []string) (err error) {
-	writeModel :=make([]mongo.WriteModel, len(msgIds))
-	update := bson.D{{"$set", bson.D{{"status", model.RecordStatusRead}}}}
+	objIds := make([]primitive.ObjectID, 0, len(msgIds))
 	for i := range msgIds {
-		objId, _ := primitive.ObjectIDFromHex(msgIds[i])
-		filter := bson.D{{"_id", objId}, {"receiver", uid}}
-		model := mongo.NewUpdateOneModel().SetFilter(filter).SetUpdate(update)
-		writeModel[i] = model
+		objId, err := primitive.ObjectIDFromHex(msgIds[i])
+		if err != nil {
+			continue
+		}
+		objIds = append(objIds, objId)
+	}
+	if len(objIds) == 0 {
+		return nil
 	}
 
-	_, err = s.db.BulkWrite(context.Background(), writeModel)
-	if err != nil {
-		return err
+	// 每条消息使用带未读条件的FindOneAndUpdate, 查询和更新是原子的
+	// 只有本次设置为已读的消息才推送回执, 并发的请求不会重复推送, 也不会遗漏
+	readTime := time.Now().UnixMicro()
+	records := make([]*model.ChatRecord, 0, len(objIds))
+	opts := options.FindOneAndUpdate().SetProjection(withoutRevisions)
+	for _, objId := range objIds {
+		filter := model.UnreadFilter(uid)
+		filter["_id"] = objId
+		record := new(model.ChatRecord)
+		e := s.db.FindOneAndUpdate(context.Background(), filter, model.ReadUpdate(readTime), opts).Decode(record)
+		if e == mongo.ErrNoDocuments {
+			continue
+		}
+		if e != nil {
+			// 出错时不再处理剩余的消息, 本次已经设置为已读的消息仍然推送回执, 然后返回错误, 剩余的消息由客户端重新提交
+			err = e
+			break
+		}
+		records = append(records, record)
+	}
+
+	for _, receipt := range readReceipts(uid, records, readTime) {
+		s.pushReadReceipt(receipt)
+	}
+
+	return err
+}
+
+// readReceipts 按会话合并已读的消息, 每个发送者只生成一条回执, 表示读到了其中最新的一条
+func readReceipts(reader int64, records []*model.ChatRecord, readTime int64) []*pb.ReadReceipt {
+	latest := make(map[int64]*model.ChatRecord)
+	for _, rec := range records {
+		if l, ok := latest[rec.Sender]; !ok || rec.CreateTime > l.CreateTime {
+			latest[rec.Sender] = rec
+		}
 	}
 
-	return nil
+	receipts := make([]*pb.ReadReceipt, 0, len(latest))
+	for _, rec := range latest {
+		receipts = append(receipts, &pb.ReadReceipt{
+			Reader:    reader,
+			Sender:    rec.Sender,
+			MessageId: rec.Id.Hex(),
+			ReadUpTo:  rec.CreateTime,
+			ReadTime:  readTime,
+		})
+	}
+	return receipts
 }
 
 func (s *ChatMessageService) UpdateOne(uid int64, msgId string) (err error) {
-	objId, _ := primitive.ObjectIDFromHex(msgId)
-	filter := bson.D{{"_id", objId}, {"receiver", uid}}
-	update := bson.D{{"$set", bson.D{{"status", model.RecordStatusRead}}}}
-	_, err = s.db.UpdateOne(context.Background(), filter, update)
-	return
+	return s.UpdateMany(uid, []string{msgId})
 }
 
-func (s *ChatMessageService) GetMessage(id int64, friendId int64, pageSize int, createTime int64) (records []model.ChatRecord, err error) {
-	// 查找最新聊天记录
-	filter := bson.M{
-		"$or": bson.A{
-			bson.M{"receiver": id, "sender": friendId},
-			bson.M{"receiver": friendId, "sender": id},
-		},
+// 推送已读回执到发送者所在的chatserver的消息队列中, 由chatserver推送给发送者
+func (s *ChatMessageService) pushReadReceipt(receipt *pb.ReadReceipt) {
+	servers, err := s.redis.HVals(context.Background(), redisconsts.ChatServerClientKey+strconv.Itoa(int(receipt.Sender))).Result()
+	if err != nil && err != redis.Nil {
+		s.logger.Errorf("get client error:%v", err)
+		return
+	}
+	if len(servers) == 0 {
+		return
+	}
+
+	data, err := proto.Marshal(receipt)
+	if err != nil {
+		s.logger.Errorf("marshal error:%v", err)
+		return
+	}
+	buf := make([]byte, 4, 4+len(data))
+	binary.LittleEndian.PutUint32(buf, consts.ReadReceipt)
+	buf = append(buf, data...)
+
+	// 每台服务器只发送一次
+	for _, serverId := range pie.Unique(servers) {
+		if err = mq.ProducerInstance.Publish(redisconsts.ServerConsumerKey+serverId, buf); err != nil {
+			s.logger.Errorf("publish read receipt error:%v", err)
+		}
 	}
+}
+
+// GetHistory 查询聊天记录, 同时返回好友读到了自己发送的哪一条消息
+func (s *ChatMessageService) GetHistory(id int64, friendId int64, pageSize int, createTime int64) (*model.ChatHistory, error) {
+	records, err := s.GetMessage(id, friendId, pageSize, createTime)
+	if err != nil {
+		return nil, err
+	}
+	state, err := s.GetReadState(id, friendId)
+	if err != nil {
+		return nil, err
+	}
+
+	return &model.ChatHistory{Records: records, ReadState: state}, nil
+}
+
+// GetReadState 查询好友已经读到了自己发送的哪一条消息
+func (s *ChatMessageService) GetReadState(id int64, friendId int64) (*model.ReadState, error) {
+	filter := model.ReadFilter(id, friendId)
+	opts := options.FindOne().SetSort(bson.M{"createTime": -1})
+	var record model.ChatRecord
+	err := s.db.FindOne(context.Background(), filter, opts).Decode(&record)
+	if err == mongo.ErrNoDocuments {
+		return &model.ReadState{FriendId: friendId}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &model.ReadState{
+		FriendId:  friendId,
+		MessageId: record.Id.Hex(),
+		ReadUpTo:  record.CreateTime,
+		ReadTime:  record.ReadTime,
+	}, nil
+}
+
+func (s *ChatMessageService) GetMessage(id int64, friendId int64, pageSize int, createTime int64) (records []model.ChatRecord, err error) {
+	// 查找最新聊天记录, 不包括自己已经删除的消息
+	filter := model.VisibleFilter(id, friendId)
 	/*
 	db.singleChat.find({
 	  createTime: { $lt: 1691503996133385 },
@@ -76,19 +190,21 @@ func (s *ChatMessageService) GetMessage(id int64, friendId int64, pageSize int,
 	}
 	// 按照createTime降序排序，获取最新数据 1 为升序 2为降序
 	sort := bson.D{{"createTime", -1}}
-	opts := options.Find().SetLimit(int64(pageSize)).SetSort(sort)
+	opts := options.Find().SetLimit(int64(pageSize)).SetSort(sort).SetProjection(withoutRevisions)
 	res, err := s.db.Find(context.Background(), filter, opts)
 	if err != nil {
 		return nil, err
 	}
 	err = res.All(context.Background(), &records)
+	for i := range records {
+		tombstone(&records[i])
+	}
 
 	return
 }
 
 func (s *ChatMessageService) GetOfflineMessage(id int64) (recs map[int64][]*model.ChatRecord, err error) {
-	filter := bson.D{{"receiver", id}, {"status", model.RecordStatusUnread}}
-	res, err := s.db.Find(context.Background(), filter)
+	res, err := s.db.Find(context.Background(), model.UnreadFilter(id), options.Find().SetProjection(withoutRevisions))
 	if err != nil {
 		return nil, err
 	}
@@ -101,8 +217,96 @@ func (s *ChatMessageService) GetOfflineMessage(id int64) (recs map[int64][]*mode
 
 	recs = make(map[int64][]*model.ChatRecord)
 	for i := range records {
+		tombstone(&records[i])
 		recs[records[i].Sender] = append(recs[records[i].Sender], &records[i])
 	}
 
 	return
 }
+
+// DeleteMessage 删除一条消息, 只对自己不可见, 返回消息是否存在
+func (s *ChatMessageService) DeleteMessage(id int64, msgId string) (bool, error) {
+	objId, err := primitive.ObjectIDFromHex(msgId)
+	if err != nil {
+		return false, nil
+	}
+
+	return s.remove(bson.M{"_id": objId, "sender": id}, bson.M{"_id": objId, "receiver": id})
+}
+
+// ClearConversation 清空和好友的聊天记录, 只对自己不可见
+func (s *ChatMessageService) ClearConversation(id int64, friendId int64) error {
+	_, err := s.remove(bson.M{"sender": id, "receiver": friendId}, bson.M{"sender": friendId, "receiver": id})
+	return err
+}
+
+// 删除消息, sent为自己发送的消息的过滤条件, received为自己接收的消息的过滤条件
+// 返回是否有匹配的消息
+func (s *ChatMessageService) remove(sent, received bson.M) (bool, error) {
+	res1, err := s.db.UpdateMany(context.Background(), sent, model.RemoveUpdate(true))
+	if err != nil {
+		return false, err
+	}
+	res2, err := s.db.UpdateMany(context.Background(), received, model.RemoveUpdate(false))
+	if err != nil {
+		return false, err
+	}
+
+	return res1.MatchedCount+res2.MatchedCount > 0, nil
+}
+
+// DeleteRemovedMessages 删除双方都已经删除的消息, 返回删除的数量
+func (s *ChatMessageService) DeleteRemovedMessages() (int64, error) {
+	res, err := s.db.DeleteMany(context.Background(), bson.M{"status": model.RecordStatusBothRemoved})
+	if err != nil {
+		return 0, err
+	}
+	return res.DeletedCount, nil
+}
+
+// 查询聊天记录时不返回编辑历史
+var withoutRevisions = bson.M{"revisions": 0}
+
+// GetRevisions 查询消息的所有版本, 按时间顺序排列, 最后一个为当前的内容
+// 只有消息的发送者和接收者可以查询, 消息不存在时返回nil
+func (s *ChatMessageService) GetRevisions(id int64, msgId string) ([]model.MessageRevision, error) {
+	objId, err := primitive.ObjectIDFromHex(msgId)
+	if err != nil {
+		return nil, nil
+	}
+	filter := bson.M{
+		"_id": objId,
+		"$or": bson.A{bson.M{"sender": id}, bson.M{"receiver": id}},
+	}
+	var record model.ChatRecord
+	err = s.db.FindOne(context.Background(), filter).Decode(&record)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if record.RemovedBy(id) {
+		return nil, nil
+	}
+
+	// 已撤回的消息不返回任何内容
+	if record.Recalled {
+		return []model.MessageRevision{}, nil
+	}
+
+	current := model.MessageRevision{Message: record.Message, CreateTime: record.CreateTime}
+	if record.Edited {
+		current.CreateTime = record.EditedAt
+	}
+
+	return append(record.Revisions, current), nil
+}
+
+// 已撤回的消息不返回消息内容
+func tombstone(record *model.ChatRecord) {
+	if record.Recalled {
+		record.Message = nil
+	}
+}
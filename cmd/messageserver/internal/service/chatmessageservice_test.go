@@ -0,0 +1,40 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/mangohow/imchat/pkg/model"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestReadReceipts(t *testing.T) {
+	older := &model.ChatRecord{Id: primitive.NewObjectID(), Sender: 1, Receiver: 3, CreateTime: 100}
+	newer := &model.ChatRecord{Id: primitive.NewObjectID(), Sender: 1, Receiver: 3, CreateTime: 200}
+	other := &model.ChatRecord{Id: primitive.NewObjectID(), Sender: 2, Receiver: 3, CreateTime: 150}
+
+	receipts := readReceipts(3, []*model.ChatRecord{newer, other, older}, 999)
+	if len(receipts) != 2 {
+		t.Fatalf("want one receipt per sender, got %d", len(receipts))
+	}
+	for _, r := range receipts {
+		if r.Reader != 3 || r.ReadTime != 999 {
+			t.Fatalf("unexpected receipt %+v", r)
+		}
+		switch r.Sender {
+		case 1:
+			if r.MessageId != newer.Id.Hex() || r.ReadUpTo != 200 {
+				t.Fatalf("want latest message of sender 1, got %+v", r)
+			}
+		case 2:
+			if r.MessageId != other.Id.Hex() || r.ReadUpTo != 150 {
+				t.Fatalf("unexpected receipt for sender 2: %+v", r)
+			}
+		default:
+			t.Fatalf("unexpected sender %d", r.Sender)
+		}
+	}
+
+	if receipts := readReceipts(3, nil, 999); len(receipts) != 0 {
+		t.Fatalf("no records should produce no receipts, got %d", len(receipts))
+	}
+}
@@ -0,0 +1,61 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strconv"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/mangohow/imchat/cmd/messageserver/internal/log"
+	"github.com/mangohow/imchat/cmd/messageserver/internal/mongodb"
+	"github.com/mangohow/imchat/cmd/messageserver/internal/rdsconn"
+	"github.com/mangohow/imchat/pkg/consts/redisconsts"
+	"github.com/mangohow/imchat/pkg/model"
+	"github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type GroupMessageService struct {
+	db     *mongo.Collection
+	redis  *redis.Client
+	logger *logrus.Logger
+}
+
+func NewGroupMessageService() *GroupMessageService {
+	return &GroupMessageService{
+		db:     mongodb.MongoDB.Collection("groupChat"),
+		redis:  rdsconn.RedisConn(),
+		logger: log.Logger(),
+	}
+}
+
+var NotGroupMemberError = errors.New("not group member")
+
+// GetMessage 获取群聊天记录, 只有群成员可以查看
+func (s *GroupMessageService) GetMessage(id int64, groupId int64, pageSize int, createTime int64) (records []model.GroupChatRecord, err error) {
+	key := redisconsts.GroupMembersKey + strconv.Itoa(int(groupId))
+	isMember, err := s.redis.SIsMember(context.Background(), key, id).Result()
+	if err != nil {
+		return nil, err
+	}
+	if !isMember {
+		return nil, NotGroupMemberError
+	}
+
+	filter := bson.M{"groupId": groupId}
+	if createTime != -1 {
+		filter["createTime"] = bson.M{"$lt": createTime}
+	}
+	// 按照createTime降序排序，获取最新数据
+	sort := bson.M{"createTime": -1}
+	opts := options.Find().SetLimit(int64(pageSize)).SetSort(sort)
+	res, err := s.db.Find(context.Background(), filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	err = res.All(context.Background(), &records)
+
+	return
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"net/http"
@@ -8,9 +9,13 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/mangohow/easygin"
 	"github.com/mangohow/imchat/cmd/messageserver/internal/conf"
+	"github.com/mangohow/imchat/cmd/messageserver/internal/job"
 	"github.com/mangohow/imchat/cmd/messageserver/internal/log"
 	"github.com/mangohow/imchat/cmd/messageserver/internal/mongodb"
+	"github.com/mangohow/imchat/cmd/messageserver/internal/mq"
+	"github.com/mangohow/imchat/cmd/messageserver/internal/rdsconn"
 	"github.com/mangohow/imchat/cmd/messageserver/internal/routes"
+	"github.com/mangohow/imchat/pkg/common/xtls"
 )
 
 func main() {
@@ -28,6 +33,21 @@ func main() {
 		panic(fmt.Errorf("init mongodb error:%v", err))
 	}
 
+	// 初始化redis
+	if err := rdsconn.InitRedis(); err != nil {
+		panic(fmt.Errorf("init rdsconn failed, reason:%s", err.Error()))
+	}
+
+	// 初始化消息队列, 用于推送已读回执等通知
+	if err := mq.InitMQ(); err != nil {
+		panic(fmt.Errorf("init mq error:%v", err))
+	}
+
+
+	// 定时删除双方都已经删除的消息
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	job.StartMessageCleaner(ctx, conf.MessageConf.CleanInterval)
 
 	// 创建gin路由
 	easyGin := easygin.NewWithEngine(gin.Default())
@@ -36,7 +56,15 @@ func main() {
 	// 注册路由
 	routes.Register(easyGin)
 
-	err := easyGin.ListenAndServe(fmt.Sprintf("%s:%d", conf.ServerConf.Host, conf.ServerConf.Port))
+	// 配置了证书时使用https
+	tlsConfig, err := xtls.NewServerConfig(ctx, conf.ServerConf, func(err error) {
+		log.Logger().Errorf("reload certificate error:%v", err)
+	})
+	if err != nil {
+		panic(fmt.Errorf("init tls error, reason:%v", err))
+	}
+
+	err = xtls.ServeEasyGin(easyGin, fmt.Sprintf("%s:%d", conf.ServerConf.Host, conf.ServerConf.Port), tlsConfig)
 	if err != nil {
 		if err == http.ErrServerClosed {
 			fmt.Println("server closed")
@@ -4,7 +4,6 @@ import (
 	"bufio"
 	"bytes"
 	"context"
-	"encoding/binary"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -15,10 +14,13 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/elliotchance/pie/v2"
+	"github.com/google/uuid"
 	"github.com/gorilla/websocket"
+	"github.com/mangohow/imchat/pkg/common/xframe"
 	"github.com/mangohow/imchat/pkg/consts"
 	"github.com/mangohow/imchat/pkg/model"
 	"github.com/mangohow/imchat/pkg/utils"
@@ -49,6 +51,27 @@ type ChatClient struct {
 	messageCounter uint32
 
 	writeMux sync.Mutex
+
+	// 设备ID, 同一用户可以在多个设备上同时登录
+	device string
+
+	// 握手时协商permessage-deflate
+	deflate bool
+
+	// 在线的好友, 登录时查询一次, 之后由服务器推送更新
+	onlineFriends map[int64]struct{}
+	onlineMux sync.Mutex
+
+	// 请求ID, 服务器在响应中带回, 用于匹配响应对应的请求
+	requestId atomic.Uint32
+	// 等待响应的请求: 请求ID -> 消息ID
+	pending map[uint32]uint32
+	pendingMux sync.Mutex
+
+	// 收到的最后一条系统公告的发布时间(毫秒)和id, 推送和拉取的公告都会更新, 拉取时只拉取之后的
+	lastAnnouncementTime int64
+	lastAnnouncementId string
+	announcementMux sync.Mutex
 }
 
 func NewChatClient(addr string) *ChatClient {
@@ -59,6 +82,9 @@ func NewChatClient(addr string) *ChatClient {
 		friendsMap: make(map[int64]model.FriendDTO),
 		messageHandler: NewMessageHandler(),
 		wsAddr: addr,
+		device: uuid.New().String(),
+		onlineFriends: make(map[int64]struct{}),
+		pending: make(map[uint32]uint32),
 	}
 }
 
@@ -70,6 +96,18 @@ func (c *ChatClient) Register() {
 	c.messageHandler.Register(consts.SingleChatMessage, c.HandleSingleChatMessage)
 	c.messageHandler.Register(consts.SingleChatAck, c.HandleSingleChatAck)
 	c.messageHandler.Register(consts.NewMessage, c.HandleNewMessage)
+	c.messageHandler.Register(consts.GroupChatMessage, c.HandleGroupChatMessage)
+	c.messageHandler.Register(consts.GroupChatAck, c.HandleGroupChatAck)
+	c.messageHandler.Register(consts.FriendPresence, c.HandleFriendPresence)
+	c.messageHandler.Register(consts.TypingMessage, c.HandleTyping)
+	c.messageHandler.Register(consts.ReadReceipt, c.HandleReadReceipt)
+	c.messageHandler.Register(consts.RecallMessage, c.HandleRecall)
+	c.messageHandler.Register(consts.RecallAck, c.HandleRecallAck)
+	c.messageHandler.Register(consts.EditMessage, c.HandleEdit)
+	c.messageHandler.Register(consts.EditAck, c.HandleEditAck)
+	c.messageHandler.Register(consts.ErrorMessage, c.HandleError)
+	c.messageHandler.Register(consts.ReconnectNotify, c.HandleReconnect)
+	c.messageHandler.Register(consts.SystemAnnouncement, c.HandleAnnouncement)
 }
 
 func (c *ChatClient) Test(username, password string) {
@@ -98,6 +136,7 @@ func (c *ChatClient) Test(username, password string) {
 	}
 
 	c.pullOfflineMessage()
+	c.pullAnnouncements()
 
 	go c.startReader()
 }
@@ -127,6 +166,7 @@ func (c *ChatClient) Login(username, password string) {
 	}
 
 	c.pullOfflineMessage()
+	c.pullAnnouncements()
 
 	log.Printf("[self id] %d", c.user.Id)
 	c.HandleMessage()
@@ -156,31 +196,16 @@ func (c *ChatClient) getFriends() []model.FriendDTO {
 	return f.Data
 }
 
-func (c *ChatClient) getOnlineFriends() []int64 {
-	request, err := http.NewRequest(http.MethodGet, "http://127.0.0.1:8080/api/auth/onlineFriends", nil)
-	if err != nil {
-		log.Printf("new request error:%v", err)
-		return nil
+func (c *ChatClient) setFriendOnline(id int64, online bool) {
+	c.onlineMux.Lock()
+	if online {
+		c.onlineFriends[id] = struct{}{}
+	} else {
+		delete(c.onlineFriends, id)
 	}
-	request.Header.Set("authorization", c.token)
-	response, err := c.httpClient.Do(request)
-	if err != nil {
-		log.Printf("do http request error:%v", err)
-		return nil
-	}
-	data, _ := io.ReadAll(response.Body)
-	response.Body.Close()
-	var f Response[[]int64]
-	err = json.Unmarshal(data, &f)
-	if err != nil {
-		log.Printf("marshal json error:%v", err)
-		return nil
-	}
-
-	return f.Data
+	c.onlineMux.Unlock()
 }
 
-
 func (c *ChatClient) loginHttp(username, password string) (string, error) {
 	user := &model.UserLogin{
 		Username: username,
@@ -222,10 +247,24 @@ func (c *ChatClient) loginHttp(username, password string) (string, error) {
 }
 
 
+// SetDeflate 握手时是否协商permessage-deflate, 不协商时服务器会对大消息进行应用层压缩
+func (c *ChatClient) SetDeflate(deflate bool) {
+	c.deflate = deflate
+}
+
+func (c *ChatClient) dialer() *websocket.Dialer {
+	dialer := *websocket.DefaultDialer
+	dialer.EnableCompression = c.deflate
+	// 声明客户端支持的协议版本
+	dialer.Subprotocols = []string{consts.Subprotocol(consts.MaxProtocolVersion)}
+	return &dialer
+}
+
 func (c *ChatClient) loginWebSocket(token string) error {
-	dialer := websocket.DefaultDialer
-	conn, _, err := dialer.Dial(fmt.Sprintf("ws://%s/ws/chat", c.wsAddr), map[string][]string{
+	conn, _, err := c.dialer().Dial(fmt.Sprintf("ws://%s/ws/chat", c.wsAddr), map[string][]string{
 		"authorization": {token},
+		"platform": {"pc"},
+		"device": {c.device},
 	})
 	if err != nil {
 		return fmt.Errorf("dial websocket error:%v", err)
@@ -257,16 +296,41 @@ func (c *ChatClient) startReader() {
 	for {
 		_, p, err := c.wsConn.ReadMessage()
 		if err != nil {
+			if websocket.IsCloseError(err, consts.CloseLoggedInElsewhere) {
+				fmt.Println("账号在其它地方登录, 已下线")
+				os.Exit(0)
+			}
+			if websocket.IsCloseError(err, consts.CloseUnsupportedVersion) {
+				fmt.Println("客户端版本过低, 请升级")
+				os.Exit(0)
+			}
+			if websocket.IsCloseError(err, websocket.CloseServiceRestart) {
+				fmt.Println("服务器正在重启, 请重新登录")
+				os.Exit(0)
+			}
 			log.Printf("read message error:%v", err)
+			return
 		}
 
-		id := binary.LittleEndian.Uint32(p[:4])
-		if len(p) == 4 {
-			c.messageHandler.Handle(id,nil)
-		} else {
-			c.messageHandler.Handle(id, p[4:])
-		}
+		c.handleFrame(p)
+	}
+}
 
+// 处理服务器发送的帧, 服务器可能发送旧格式或V1格式的帧, 压缩过的数据由xframe解压
+func (c *ChatClient) handleFrame(p []byte) {
+	header, body, err := xframe.Decode(p)
+	if err != nil {
+		log.Printf("decode frame error:%v", err)
+		return
+	}
+	if header.HasFlag(xframe.FlagResponse) {
+		c.completeRequest(header)
+	}
+
+	if len(body) == 0 {
+		c.messageHandler.Handle(header.MsgId, nil)
+	} else {
+		c.messageHandler.Handle(header.MsgId, body)
 	}
 }
 
@@ -309,10 +373,12 @@ func (c *ChatClient) handleSendMessage() {
 	fmt.Println("输入接收者索引号：")
 	str, _ := c.stdInReader.ReadString('\n')
 	idx, _ := strconv.Atoi(str)
+	receiver := c.friends[idx].Userinfo.Id
 	fmt.Println("输入消息：")
+	c.SendTyping(receiver, true)
 	message, _ := c.stdInReader.ReadBytes('\n')
 	message = bytes.Trim(message, "\r\n")
-	receiver := c.friends[idx].Userinfo.Id
+	c.SendTyping(receiver, false)
 
 	seq := time.Now().Unix()
 	seq <<= 32
@@ -350,19 +416,111 @@ func (c *ChatClient) SendMessageTo(id int64, message []byte) {
 	c.WriteProtoMessage(consts.SingleChatMessage, msg)
 }
 
+// SendTyping 通知对方正在输入/停止输入
+func (c *ChatClient) SendTyping(id int64, typing bool) {
+	msg := &pb.Typing{
+		Sender:   c.user.Id,
+		Receiver: id,
+		Typing:   typing,
+	}
+
+	err := c.WriteProtoMessage(consts.TypingMessage, msg)
+	if err != nil {
+		log.Printf("write proto message error:%v", err)
+	}
+}
+
+// RecallMessage 撤回自己发送的消息
+func (c *ChatClient) RecallMessage(messageId string) {
+	err := c.WriteProtoMessage(consts.RecallMessage, &pb.Recall{MessageId: messageId})
+	if err != nil {
+		log.Printf("write proto message error:%v", err)
+	}
+}
+
+// EditMessage 编辑自己发送的文本消息
+func (c *ChatClient) EditMessage(messageId string, message []byte) {
+	err := c.WriteProtoMessage(consts.EditMessage, &pb.Edit{MessageId: messageId, Message: message})
+	if err != nil {
+		log.Printf("write proto message error:%v", err)
+	}
+}
+
+func (c *ChatClient) SendGroupMessageTo(groupId int64, message []byte) {
+	seq := time.Now().Unix()
+	seq <<= 32
+	seq |= int64(c.messageCounter)
+	c.messageCounter++
+
+	msg := &pb.GroupChat{
+		MsgSeq:  seq,
+		Sender:  c.user.Id,
+		Group:   groupId,
+		MsgType: pb.MsgType_Text,
+		Message: message,
+	}
+
+	c.WriteProtoMessage(consts.GroupChatMessage, msg)
+}
+
+// WriteProtoMessage 使用V1帧发送请求, 每个请求带上一个新的请求ID
 func (c *ChatClient) WriteProtoMessage(id uint32, message proto.Message) error {
-	buf := make([]byte, 4)
-	binary.LittleEndian.PutUint32(buf, id)
 	data, err := proto.Marshal(message)
 	if err != nil {
 		return err
 	}
-	data = append(buf, data...)
+
+	requestId := c.requestId.Add(1)
+	data = xframe.Encode(xframe.Header{
+		Version:   xframe.CurrentVersion,
+		MsgId:     id,
+		RequestId: requestId,
+	}, data)
+
+	_, expectResp := responseIds[id]
+	if expectResp {
+		c.pendingMux.Lock()
+		c.pending[requestId] = id
+		c.pendingMux.Unlock()
+	}
 
 	c.writeMux.Lock()
 	defer c.writeMux.Unlock()
 
-	return c.wsConn.WriteMessage(websocket.BinaryMessage, data)
+	err = c.wsConn.WriteMessage(websocket.BinaryMessage, data)
+	if err != nil && expectResp {
+		c.pendingMux.Lock()
+		delete(c.pending, requestId)
+		c.pendingMux.Unlock()
+	}
+
+	return err
+}
+
+// 服务器会响应的请求: 请求的消息ID -> 响应的消息ID
+var responseIds = map[uint32]uint32{
+	consts.HelloRequest:      consts.HelloReply,
+	consts.SingleChatMessage: consts.SingleChatAck,
+	consts.GroupChatMessage:  consts.GroupChatAck,
+	consts.RecallMessage:     consts.RecallAck,
+	consts.EditMessage:       consts.EditAck,
+}
+
+// 收到响应, 从等待响应的请求中移除
+// 任何请求都可能收到错误帧, 通过请求ID找到是哪个请求失败了
+func (c *ChatClient) completeRequest(header xframe.Header) {
+	c.pendingMux.Lock()
+	id, ok := c.pending[header.RequestId]
+	delete(c.pending, header.RequestId)
+	c.pendingMux.Unlock()
+
+	if header.MsgId == consts.ErrorMessage {
+		log.Printf("request %d failed, message id:%d", header.RequestId, id)
+		return
+	}
+	if !ok || responseIds[id] != header.MsgId {
+		log.Printf("unexpected response, request id:%d, message id:%d", header.RequestId, header.MsgId)
+	}
 }
 
 func (c *ChatClient) handleShowFriends() {
@@ -370,16 +528,13 @@ func (c *ChatClient) handleShowFriends() {
 		return
 	}
 
-	onlineFriends := c.getOnlineFriends()
-	m := map[int64]struct{}{}
-	for i := range onlineFriends {
-		m[onlineFriends[i]] = struct{}{}
-	}
+	c.onlineMux.Lock()
+	defer c.onlineMux.Unlock()
 
 	for i, friend := range c.friends {
 		fmt.Printf("[%d] id:%d\tusername:%s\tremark:%s",
 			i, friend.Userinfo.Id, friend.Userinfo.Username, friend.Remark)
-		if _, ok := m[friend.Userinfo.Id]; ok {
+		if _, ok := c.onlineFriends[friend.Userinfo.Id]; ok {
 			fmt.Println("\t[online]")
 		} else {
 			fmt.Println()
@@ -389,20 +544,9 @@ func (c *ChatClient) handleShowFriends() {
 }
 
 func (c *ChatClient) sendHello() {
-	buf := make([]byte, 4)
-	binary.LittleEndian.PutUint32(buf, consts.HelloRequest)
 	hello := &pb.Hello{Message: "hello, chat server"}
 
-	buffer := bytes.NewBuffer(buf)
-	helloData, err := proto.Marshal(hello)
-	if err != nil {
-		panic(err)
-	}
-	buffer.Write(helloData)
-
-	c.writeMux.Lock()
-	defer c.writeMux.Unlock()
-	err = c.wsConn.WriteMessage(websocket.BinaryMessage, buffer.Bytes())
+	err := c.WriteProtoMessage(consts.HelloRequest, hello)
 	if err != nil {
 		log.Printf("send hello error")
 	}
@@ -466,6 +610,67 @@ func (c *ChatClient) pullOfflineMessage() {
 	c.PrintMessagesMap(messages.Data)
 }
 
+// 拉取离线期间发布的系统公告, 从收到的最后一条公告之后开始拉取
+func (c *ChatClient) pullAnnouncements() {
+	for c.pullAnnouncementPage() {
+	}
+}
+
+// 拉取一页公告, 返回是否还有更多
+func (c *ChatClient) pullAnnouncementPage() bool {
+	url := "http://127.0.0.1:8081/api/message/announcements"
+	c.announcementMux.Lock()
+	if c.lastAnnouncementId != "" {
+		url = fmt.Sprintf("%s?since=%d&lastId=%s", url, c.lastAnnouncementTime, c.lastAnnouncementId)
+	}
+	c.announcementMux.Unlock()
+	request, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		log.Printf("new request error:%v", err)
+		return false
+	}
+	request.Header.Set("authorization", c.token)
+	response, err := c.httpClient.Do(request)
+	if err != nil {
+		log.Printf("do http error:%v", err)
+		return false
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		log.Printf("get announcements error:%v", response.Status)
+		return false
+	}
+
+	var page Response[model.AnnouncementPage]
+	if err = json.NewDecoder(response.Body).Decode(&page); err != nil {
+		log.Printf("unmarshal json error:%v", err)
+		return false
+	}
+	if page.Code != 0 {
+		log.Printf("get announcements failed:%s", page.Message)
+		return false
+	}
+
+	for _, a := range page.Data.Announcements {
+		c.printAnnouncement(a.Id.Hex(), a.Title, a.Content, a.CreateTime)
+	}
+	return page.Data.HasMore
+}
+
+// 打印公告并移动收到的位置, 公告按(createTime, id)排序, 不在位置之后的已经收到过
+func (c *ChatClient) printAnnouncement(id, title, content string, createTime int64) {
+	c.announcementMux.Lock()
+	if createTime < c.lastAnnouncementTime || (createTime == c.lastAnnouncementTime && id <= c.lastAnnouncementId) {
+		c.announcementMux.Unlock()
+		return
+	}
+	c.lastAnnouncementTime, c.lastAnnouncementId = createTime, id
+	c.announcementMux.Unlock()
+
+	t := time.UnixMilli(createTime).Format(time.DateTime)
+	fmt.Printf("[公告 %s] %s\n%s\n", t, title, content)
+}
+
 // 更新离线消息为已读
 func (c *ChatClient) updateOfflineMessageStatus(ids []string) {
 	reqData, err := json.Marshal(ids)
@@ -501,7 +706,11 @@ func (c *ChatClient) PrintMessagesMap(msgs map[int64][]model.ChatRecord) {
 		fmt.Printf("------------SenderId:%d---------------\n", sender)
 		for _, msg := range msgs {
 			t := time.UnixMicro(msg.CreateTime).Format(time.DateTime)
-			fmt.Printf("[Sender:%s %s] %s\n", friend.Remark, t, msg.Message)
+			if msg.Recalled {
+				fmt.Printf("[Sender:%s %s] [消息已撤回]\n", friend.Remark, t)
+				continue
+			}
+			fmt.Printf("[Sender:%s %s] %s%s\n", friend.Remark, t, msg.Message, editedMark(&msg))
 		}
 		fmt.Println("------------end---------------")
 	}
@@ -525,17 +734,27 @@ func (c *ChatClient) PrintMessagesSlice(msgs []model.ChatRecord) {
 
 
 		t := time.UnixMicro(msg.CreateTime).Format(time.DateTime)
-		fmt.Printf("[Sender:%s %s] %s\n", name, t, msg.Message)
+		if msg.Recalled {
+			fmt.Printf("[Sender:%s %s] [消息已撤回]\n", name, t)
+			continue
+		}
+		fmt.Printf("[Sender:%s %s] %s%s\n", name, t, msg.Message, editedMark(&msg))
 	}
 }
 
 func (c *ChatClient) PrintMessageProto(msg *pb.SingleChat) {
+	t := time.UnixMicro(msg.CreateTime).Format(time.DateTime)
+	// 自己在其它设备上发送的消息
+	if msg.Sender == c.user.Id {
+		fmt.Printf("[Sender:self To:%d %s] %s\n", msg.Receiver, t, msg.Message)
+		return
+	}
+
 	friend, ok := c.friendsMap[msg.Sender]
 	if !ok {
 		log.Printf("can not find friend, sender:%d", msg.Sender)
 		return
 	}
-	t := time.UnixMicro(msg.CreateTime).Format(time.DateTime)
 	fmt.Printf("[Sender:%s %s] %s\n", friend.Remark, t, msg.Message)
 }
 
@@ -574,20 +793,24 @@ func (c *ChatClient) showHistoryMessage() {
 		buf := make([]byte, response.ContentLength)
 		response.Body.Read(buf)
 		response.Body.Close()
-		var messages Response[[]model.ChatRecord]
-		err = json.Unmarshal(buf, &messages)
+		var history Response[model.ChatHistory]
+		err = json.Unmarshal(buf, &history)
 		if err != nil {
 			log.Printf("unmarshal json error:%v", err)
 			return
 		}
 
-		if len(messages.Data) == 0 {
+		records := history.Data.Records
+		if len(records) == 0 {
 			fmt.Println("没有更多消息了")
 			return
 		}
 
-		createTime = messages.Data[len(messages.Data)-1].CreateTime
-		c.PrintMessagesSlice(pie.Reverse(messages.Data))
+		createTime = records[len(records)-1].CreateTime
+		c.PrintMessagesSlice(pie.Reverse(records))
+		if state := history.Data.ReadState; state != nil && state.MessageId != "" {
+			fmt.Printf("[对方已读到 %s]\n", time.UnixMicro(state.ReadUpTo).Format("2006-01-02 15:04:05"))
+		}
 
 		fmt.Println("继续查看：n, 结束：q")
 		str, err := c.stdInReader.ReadString('\n')
@@ -604,4 +827,11 @@ func (c *ChatClient) showHistoryMessage() {
 			return
 		}
 	}
-}
\ No newline at end of file
+}
+
+func editedMark(msg *model.ChatRecord) string {
+	if msg.Edited {
+		return " (已编辑)"
+	}
+	return ""
+}
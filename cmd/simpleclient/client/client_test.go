@@ -0,0 +1,83 @@
+package client
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/websocket"
+	"github.com/mangohow/imchat/pkg/common/xframe"
+	"github.com/mangohow/imchat/pkg/common/xwebsocket"
+	"github.com/mangohow/imchat/pkg/consts"
+)
+
+func TestHandleCompressedFrame(t *testing.T) {
+	c := NewChatClient("")
+	var received []byte
+	c.messageHandler.Register(consts.SingleChatMessage, func(data []byte) {
+		received = data
+	})
+
+	body := bytes.Repeat([]byte("hello "), 1000)
+	compressed, err := xframe.Compress(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	frames := map[string][]byte{
+		"v0":         xframe.Encode(xframe.Header{MsgId: consts.SingleChatMessage}, body),
+		"v1":         xframe.Encode(xframe.Header{Version: xframe.Version1, MsgId: consts.SingleChatMessage}, body),
+		"compressed": xframe.Encode(xframe.Header{Version: xframe.Version1, Flags: xframe.FlagCompressed, MsgId: consts.SingleChatMessage}, compressed),
+	}
+	for name, frame := range frames {
+		received = nil
+		c.handleFrame(frame)
+		if !bytes.Equal(received, body) {
+			t.Fatalf("%s: unexpected body, len:%d", name, len(received))
+		}
+	}
+
+	// 损坏的压缩数据不会交给handler
+	received = nil
+	c.handleFrame(xframe.Encode(xframe.Header{Version: xframe.Version1, Flags: xframe.FlagCompressed, MsgId: consts.SingleChatMessage}, []byte{0xff, 0xff}))
+	if received != nil {
+		t.Fatal("corrupt frame should be dropped")
+	}
+}
+
+func TestDeflateNegotiation(t *testing.T) {
+	negotiated := make(chan bool, 1)
+	ws := xwebsocket.New("/ws/chat")
+	ws.EnableCompression = true
+	ws.HandleWebSocket(func(conn *websocket.Conn, r *http.Request) {
+		negotiated <- ws.CompressionNegotiated(r)
+		_ = conn.WriteMessage(websocket.BinaryMessage, bytes.Repeat([]byte("a"), 4096))
+		_, _, _ = conn.ReadMessage()
+	})
+	server := httptest.NewServer(ws.Handler)
+	defer server.Close()
+	url := "ws" + strings.TrimPrefix(server.URL, "http") + "/ws/chat"
+
+	for _, deflate := range []bool{false, true} {
+		c := NewChatClient("")
+		c.SetDeflate(deflate)
+		conn, resp, err := c.dialer().Dial(url, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		ext := resp.Header.Get("Sec-Websocket-Extensions")
+		if strings.Contains(ext, "permessage-deflate") != deflate {
+			t.Fatalf("deflate:%v, unexpected extensions:%q", deflate, ext)
+		}
+		if <-negotiated != deflate {
+			t.Fatalf("deflate:%v, server negotiated mismatch", deflate)
+		}
+		if _, p, err := conn.ReadMessage(); err != nil || len(p) != 4096 {
+			t.Fatalf("read message error:%v, len:%d", err, len(p))
+		}
+		conn.Close()
+	}
+}
@@ -5,6 +5,8 @@ import (
 	"encoding/binary"
 	"fmt"
 	"log"
+	"strconv"
+	"time"
 
 	"github.com/gorilla/websocket"
 	"github.com/mangohow/imchat/pkg/consts"
@@ -20,6 +22,12 @@ func (c *ChatClient) HandleSingleChatMessage(data []byte) {
 		return
 	}
 
+	// 自己在其它设备上发送的消息不需要确认
+	if message.Sender == c.user.Id {
+		c.PrintMessageProto(message)
+		return
+	}
+
 	// 确认消息
 	ack := &pb.ChatAck{
 		MessageSeq: message.MessageSeq,
@@ -54,4 +62,188 @@ func (c *ChatClient) HandleSingleChatAck(data []byte) {
 func (c *ChatClient) HandleNewMessage(data []byte) {
 	log.Printf("new message, need to pull offline")
 	c.pullOfflineMessage()
-}
\ No newline at end of file
+}
+
+func (c *ChatClient) HandleGroupChatMessage(data []byte) {
+	message := new(pb.GroupChat)
+	err := proto.Unmarshal(data, message)
+	if err != nil {
+		log.Printf("proto marshal error:%v", err)
+		return
+	}
+
+	t := time.UnixMicro(message.CreateTime).Format(time.DateTime)
+	fmt.Printf("[Group:%d Sender:%d %s] %s\n", message.Group, message.Sender, t, message.Message)
+}
+
+func (c *ChatClient) HandleGroupChatAck(data []byte) {
+	ack := new(pb.ChatAck)
+	err := proto.Unmarshal(data, ack)
+	if err != nil {
+		log.Printf("proto marshal error:%v", err)
+		return
+	}
+
+	fmt.Printf("[server received group message:%d]\n", ack.MessageSeq)
+}
+func (c *ChatClient) HandleFriendPresence(data []byte) {
+	presence := new(pb.Presence)
+	err := proto.Unmarshal(data, presence)
+	if err != nil {
+		log.Printf("proto marshal error:%v", err)
+		return
+	}
+
+	c.setFriendOnline(presence.Uid, presence.Online)
+	// 登录时推送的当前状态, 不打印
+	if presence.Snapshot {
+		return
+	}
+
+	name := strconv.Itoa(int(presence.Uid))
+	if friend, ok := c.friendsMap[presence.Uid]; ok {
+		name = friend.Userinfo.Username
+	}
+	if presence.Online {
+		fmt.Printf("[%s online]\n", name)
+	} else {
+		fmt.Printf("[%s offline]\n", name)
+	}
+}
+
+func (c *ChatClient) HandleTyping(data []byte) {
+	typing := new(pb.Typing)
+	err := proto.Unmarshal(data, typing)
+	if err != nil {
+		log.Printf("proto marshal error:%v", err)
+		return
+	}
+
+	name := strconv.Itoa(int(typing.Sender))
+	if friend, ok := c.friendsMap[typing.Sender]; ok {
+		name = friend.Userinfo.Username
+	}
+	if typing.Typing {
+		fmt.Printf("[%s 正在输入...]\n", name)
+	} else {
+		fmt.Printf("[%s 停止输入]\n", name)
+	}
+}
+
+func (c *ChatClient) HandleReadReceipt(data []byte) {
+	receipt := new(pb.ReadReceipt)
+	err := proto.Unmarshal(data, receipt)
+	if err != nil {
+		log.Printf("proto marshal error:%v", err)
+		return
+	}
+
+	name := strconv.Itoa(int(receipt.Reader))
+	if friend, ok := c.friendsMap[receipt.Reader]; ok {
+		name = friend.Userinfo.Username
+	}
+	t := time.UnixMicro(receipt.ReadUpTo).Format(time.DateTime)
+	fmt.Printf("[%s 已读 %s 之前的消息]\n", name, t)
+}
+
+func (c *ChatClient) HandleRecall(data []byte) {
+	recall := new(pb.Recall)
+	err := proto.Unmarshal(data, recall)
+	if err != nil {
+		log.Printf("proto marshal error:%v", err)
+		return
+	}
+
+	name := "self"
+	if recall.Sender != c.user.Id {
+		name = strconv.Itoa(int(recall.Sender))
+		if friend, ok := c.friendsMap[recall.Sender]; ok {
+			name = friend.Userinfo.Username
+		}
+	}
+	fmt.Printf("[%s 撤回了一条消息:%s]\n", name, recall.MessageId)
+}
+
+func (c *ChatClient) HandleRecallAck(data []byte) {
+	ack := new(pb.RecallAck)
+	err := proto.Unmarshal(data, ack)
+	if err != nil {
+		log.Printf("proto marshal error:%v", err)
+		return
+	}
+
+	if ack.Code != 0 {
+		fmt.Printf("[recall message %s failed, code:%d]\n", ack.MessageId, ack.Code)
+		return
+	}
+	fmt.Printf("[message recalled:%s]\n", ack.MessageId)
+}
+
+func (c *ChatClient) HandleEdit(data []byte) {
+	edit := new(pb.Edit)
+	err := proto.Unmarshal(data, edit)
+	if err != nil {
+		log.Printf("proto marshal error:%v", err)
+		return
+	}
+
+	name := "self"
+	if edit.Sender != c.user.Id {
+		name = strconv.Itoa(int(edit.Sender))
+		if friend, ok := c.friendsMap[edit.Sender]; ok {
+			name = friend.Userinfo.Username
+		}
+	}
+	t := time.UnixMicro(edit.EditedAt).Format(time.DateTime)
+	fmt.Printf("[%s %s 编辑了消息:%s] %s\n", name, t, edit.MessageId, edit.Message)
+}
+
+func (c *ChatClient) HandleEditAck(data []byte) {
+	ack := new(pb.EditAck)
+	err := proto.Unmarshal(data, ack)
+	if err != nil {
+		log.Printf("proto marshal error:%v", err)
+		return
+	}
+
+	if ack.Code != 0 {
+		fmt.Printf("[edit message %s failed, code:%d]\n", ack.MessageId, ack.Code)
+		return
+	}
+	fmt.Printf("[message edited:%s]\n", ack.MessageId)
+}
+
+func (c *ChatClient) HandleError(data []byte) {
+	e := new(pb.Error)
+	err := proto.Unmarshal(data, e)
+	if err != nil {
+		log.Printf("proto marshal error:%v", err)
+		return
+	}
+
+	fmt.Printf("[request %d failed, code:%d] %s\n", e.MsgId, e.Code, e.Message)
+}
+
+// HandleReconnect 服务器即将关闭, 之后会关闭连接
+func (c *ChatClient) HandleReconnect(data []byte) {
+	r := new(pb.Reconnect)
+	err := proto.Unmarshal(data, r)
+	if err != nil {
+		log.Printf("proto marshal error:%v", err)
+		return
+	}
+
+	fmt.Printf("[server] %s, reconnect to %s\n", r.Reason, r.Address)
+}
+
+// HandleAnnouncement 服务器推送的系统公告
+func (c *ChatClient) HandleAnnouncement(data []byte) {
+	a := new(pb.Announcement)
+	err := proto.Unmarshal(data, a)
+	if err != nil {
+		log.Printf("proto marshal error:%v", err)
+		return
+	}
+
+	c.printAnnouncement(a.Id, a.Title, a.Content, a.CreateTime)
+}
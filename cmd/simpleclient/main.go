@@ -13,6 +13,7 @@ import (
 
 func main() {
 	addr := flag.String("addr", "127.0.0.1:6387", "specify ws addr")
+	deflate := flag.Bool("deflate", false, "negotiate permessage-deflate")
 	flag.Parse()
 
 	reader := bufio.NewReader(os.Stdin)
@@ -43,6 +44,7 @@ func main() {
 	}
 
 	chatClient := client.NewChatClient(*addr)
+	chatClient.SetDeflate(*deflate)
 	chatClient.Register()
 	chatClient.Login(username, utils.Md5String(password))
 }
@@ -0,0 +1,10 @@
+package xconfig
+
+// AdminConfig chatserver管理接口的配置
+type AdminConfig struct {
+	// 管理接口监听的地址, 端口为0时不启动
+	Host string
+	Port int
+	// 请求需要在authorization header中携带该token, 启动管理接口时必须配置
+	Token string
+}
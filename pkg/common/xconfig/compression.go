@@ -0,0 +1,13 @@
+package xconfig
+
+// CompressionConfig chatserver发送数据的压缩配置
+type CompressionConfig struct {
+	// 握手时协商permessage-deflate
+	Deflate bool
+	// permessage-deflate的压缩级别 1-9
+	Level int
+	// 应用层压缩的最小字节数, 为0时不压缩
+	MinSize int
+	// 需要进行应用层压缩的消息ID
+	MsgIds []uint32
+}
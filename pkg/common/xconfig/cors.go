@@ -0,0 +1,13 @@
+package xconfig
+
+import "time"
+
+// CorsConfig 跨域配置
+type CorsConfig struct {
+	// 允许的Origin, *表示允许所有, 支持https://*.example.com形式的子域名通配, 为空时不允许跨域
+	AllowOrigins []string
+	// 是否允许携带cookie
+	AllowCredentials bool
+	// 预检请求的缓存时间
+	MaxAge time.Duration
+}
@@ -0,0 +1,11 @@
+package xconfig
+
+import "time"
+
+// DrainConfig chatserver关闭时排空连接的配置
+type DrainConfig struct {
+	// 等待客户端断开的最长时间, 超时后直接关闭剩余的连接
+	Timeout time.Duration
+	// 建议客户端重连的服务器地址, 为空时由客户端自己选择
+	Nodes []string
+}
@@ -0,0 +1,13 @@
+package xconfig
+
+import "time"
+
+// HeartbeatConfig chatserver的心跳配置
+type HeartbeatConfig struct {
+	// 在该时间内没有收到任何数据时断开连接, 为0时不检查
+	Timeout time.Duration
+	// 服务器发送ping的间隔, 为0时不发送
+	PingInterval time.Duration
+	// 认证过的连接在该时间内没有发送请求时断开, 为0时不检查
+	IdleTimeout time.Duration
+}
@@ -0,0 +1,11 @@
+package xconfig
+
+import "time"
+
+// MessageConfig 消息相关的配置
+type MessageConfig struct {
+	// 发送后可以撤回消息的时间
+	RecallWindow time.Duration
+	// 清理双方都已经删除的消息的间隔
+	CleanInterval time.Duration
+}
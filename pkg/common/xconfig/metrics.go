@@ -0,0 +1,8 @@
+package xconfig
+
+// MetricsConfig chatserver暴露prometheus指标的配置
+type MetricsConfig struct {
+	// 监听的地址, 端口为0时不启动
+	Host string
+	Port int
+}
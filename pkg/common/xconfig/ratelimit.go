@@ -0,0 +1,24 @@
+package xconfig
+
+import "time"
+
+// RateLimitConfig chatserver请求频率限制的配置
+type RateLimitConfig struct {
+	Enable bool
+	// 在ViolationWindow时间内超过限制的次数达到MaxViolations后断开连接
+	MaxViolations   int
+	ViolationWindow time.Duration
+	// 每种消息的限制
+	Rules []RateLimitRule
+}
+
+// RateLimitRule 令牌桶限流规则, MsgId为0的规则作为没有单独配置的消息的默认规则
+type RateLimitRule struct {
+	MsgId uint32
+	// 每个用户每秒产生的令牌数和桶的容量, Rate为0表示不按用户限制
+	Rate  float64
+	Burst int
+	// 每个IP每秒产生的令牌数和桶的容量, IpRate为0表示不按IP限制
+	IpRate  float64
+	IpBurst int
+}
@@ -0,0 +1,12 @@
+package xconfig
+
+import "time"
+
+// RegistryConfig chatserver节点注册的配置
+type RegistryConfig struct {
+	// 租约的有效期, 每1/3有效期续期一次, 为0时不注册, 也不检查其它服务器是否存活
+	LeaseTTL time.Duration
+	// 租约中保存的地址, 排空时建议客户端重连到该地址, 为空时使用server.host:server.port
+	// 监听的地址是0.0.0.0或者在容器中运行时, 需要配置为客户端可以访问的地址
+	AdvertiseAddr string
+}
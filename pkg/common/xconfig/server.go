@@ -1,9 +1,23 @@
 package xconfig
 
+import "time"
+
 type ServerConfig struct {
 	Host string
 	Port int
 	Name string
 	Mode string
 	NodeId int
+	// chatserver的tcp传输层端口, 为0时不监听
+	TCPPort int
+
+	// TLS证书和私钥的路径, 都配置了时使用https/wss
+	CertFile string
+	KeyFile  string
+	// 验证客户端证书的CA, 配置了时开启双向认证
+	ClientCAFile string
+	// 是否要求客户端必须提供证书, 为false时只验证客户端提供了的证书
+	RequireClientCert bool
+	// 检查证书文件是否变化的间隔, 变化后重新加载
+	CertReloadInterval time.Duration
 }
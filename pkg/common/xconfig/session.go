@@ -0,0 +1,10 @@
+package xconfig
+
+// SessionConfig 多设备登录配置
+type SessionConfig struct {
+	// 多设备登录策略
+	// multi: 允许多个设备同时在线
+	// platform: 每个平台只允许一个设备在线
+	// single: 只允许一个设备在线
+	Policy string
+}
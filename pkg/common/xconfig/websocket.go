@@ -0,0 +1,7 @@
+package xconfig
+
+// WebSocketConfig websocket握手的配置
+type WebSocketConfig struct {
+	// 允许的Origin, 格式同CorsConfig.AllowOrigins, 为空时只允许同源的浏览器连接
+	AllowedOrigins []string
+}
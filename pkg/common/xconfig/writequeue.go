@@ -0,0 +1,15 @@
+package xconfig
+
+import "time"
+
+// WriteQueueConfig chatserver客户端写队列的配置
+type WriteQueueConfig struct {
+	// 写数据到socket的超时时间
+	WriteTimeout time.Duration
+	// 每个连接的写队列最多缓存的字节数
+	MaxQueueBytes int64
+	// 写队列满时的处理策略
+	// disconnect: 丢弃数据并断开连接
+	// spill: 丢弃数据, 通知客户端拉取离线消息
+	SlowConsumerPolicy string
+}
@@ -0,0 +1,106 @@
+package xcors
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mangohow/imchat/pkg/common/xconfig"
+)
+
+// OriginMatcher 检查请求的Origin是否被允许
+// *表示允许所有, https://*.example.com表示允许example.com的所有子域名
+type OriginMatcher struct {
+	all       bool
+	origins   map[string]struct{}
+	wildcards [][2]string
+}
+
+func NewOriginMatcher(origins []string) *OriginMatcher {
+	m := &OriginMatcher{origins: make(map[string]struct{})}
+	for _, origin := range origins {
+		origin = strings.ToLower(strings.TrimSuffix(origin, "/"))
+		switch {
+		case origin == "*":
+			m.all = true
+		case strings.Contains(origin, "://*."):
+			scheme, suffix, _ := strings.Cut(origin, "://*")
+			m.wildcards = append(m.wildcards, [2]string{scheme + "://", suffix})
+		default:
+			m.origins[origin] = struct{}{}
+		}
+	}
+
+	return m
+}
+
+func (m *OriginMatcher) Allow(origin string) bool {
+	if m.all {
+		return true
+	}
+
+	origin = strings.ToLower(origin)
+	if _, ok := m.origins[origin]; ok {
+		return true
+	}
+	for _, w := range m.wildcards {
+		if strings.HasPrefix(origin, w[0]) && strings.HasSuffix(origin, w[1]) && len(origin) > len(w[0])+len(w[1]) {
+			return true
+		}
+	}
+
+	return false
+}
+
+const allowMethods = "GET, POST, PUT, DELETE, OPTIONS"
+
+// Middleware gin的跨域中间件, 需要在权限验证之前注册, 预检请求不会进入后面的处理器
+// 没有配置AllowOrigins时返回nil
+func Middleware(conf *xconfig.CorsConfig) gin.HandlerFunc {
+	if conf == nil || len(conf.AllowOrigins) == 0 {
+		return nil
+	}
+
+	matcher := NewOriginMatcher(conf.AllowOrigins)
+	maxAge := strconv.Itoa(int(conf.MaxAge.Seconds()))
+
+	return func(ctx *gin.Context) {
+		origin := ctx.GetHeader("Origin")
+		if origin == "" {
+			ctx.Next()
+			return
+		}
+
+		preflight := ctx.Request.Method == http.MethodOptions && ctx.GetHeader("Access-Control-Request-Method") != ""
+		if !matcher.Allow(origin) {
+			if preflight {
+				ctx.AbortWithStatus(http.StatusForbidden)
+				return
+			}
+			ctx.Next()
+			return
+		}
+
+		header := ctx.Writer.Header()
+		header.Set("Access-Control-Allow-Origin", origin)
+		header.Add("Vary", "Origin")
+		if conf.AllowCredentials {
+			header.Set("Access-Control-Allow-Credentials", "true")
+		}
+
+		if preflight {
+			header.Set("Access-Control-Allow-Methods", allowMethods)
+			if headers := ctx.GetHeader("Access-Control-Request-Headers"); headers != "" {
+				header.Set("Access-Control-Allow-Headers", headers)
+			}
+			if conf.MaxAge > 0 {
+				header.Set("Access-Control-Max-Age", maxAge)
+			}
+			ctx.AbortWithStatus(http.StatusNoContent)
+			return
+		}
+
+		ctx.Next()
+	}
+}
@@ -0,0 +1,82 @@
+package xcors
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mangohow/imchat/pkg/common/xconfig"
+)
+
+func TestOriginMatcher(t *testing.T) {
+	m := NewOriginMatcher([]string{"https://web.example.com/", "https://*.im.example.com"})
+	cases := map[string]bool{
+		"https://web.example.com":      true,
+		"HTTPS://WEB.EXAMPLE.COM":      true,
+		"http://web.example.com":       false,
+		"https://a.im.example.com":     true,
+		"https://a.b.im.example.com":   true,
+		"https://im.example.com":       false,
+		"https://evilim.example.com":   false,
+		"https://web.example.com.evil": false,
+	}
+	for origin, expect := range cases {
+		if m.Allow(origin) != expect {
+			t.Fatalf("%s: expect %v", origin, expect)
+		}
+	}
+
+	if !NewOriginMatcher([]string{"*"}).Allow("https://any.com") {
+		t.Fatal("* should allow all")
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	if Middleware(&xconfig.CorsConfig{}) != nil {
+		t.Fatal("empty allow origins should disable cors")
+	}
+
+	gin.SetMode(gin.TestMode)
+	engine := gin.New()
+	engine.Use(Middleware(&xconfig.CorsConfig{
+		AllowOrigins:     []string{"https://web.example.com"},
+		AllowCredentials: true,
+		MaxAge:           time.Hour,
+	}))
+	engine.GET("/api/test", func(ctx *gin.Context) {
+		ctx.Status(http.StatusOK)
+	})
+
+	do := func(method, origin string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, "/api/test", nil)
+		r.Header.Set("Origin", origin)
+		if method == http.MethodOptions {
+			r.Header.Set("Access-Control-Request-Method", http.MethodGet)
+			r.Header.Set("Access-Control-Request-Headers", "authorization")
+		}
+		w := httptest.NewRecorder()
+		engine.ServeHTTP(w, r)
+		return w
+	}
+
+	// 预检请求
+	w := do(http.MethodOptions, "https://web.example.com")
+	if w.Code != http.StatusNoContent || w.Header().Get("Access-Control-Allow-Origin") != "https://web.example.com" ||
+		w.Header().Get("Access-Control-Allow-Headers") != "authorization" || w.Header().Get("Access-Control-Max-Age") != "3600" {
+		t.Fatalf("unexpected preflight response: %d %v", w.Code, w.Header())
+	}
+	if w = do(http.MethodOptions, "https://evil.com"); w.Code != http.StatusForbidden {
+		t.Fatalf("expect forbidden, got %d", w.Code)
+	}
+
+	// 普通请求
+	w = do(http.MethodGet, "https://web.example.com")
+	if w.Code != http.StatusOK || w.Header().Get("Access-Control-Allow-Credentials") != "true" {
+		t.Fatalf("unexpected response: %d %v", w.Code, w.Header())
+	}
+	if w = do(http.MethodGet, "https://evil.com"); w.Header().Get("Access-Control-Allow-Origin") != "" {
+		t.Fatal("should not allow evil origin")
+	}
+}
@@ -0,0 +1,55 @@
+package xframe
+
+import (
+	"bytes"
+	"compress/flate"
+	"errors"
+	"io"
+	"sync"
+)
+
+// MaxDecompressedSize 解压后的最大字节数, 防止恶意构造的压缩数据占用大量内存
+const MaxDecompressedSize = 4 << 20
+
+var errTooLarge = errors.New("decompressed data too large")
+
+// flate.Writer创建的开销很大, 需要复用
+var writerPool = sync.Pool{
+	New: func() any {
+		w, _ := flate.NewWriter(nil, flate.BestSpeed)
+		return w
+	},
+}
+
+// Compress 使用deflate压缩数据
+func Compress(data []byte) ([]byte, error) {
+	buf := bytes.NewBuffer(make([]byte, 0, len(data)/2))
+	w := writerPool.Get().(*flate.Writer)
+	defer writerPool.Put(w)
+
+	w.Reset(buf)
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// Decompress 解压deflate数据
+func Decompress(data []byte) ([]byte, error) {
+	r := flate.NewReader(bytes.NewReader(data))
+	defer r.Close()
+
+	res, err := io.ReadAll(io.LimitReader(r, MaxDecompressedSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(res) > MaxDecompressedSize {
+		return nil, errTooLarge
+	}
+
+	return res, nil
+}
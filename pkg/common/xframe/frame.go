@@ -0,0 +1,134 @@
+package xframe
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+/*
+	客户端和服务器之间的帧格式
+
+	V0(旧格式): 4字节小端消息ID + protobuf数据
+	V1: 1字节标志 + 2字节保留 + 1字节版本号 + 4字节小端请求ID + 4字节小端消息ID + protobuf数据
+
+	旧格式的消息ID都小于2^24, 因此第4个字节一定为0, 通过第4个字节即可区分两种格式,
+	过渡期间服务器同时支持两种格式
+	V1帧去掉前8个字节后就是旧格式, 服务器之间通过消息队列转发的数据仍然使用旧格式
+
+	请求ID由客户端生成, 服务器在响应中原样带回, 客户端用它来匹配响应对应的请求
+	设置了FlagCompressed的帧, protobuf数据使用deflate压缩, 只有V1帧可以设置标志
+*/
+
+const (
+	Version0 uint8 = 0
+	Version1 uint8 = 1
+
+	// 当前版本
+	CurrentVersion = Version1
+
+	// 消息ID的长度
+	MessageIdLen = 4
+	// V1帧头的长度
+	HeaderLenV1 = 12
+)
+
+// 帧标志
+const (
+	// FlagResponse 该帧是对客户端请求的响应, RequestId为请求中带的ID
+	FlagResponse uint8 = 1 << iota
+	// FlagCompressed protobuf数据经过了压缩
+	FlagCompressed
+)
+
+var (
+	ErrFrameTooShort      = errors.New("frame too short")
+	ErrUnsupportedVersion = errors.New("unsupported frame version")
+	ErrBadCompressed      = errors.New("bad compressed frame")
+)
+
+type Header struct {
+	Version   uint8
+	Flags     uint8
+	MsgId     uint32
+	RequestId uint32
+}
+
+// Len 帧头的长度
+func (h *Header) Len() int {
+	if h.Version == Version0 {
+		return MessageIdLen
+	}
+	return HeaderLenV1
+}
+
+func (h *Header) HasFlag(flag uint8) bool {
+	return h.Flags&flag != 0
+}
+
+// Decode 解析帧头, 返回帧头和protobuf数据, 压缩过的数据会被解压
+func Decode(data []byte) (Header, []byte, error) {
+	var h Header
+	if len(data) < MessageIdLen {
+		return h, nil, ErrFrameTooShort
+	}
+
+	h.Version = data[3]
+	switch h.Version {
+	case Version0:
+		h.MsgId = binary.LittleEndian.Uint32(data[:MessageIdLen])
+	case Version1:
+		if len(data) < HeaderLenV1 {
+			return h, nil, ErrFrameTooShort
+		}
+		h.Flags = data[0]
+		h.RequestId = binary.LittleEndian.Uint32(data[4:8])
+		h.MsgId = binary.LittleEndian.Uint32(data[8:12])
+	default:
+		return h, nil, ErrUnsupportedVersion
+	}
+
+	body := data[h.Len():]
+	if h.HasFlag(FlagCompressed) {
+		var err error
+		if body, err = Decompress(body); err != nil {
+			return h, nil, ErrBadCompressed
+		}
+	}
+
+	return h, body, nil
+}
+
+// PeekMsgId 只读取帧头中的消息ID, 不解压数据
+func PeekMsgId(data []byte) (uint32, error) {
+	if len(data) < MessageIdLen {
+		return 0, ErrFrameTooShort
+	}
+
+	switch data[3] {
+	case Version0:
+		return binary.LittleEndian.Uint32(data[:MessageIdLen]), nil
+	case Version1:
+		if len(data) < HeaderLenV1 {
+			return 0, ErrFrameTooShort
+		}
+		return binary.LittleEndian.Uint32(data[8:12]), nil
+	}
+
+	return 0, ErrUnsupportedVersion
+}
+
+// Encode 生成帧数据: 帧头 + body
+func Encode(h Header, body []byte) []byte {
+	buf := make([]byte, h.Len(), h.Len()+len(body))
+	switch h.Version {
+	case Version0:
+		binary.LittleEndian.PutUint32(buf, h.MsgId)
+	default:
+		buf[0] = h.Flags
+		buf[3] = h.Version
+		binary.LittleEndian.PutUint32(buf[4:8], h.RequestId)
+		binary.LittleEndian.PutUint32(buf[8:12], h.MsgId)
+	}
+
+	return append(buf, body...)
+}
@@ -0,0 +1,121 @@
+package xmetrics
+
+import (
+	"bytes"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+/*
+	prometheus监控指标, 每个服务都在/metrics上暴露
+	gin服务记录每个路由的处理时间和easygin.Result中的code, code为空表示不是Result格式的响应
+*/
+
+const (
+	// Namespace 所有指标的前缀
+	Namespace = "imchat"
+	// Path 暴露指标的路径
+	Path = "/metrics"
+
+	// 只需要响应开头的code字段
+	resultHeadLen = 32
+)
+
+var (
+	httpDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: Namespace,
+		Subsystem: "http",
+		Name:      "request_duration_seconds",
+		Help:      "HTTP request latency by route.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route", "status"})
+
+	httpResults = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: Namespace,
+		Subsystem: "http",
+		Name:      "results_total",
+		Help:      "HTTP responses by route and result code.",
+	}, []string{"method", "route", "code"})
+)
+
+// Handler 暴露默认registry中的指标
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
+
+// Register 在gin中注册/metrics, 需要在权限验证中间件之前调用, 否则会要求token
+func Register(engine *gin.Engine) {
+	engine.GET(Path, gin.WrapH(Handler()))
+}
+
+// Middleware 记录每个路由的处理时间和结果码, 没有匹配到路由的请求不记录
+func Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		route := c.FullPath()
+		if route == "" || route == Path {
+			c.Next()
+			return
+		}
+
+		w := &resultWriter{ResponseWriter: c.Writer}
+		c.Writer = w
+		start := time.Now()
+		c.Next()
+		c.Writer = w.ResponseWriter
+
+		method := c.Request.Method
+		httpDuration.WithLabelValues(method, route, strconv.Itoa(w.Status())).Observe(time.Since(start).Seconds())
+		httpResults.WithLabelValues(method, route, resultCode(w.head)).Inc()
+	}
+}
+
+// 记录响应的开头部分, 用于解析easygin.Result的code
+type resultWriter struct {
+	gin.ResponseWriter
+	head []byte
+}
+
+func (w *resultWriter) Write(data []byte) (int, error) {
+	w.capture(data)
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *resultWriter) WriteString(s string) (int, error) {
+	w.capture([]byte(s))
+	return w.ResponseWriter.WriteString(s)
+}
+
+func (w *resultWriter) capture(data []byte) {
+	if n := resultHeadLen - len(w.head); n > 0 {
+		if len(data) < n {
+			n = len(data)
+		}
+		w.head = append(w.head, data[:n]...)
+	}
+}
+
+var codePrefix = []byte(`{"code":`)
+
+// 从{"code":0,...}中解析出code, 不是Result格式时返回空
+func resultCode(head []byte) string {
+	if !bytes.HasPrefix(head, codePrefix) {
+		return ""
+	}
+	head = head[len(codePrefix):]
+	end := bytes.IndexAny(head, ",}")
+	if end <= 0 {
+		return ""
+	}
+	code := string(bytes.TrimSpace(head[:end]))
+	if _, err := strconv.Atoi(code); err != nil {
+		return ""
+	}
+
+	return code
+}
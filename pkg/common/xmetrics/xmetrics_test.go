@@ -0,0 +1,51 @@
+package xmetrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mangohow/easygin"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestResultCode(t *testing.T) {
+	cases := map[string]string{
+		`{"code":0,"message":"ok","data":null}`: "0",
+		`{"code":12}`:                           "12",
+		`{"code":"x"}`:                          "",
+		`<html>`:                                "",
+		``:                                      "",
+	}
+	for head, code := range cases {
+		if got := resultCode([]byte(head)); got != code {
+			t.Fatalf("%s: expect %q, got %q", head, code, got)
+		}
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	e := easygin.New()
+	Register(e.Engine)
+	e.Use(Middleware())
+	e.GET("/api/fail", func(ctx *gin.Context) *easygin.Result {
+		return easygin.Fail(easygin.FailCode)
+	})
+
+	for i := 0; i < 2; i++ {
+		w := httptest.NewRecorder()
+		e.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/fail", nil))
+	}
+	if n := testutil.ToFloat64(httpResults.WithLabelValues(http.MethodGet, "/api/fail", "1")); n != 2 {
+		t.Fatalf("expect 2 fail results, got %v", n)
+	}
+
+	w := httptest.NewRecorder()
+	e.ServeHTTP(w, httptest.NewRequest(http.MethodGet, Path, nil))
+	if !strings.Contains(w.Body.String(), `imchat_http_request_duration_seconds_count{method="GET",route="/api/fail",status="200"} 2`) {
+		t.Fatalf("metrics not exported:\n%s", w.Body.String())
+	}
+}
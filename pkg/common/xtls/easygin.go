@@ -0,0 +1,43 @@
+package xtls
+
+import (
+	"context"
+	"crypto/tls"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/mangohow/easygin"
+)
+
+// GraceDuration 使用https时关闭服务的最长等待时间, 和easygin默认的一致
+const GraceDuration = time.Second * 10
+
+// ServeEasyGin 启动easygin服务, tlsConfig为nil时使用http
+// easygin只支持http, 使用https时自己处理信号, 行为和easygin一致: 先调用afterClose, 然后关闭服务
+func ServeEasyGin(e *easygin.EasyGin, addr string, tlsConfig *tls.Config, afterClose ...func()) error {
+	if tlsConfig == nil {
+		e.SetAfterCloseHandlers(afterClose...)
+		return e.ListenAndServe(addr)
+	}
+
+	e.Server = &http.Server{
+		Addr:      addr,
+		Handler:   e.Engine,
+		TLSConfig: tlsConfig,
+	}
+
+	go easygin.SetupSignal(func() {
+		for _, fn := range afterClose {
+			fn()
+		}
+
+		ctx, cancelFunc := context.WithTimeout(context.Background(), GraceDuration)
+		defer cancelFunc()
+		if err := e.Server.Shutdown(ctx); err != nil {
+			log.Printf("shutdown server error:%v", err)
+		}
+	})
+
+	return e.Server.ListenAndServeTLS("", "")
+}
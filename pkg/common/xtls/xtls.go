@@ -0,0 +1,213 @@
+package xtls
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/mangohow/imchat/pkg/common/xconfig"
+)
+
+/*
+	服务器的TLS配置
+
+	证书和私钥从文件加载, 定时检查文件的修改时间, 变化后重新加载
+	新的证书只对之后的握手生效, 已经建立的连接(如websocket长连接)不受影响
+	配置了ClientCAFile时开启双向认证, 用于服务之间的内部调用:
+	RequireClientCert为false时只验证客户端提供了的证书, 浏览器等没有证书的客户端仍然可以连接
+*/
+
+// DefaultReloadInterval 默认的证书文件检查间隔
+const DefaultReloadInterval = time.Minute
+
+var ErrNoCACert = errors.New("no ca certificate found")
+
+// Enabled 是否配置了证书
+func Enabled(conf *xconfig.ServerConfig) bool {
+	return conf != nil && conf.CertFile != "" && conf.KeyFile != ""
+}
+
+// CertReloader 加载证书并在文件变化时重新加载
+type CertReloader struct {
+	certFile string
+	keyFile  string
+	caFile   string
+
+	mux       sync.RWMutex
+	cert      *tls.Certificate
+	clientCAs *x509.CertPool
+	// 上次加载时文件的修改时间
+	modTimes []time.Time
+}
+
+func NewCertReloader(certFile, keyFile, caFile string) (*CertReloader, error) {
+	r := &CertReloader{
+		certFile: certFile,
+		keyFile:  keyFile,
+		caFile:   caFile,
+	}
+	if err := r.Reload(); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+func (r *CertReloader) files() []string {
+	files := []string{r.certFile, r.keyFile}
+	if r.caFile != "" {
+		files = append(files, r.caFile)
+	}
+	return files
+}
+
+// Reload 重新加载证书, 加载失败时继续使用原来的证书
+func (r *CertReloader) Reload() error {
+	modTimes, err := statFiles(r.files())
+	if err != nil {
+		return err
+	}
+
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return err
+	}
+
+	var clientCAs *x509.CertPool
+	if r.caFile != "" {
+		if clientCAs, err = LoadCertPool(r.caFile); err != nil {
+			return err
+		}
+	}
+
+	r.mux.Lock()
+	r.cert = &cert
+	r.clientCAs = clientCAs
+	r.modTimes = modTimes
+	r.mux.Unlock()
+
+	return nil
+}
+
+// 文件是否在上次加载之后被修改
+func (r *CertReloader) changed() bool {
+	modTimes, err := statFiles(r.files())
+	if err != nil {
+		return false
+	}
+
+	r.mux.RLock()
+	defer r.mux.RUnlock()
+	for i := range modTimes {
+		if !modTimes[i].Equal(r.modTimes[i]) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Watch 定时检查证书文件, 变化后重新加载, 直到ctx结束
+// 加载失败时调用onError, 下次检查时会再次尝试
+func (r *CertReloader) Watch(ctx context.Context, interval time.Duration, onError func(err error)) {
+	if interval <= 0 {
+		interval = DefaultReloadInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if !r.changed() {
+				continue
+			}
+			if err := r.Reload(); err != nil && onError != nil {
+				onError(err)
+			}
+		}
+	}
+}
+
+// Certificate 当前使用的证书
+func (r *CertReloader) Certificate() *tls.Certificate {
+	r.mux.RLock()
+	defer r.mux.RUnlock()
+	return r.cert
+}
+
+// TLSConfig 生成服务端使用的tls.Config, 每次握手时使用最新加载的证书
+func (r *CertReloader) TLSConfig(requireClientCert bool) *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			r.mux.RLock()
+			defer r.mux.RUnlock()
+
+			config := &tls.Config{
+				MinVersion:   tls.VersionTLS12,
+				Certificates: []tls.Certificate{*r.cert},
+				// websocket只能使用http/1.1
+				NextProtos: []string{"http/1.1"},
+			}
+			if r.clientCAs != nil {
+				config.ClientCAs = r.clientCAs
+				config.ClientAuth = tls.VerifyClientCertIfGiven
+				if requireClientCert {
+					config.ClientAuth = tls.RequireAndVerifyClientCert
+				}
+			}
+
+			return config, nil
+		},
+	}
+}
+
+// NewServerConfig 根据服务配置创建tls.Config并开始监视证书文件
+// 没有配置证书时返回nil, 表示不使用TLS
+func NewServerConfig(ctx context.Context, conf *xconfig.ServerConfig, onError func(err error)) (*tls.Config, error) {
+	if !Enabled(conf) {
+		return nil, nil
+	}
+
+	reloader, err := NewCertReloader(conf.CertFile, conf.KeyFile, conf.ClientCAFile)
+	if err != nil {
+		return nil, fmt.Errorf("load certificate error:%v", err)
+	}
+	go reloader.Watch(ctx, conf.CertReloadInterval, onError)
+
+	return reloader.TLSConfig(conf.RequireClientCert), nil
+}
+
+// LoadCertPool 从PEM文件中加载CA证书
+func LoadCertPool(file string) (*x509.CertPool, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, ErrNoCACert
+	}
+
+	return pool, nil
+}
+
+func statFiles(files []string) ([]time.Time, error) {
+	modTimes := make([]time.Time, len(files))
+	for i, file := range files {
+		info, err := os.Stat(file)
+		if err != nil {
+			return nil, err
+		}
+		modTimes[i] = info.ModTime()
+	}
+
+	return modTimes, nil
+}
@@ -2,13 +2,25 @@ package xwebsocket
 
 import (
 	"net/http"
+	"strings"
 
 	"github.com/gorilla/websocket"
+	"github.com/mangohow/imchat/pkg/common/xcors"
 )
 
 type WebSocket struct {
 	*http.Server
 	WSPath string
+
+	// 握手时协商permessage-deflate
+	EnableCompression bool
+	// 压缩级别, 参考flate包, 为0时使用默认级别
+	CompressionLevel int
+	// 服务端支持的子协议, 按优先级排序, 握手时选择第一个客户端也支持的
+	Subprotocols []string
+	// 允许的Origin, 格式参考xcors.OriginMatcher, 为空时只允许同源的浏览器连接
+	// 非浏览器客户端没有Origin, 不做检查
+	AllowedOrigins []string
 }
 
 type HandlerFunc func(conn *websocket.Conn, r *http.Request)
@@ -22,24 +34,62 @@ func New(wsPath string) *WebSocket {
 }
 
 func (w *WebSocket) HandleWebSocket(handler HandlerFunc) {
+	var checkOrigin func(r *http.Request) bool
+	if len(w.AllowedOrigins) > 0 {
+		matcher := xcors.NewOriginMatcher(w.AllowedOrigins)
+		checkOrigin = func(r *http.Request) bool {
+			origin := r.Header.Get("Origin")
+			return origin == "" || matcher.Allow(origin)
+		}
+	}
+
 	w.Server.Handler = http.HandlerFunc(func(writer http.ResponseWriter, r *http.Request) {
 		if r.URL.Path != w.WSPath {
 			writer.WriteHeader(http.StatusNotImplemented)
 			return
 		}
 
-		upgrader := websocket.Upgrader{}
+		upgrader := websocket.Upgrader{
+			EnableCompression: w.EnableCompression,
+			Subprotocols:      w.Subprotocols,
+			CheckOrigin:       checkOrigin,
+		}
 		conn, err := upgrader.Upgrade(writer, r, nil)
 		if err != nil {
 			return
 		}
+		if w.CompressionNegotiated(r) && w.CompressionLevel != 0 {
+			_ = conn.SetCompressionLevel(w.CompressionLevel)
+		}
 
 
 		handler(conn, r)
 	})
 }
 
+// CompressionNegotiated 是否和客户端协商了permessage-deflate
+// 服务端开启了压缩并且客户端在握手请求中提供了permessage-deflate时, gorilla/websocket就会使用压缩
+func (w *WebSocket) CompressionNegotiated(r *http.Request) bool {
+	if !w.EnableCompression {
+		return false
+	}
+	for _, ext := range r.Header.Values("Sec-WebSocket-Extensions") {
+		for _, e := range strings.Split(ext, ",") {
+			name, _, _ := strings.Cut(e, ";")
+			if strings.TrimSpace(name) == "permessage-deflate" {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// ListenAndServe 设置了Server.TLSConfig时使用wss, 证书由TLSConfig提供
 func (w *WebSocket) ListenAndServe(addr string) error {
 	w.Server.Addr = addr
+	if w.Server.TLSConfig != nil {
+		return w.Server.ListenAndServeTLS("", "")
+	}
 	return w.Server.ListenAndServe()
 }
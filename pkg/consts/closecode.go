@@ -0,0 +1,17 @@
+package consts
+
+// websocket关闭码, 4000-4999由应用自定义
+const (
+	// CloseLoggedInElsewhere 用户在其它地方登录
+	CloseLoggedInElsewhere = 4001
+	// CloseSlowConsumer 客户端接收数据太慢, 写队列已满
+	CloseSlowConsumer = 4002
+	// CloseRateLimited 客户端多次超过请求频率限制
+	CloseRateLimited = 4003
+	// CloseUnsupportedVersion 客户端声明的协议版本不受支持
+	CloseUnsupportedVersion = 4004
+	// CloseIdleTimeout 认证过的连接长时间没有发送请求
+	CloseIdleTimeout = 4005
+	// CloseKicked 被管理员下线
+	CloseKicked = 4006
+)
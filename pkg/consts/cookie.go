@@ -0,0 +1,4 @@
+package consts
+
+// TokenCookie 登录成功后保存token的cookie, 浏览器建立websocket连接时会自动带上
+const TokenCookie = "imchat_token"
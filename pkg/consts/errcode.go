@@ -0,0 +1,21 @@
+package consts
+
+// 错误帧(ErrorMessage)中的错误码
+const (
+	// ErrCodeRateLimited 请求太频繁
+	ErrCodeRateLimited = iota + 1
+	// ErrCodeBadRequest 请求数据格式错误
+	ErrCodeBadRequest
+	// ErrCodeInternal 服务器内部错误
+	ErrCodeInternal
+	// ErrCodeUnknownMessage 不支持的消息ID
+	ErrCodeUnknownMessage
+	// ErrCodeInvalidParam 请求参数不合法
+	ErrCodeInvalidParam
+	// ErrCodeNotFriend 不是好友
+	ErrCodeNotFriend
+	// ErrCodeNotGroupMember 不是群成员
+	ErrCodeNotGroupMember
+	// ErrCodeUnsupportedVersion 客户端的协议版本不支持该消息
+	ErrCodeUnsupportedVersion
+)
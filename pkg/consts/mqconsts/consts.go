@@ -0,0 +1,7 @@
+package mqconsts
+
+// 消息队列中使用的交换机和队列名称
+const (
+	// 系统公告的fanout交换机, 每台chatserver的队列都绑定到该交换机
+	AnnouncementExchange = "chatserver.announcement"
+)
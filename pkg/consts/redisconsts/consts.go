@@ -11,6 +11,9 @@ const (
 	FriendKey = "friend:id:"
 
 	UserCounterKey = "user:counter"
+
+	GroupMembersKey = "group:members:"
+	GroupCounterKey = "group:counter"
 )
 
 const (
@@ -18,7 +21,20 @@ const (
 
 	ServerConsumerKey = "chatserver:"
 
+	// chatserver节点的租约 chat:node:<serverId> -> hash{address, load, draining, updateTime}, 带过期时间
+	ChatServerNodeKey = "chat:node:"
+	// 所有注册过的chatserver节点ID
+	ChatServerNodesKey = "chat:nodes"
+	// 回收宕机节点的锁 chat:reclaim:<serverId>, 只有一台服务器回收
+	ChatServerReclaimKey = "chat:reclaim:"
+
 	OfflineMessageQueueKey = "offlineMessages"
+
+	// 请求频率限制 ratelimit:<msgId>:uid:<uid> ratelimit:<msgId>:ip:<ip>
+	RateLimitKey = "ratelimit:"
+
+	// websocket登录票据 ws:ticket:<ticket> -> token, 只能使用一次
+	WsTicketKey = "ws:ticket:"
 )
 
 
@@ -26,6 +42,8 @@ const (
 	PhoneCodeDuration = time.Minute * 3     // 手机验证码有效期
  	PhoneCodeResendDuration = time.Minute    // 手机验证码重复发送的间隔
 	TokenExpireDuration = time.Second * 30
+	WsTicketDuration = time.Second * 30     // websocket登录票据有效期
+	NodeReclaimLockDuration = time.Minute * 5 // 回收宕机节点的锁的有效期, 回收失败时在该时间后重试
 	UserCacheExpireDuration = time.Minute * 30
 	DefaultCacheDuration
 )
@@ -18,4 +18,51 @@ const (
 	// 单向消息，只有服务端会发送给客户端
 
 	NewMessage = iota + 20000
+	FriendPresence
+	ReadReceipt
+	ErrorMessage
+	ReconnectNotify
+)
+
+// 群聊消息
+const (
+	GroupChatMessage = iota + 30001
+	GroupChatAck
+)
+
+// 服务器之间通过消息队列转发的消息，不会发送给客户端
+const (
+	KickOutNotify = iota + 40001
+	// AdminKickNotify 管理接口将用户下线, 数据为KickOut, device为空时下线所有设备
+	AdminKickNotify
+	// AdminFrameNotify 管理接口发送给用户的帧, 数据为AdminFrame
+	AdminFrameNotify
+)
+
+// 单聊的输入状态, 只转发不保存
+const (
+	TypingMessage = iota + 50001
+)
+
+// 撤回消息
+const (
+	RecallMessage = iota + 60001
+	RecallAck
+)
+
+// 编辑消息
+const (
+	EditMessage = iota + 70001
+	EditAck
+)
+
+// tcp连接的登录, websocket连接在握手阶段完成认证
+const (
+	LoginRequest = iota + 80001
+	LoginReply
+)
+
+// 系统公告, 推送给所有在线用户
+const (
+	SystemAnnouncement = iota + 90001
 )
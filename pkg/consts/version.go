@@ -0,0 +1,41 @@
+package consts
+
+import (
+	"strconv"
+	"strings"
+)
+
+// 客户端和服务器之间的协议版本, 握手时由客户端声明
+const (
+	// ProtocolV1 单聊、群聊、确认消息和新消息通知
+	ProtocolV1 = 1
+	// ProtocolV2 增加上线通知、输入状态、已读回执、撤回、编辑和系统公告
+	ProtocolV2 = 2
+
+	MinProtocolVersion = ProtocolV1
+	MaxProtocolVersion = ProtocolV2
+
+	// ProtocolVersionHeader 不使用子协议时, 通过该header声明协议版本
+	ProtocolVersionHeader = "protocol-version"
+	// SubprotocolPrefix 子协议名称的前缀, 如imchat.v2
+	SubprotocolPrefix = "imchat.v"
+	// TokenSubprotocolPrefix 浏览器不能设置authorization header, 可以通过子协议token.<jwt>传入token
+	TokenSubprotocolPrefix = "token."
+)
+
+// Subprotocol 协议版本对应的子协议名称
+func Subprotocol(version int) string {
+	return SubprotocolPrefix + strconv.Itoa(version)
+}
+
+// ParseSubprotocol 解析子协议名称中的协议版本, 不是本协议的子协议时返回false
+func ParseSubprotocol(subprotocol string) (int, bool) {
+	if !strings.HasPrefix(subprotocol, SubprotocolPrefix) {
+		return 0, false
+	}
+	version, err := strconv.Atoi(strings.TrimPrefix(subprotocol, SubprotocolPrefix))
+	if err != nil {
+		return 0, false
+	}
+	return version, true
+}
@@ -0,0 +1,56 @@
+package model
+
+import (
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// 系统公告, chatserver发布时保存, messageserver提供给离线用户拉取
+
+// AnnouncementCollection 保存公告的集合
+const AnnouncementCollection = "announcement"
+
+type Announcement struct {
+	Id      primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	Title   string             `json:"title" bson:"title"`
+	Content string             `json:"content" bson:"content"`
+	// 毫秒时间戳
+	CreateTime int64 `json:"createTime" bson:"createTime"`
+	// 过期后不再拉取, 为0时不过期
+	ExpireTime int64 `json:"expireTime" bson:"expireTime"`
+}
+
+// AnnouncementCursor 客户端收到的最后一条公告, 公告按(createTime, _id)排序
+// 位置由客户端保存, 每个设备独立, 推送和拉取到的公告都会移动位置
+type AnnouncementCursor struct {
+	CreateTime int64
+	LastId     primitive.ObjectID
+}
+
+// AnnouncementPage 一次拉取的公告, HasMore为true时需要继续拉取
+type AnnouncementPage struct {
+	Announcements []Announcement `json:"announcements"`
+	HasMore       bool           `json:"hasMore"`
+}
+
+// ActiveAnnouncementFilter 在cursor之后发布并且在now时还没有过期的公告, cursor为nil时不限制发布时间
+func ActiveAnnouncementFilter(cursor *AnnouncementCursor, now int64) bson.M {
+	active := bson.M{
+		"$or": bson.A{
+			bson.M{"expireTime": 0},
+			bson.M{"expireTime": bson.M{"$gt": now}},
+		},
+	}
+	if cursor == nil {
+		return active
+	}
+
+	return bson.M{
+		"$and": bson.A{active, bson.M{
+			"$or": bson.A{
+				bson.M{"createTime": bson.M{"$gt": cursor.CreateTime}},
+				bson.M{"createTime": cursor.CreateTime, "_id": bson.M{"$gt": cursor.LastId}},
+			},
+		}},
+	}
+}
@@ -0,0 +1,26 @@
+package model
+
+import (
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestActiveAnnouncementFilter(t *testing.T) {
+	if _, ok := ActiveAnnouncementFilter(nil, 100)["$or"]; !ok {
+		t.Fatalf("filter without cursor should only check expiration")
+	}
+
+	cursor := &AnnouncementCursor{CreateTime: 50, LastId: primitive.NewObjectID()}
+	and := ActiveAnnouncementFilter(cursor, 100)["$and"].(bson.A)
+	if len(and) != 2 {
+		t.Fatalf("expect expiration and position conditions, got %v", and)
+	}
+	// 发布时间相同的公告按_id继续拉取, 不会因为分页被跳过
+	position := and[1].(bson.M)["$or"].(bson.A)
+	same := position[1].(bson.M)
+	if same["createTime"] != int64(50) || same["_id"].(bson.M)["$gt"] != cursor.LastId {
+		t.Fatalf("unexpected position condition %v", same)
+	}
+}
@@ -1,6 +1,7 @@
 package model
 
 import (
+	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
@@ -13,8 +14,26 @@ type ChatRecord struct {
 	Message     []byte             `json:"message" bson:"message"`
 	CreateTime  int64              `json:"createTime" bson:"createTime"`
 	MessageType int32              `json:"messageType" bson:"messageType"`
-	// 消息状态   0 未读  1 已读 2 发送方删除 3 接收方删除 4 双方删除
+	// 消息状态   0 未读  1 已读 2 接收方删除 3 发送方删除 4 双方删除
+	// 删除后status不再表示是否已读, 以ReadTime来判断接收者是否已读
 	Status      int32              `json:"status" bson:"status"`
+	// 已读时间, 未读时为0
+	ReadTime    int64              `json:"readTime,omitempty" bson:"readTime,omitempty"`
+	// 消息是否被撤回, 撤回的消息查询时只返回不包含内容的记录
+	Recalled    bool               `json:"recalled,omitempty" bson:"recalled,omitempty"`
+	RecallTime  int64              `json:"recallTime,omitempty" bson:"recallTime,omitempty"`
+	// 消息是否被编辑过, Message为最新的内容
+	Edited      bool               `json:"edited,omitempty" bson:"edited,omitempty"`
+	EditedAt    int64              `json:"editedAt,omitempty" bson:"editedAt,omitempty"`
+	// 编辑之前的历史版本, 查询聊天记录时不返回
+	Revisions   []MessageRevision  `json:"revisions,omitempty" bson:"revisions,omitempty"`
+}
+
+// MessageRevision 消息的一个版本
+type MessageRevision struct {
+	Message    []byte `json:"message" bson:"message"`
+	// 该版本的创建时间, 第一个版本为消息的创建时间, 之后为编辑时间
+	CreateTime int64  `json:"createTime" bson:"createTime"`
 }
 
 const (
@@ -24,3 +43,108 @@ const (
 	RecordStatusSenderRemoved
 	RecordStatusBothRemoved
 )
+
+// RemovedBy 消息是否已经被用户uid删除
+func (r *ChatRecord) RemovedBy(uid int64) bool {
+	switch r.Status {
+	case RecordStatusBothRemoved:
+		return true
+	case RecordStatusSenderRemoved:
+		return r.Sender == uid
+	case RecordStatusReceiverRemoved:
+		return r.Receiver == uid
+	}
+	return false
+}
+
+// UnreadFilter 接收者未读消息的过滤条件
+// 发送方删除了消息, 接收者还没有读时, 仍然是接收者的未读消息
+func UnreadFilter(receiver int64) bson.M {
+	return bson.M{
+		"receiver": receiver,
+		"status":   bson.M{"$in": bson.A{RecordStatusUnread, RecordStatusSenderRemoved}},
+		"readTime": bson.M{"$exists": false},
+	}
+}
+
+// ReadFilter 接收者已读的消息的过滤条件
+// 旧版本只把status设置为已读, 没有readTime, 这些消息也算作已读
+func ReadFilter(sender, receiver int64) bson.M {
+	return bson.M{
+		"sender":   sender,
+		"receiver": receiver,
+		"$or": bson.A{
+			bson.M{"readTime": bson.M{"$gt": 0}},
+			bson.M{"status": RecordStatusRead},
+		},
+	}
+}
+
+// ReadUpdate 将消息设置为已读的更新管道, 已经被发送方删除的消息只设置readTime
+func ReadUpdate(readTime int64) bson.A {
+	return bson.A{
+		bson.M{"$set": bson.M{
+			"readTime": readTime,
+			"status": bson.M{"$cond": bson.A{
+				bson.M{"$eq": bson.A{"$status", RecordStatusUnread}}, RecordStatusRead, "$status",
+			}},
+		}},
+	}
+}
+
+// RemoveUpdate 一方删除消息的更新管道, 另一方已经删除时设置为双方删除
+// bySender为true时为发送方删除, 否则为接收方删除
+// 删除后status不再表示是否已读, 旧版本只通过status标记为已读的消息需要补上readTime, 使用createTime
+func RemoveUpdate(bySender bool) bson.A {
+	self, other := RecordStatusReceiverRemoved, RecordStatusSenderRemoved
+	if bySender {
+		self, other = other, self
+	}
+	return bson.A{
+		bson.M{"$set": bson.M{
+			"status": bson.M{"$cond": bson.A{
+				bson.M{"$in": bson.A{"$status", bson.A{other, RecordStatusBothRemoved}}}, RecordStatusBothRemoved, self,
+			}},
+			"readTime": bson.M{"$cond": bson.A{
+				bson.M{"$eq": bson.A{"$status", RecordStatusRead}}, bson.M{"$ifNull": bson.A{"$readTime", "$createTime"}}, "$readTime",
+			}},
+		}},
+	}
+}
+
+// VisibleFilter 用户id和好友friendId之间的聊天记录中, 用户id没有删除的消息的过滤条件
+func VisibleFilter(id, friendId int64) bson.M {
+	return bson.M{
+		"$or": bson.A{
+			bson.M{"sender": id, "receiver": friendId,
+				"status": bson.M{"$nin": bson.A{RecordStatusSenderRemoved, RecordStatusBothRemoved}}},
+			bson.M{"sender": friendId, "receiver": id,
+				"status": bson.M{"$nin": bson.A{RecordStatusReceiverRemoved, RecordStatusBothRemoved}}},
+		},
+	}
+}
+
+// ReadState 好友读到了自己发送的哪一条消息, 没有已读的消息时MessageId为空
+type ReadState struct {
+	FriendId  int64  `json:"friendId"`
+	MessageId string `json:"messageId"`
+	ReadUpTo  int64  `json:"readUpTo"`
+	ReadTime  int64  `json:"readTime"`
+}
+
+// ChatHistory 一页聊天记录和好友的已读状态
+type ChatHistory struct {
+	Records   []ChatRecord `json:"records"`
+	ReadState *ReadState   `json:"readState"`
+}
+
+// 群聊天记录
+
+type GroupChatRecord struct {
+	Id          primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	Sender      int64              `json:"sender" bson:"sender"`
+	GroupId     int64              `json:"groupId" bson:"groupId"`
+	Message     []byte             `json:"message" bson:"message"`
+	CreateTime  int64              `json:"createTime" bson:"createTime"`
+	MessageType int32              `json:"messageType" bson:"messageType"`
+}
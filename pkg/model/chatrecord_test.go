@@ -0,0 +1,145 @@
+package model
+
+import (
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestChatRecordRemovedBy(t *testing.T) {
+	const sender, receiver = 1, 2
+	cases := []struct {
+		status   int32
+		sender   bool
+		receiver bool
+	}{
+		{RecordStatusUnread, false, false},
+		{RecordStatusRead, false, false},
+		{RecordStatusSenderRemoved, true, false},
+		{RecordStatusReceiverRemoved, false, true},
+		{RecordStatusBothRemoved, true, true},
+	}
+
+	for _, c := range cases {
+		r := &ChatRecord{Sender: sender, Receiver: receiver, Status: c.status}
+		if r.RemovedBy(sender) != c.sender || r.RemovedBy(receiver) != c.receiver {
+			t.Fatalf("status %d: unexpected removed state", c.status)
+		}
+	}
+}
+
+func TestReadFilterIncludesLegacyStatus(t *testing.T) {
+	filter := ReadFilter(1, 2)
+	if filter["sender"] != int64(1) || filter["receiver"] != int64(2) {
+		t.Fatalf("unexpected sender/receiver: %v", filter)
+	}
+
+	var readTime, status bool
+	for _, cond := range filter["$or"].(bson.A) {
+		m := cond.(bson.M)
+		if _, ok := m["readTime"]; ok {
+			readTime = true
+		}
+		if m["status"] == RecordStatusRead {
+			status = true
+		}
+	}
+	if !readTime || !status {
+		t.Fatalf("filter should match readTime or legacy read status: %v", filter)
+	}
+}
+
+// 计算更新管道中用到的聚合表达式, 字段不存在时返回nil
+func evalExpr(expr interface{}, doc bson.M) interface{} {
+	switch e := expr.(type) {
+	case string:
+		if len(e) > 1 && e[0] == '$' {
+			return doc[e[1:]]
+		}
+		return e
+	case bson.M:
+		for op, arg := range e {
+			args := arg.(bson.A)
+			switch op {
+			case "$cond":
+				if evalExpr(args[0], doc).(bool) {
+					return evalExpr(args[1], doc)
+				}
+				return evalExpr(args[2], doc)
+			case "$eq":
+				return evalExpr(args[0], doc) == evalExpr(args[1], doc)
+			case "$in":
+				v := evalExpr(args[0], doc)
+				for _, item := range args[1].(bson.A) {
+					if item == v {
+						return true
+					}
+				}
+				return false
+			case "$ifNull":
+				if v := evalExpr(args[0], doc); v != nil {
+					return v
+				}
+				return evalExpr(args[1], doc)
+			}
+		}
+	}
+	return expr
+}
+
+// 执行只有$set阶段的更新管道, 值为nil的字段不设置
+func applyPipeline(pipeline bson.A, doc bson.M) bson.M {
+	for _, stage := range pipeline {
+		next := bson.M{}
+		for k, v := range doc {
+			next[k] = v
+		}
+		for field, expr := range stage.(bson.M)["$set"].(bson.M) {
+			if v := evalExpr(expr, doc); v != nil {
+				next[field] = v
+			}
+		}
+		doc = next
+	}
+	return doc
+}
+
+// 判断消息是否满足UnreadFilter
+func matchUnread(filter bson.M, doc bson.M) bool {
+	if doc["receiver"] != filter["receiver"] {
+		return false
+	}
+	statusIn := false
+	for _, status := range filter["status"].(bson.M)["$in"].(bson.A) {
+		statusIn = statusIn || status == doc["status"]
+	}
+	_, hasReadTime := doc["readTime"]
+	return statusIn && !hasReadTime
+}
+
+// 旧版本只通过status标记为已读的消息被发送方删除后, 仍然是已读的
+func TestRemoveUpdateKeepsLegacyReadState(t *testing.T) {
+	legacy := bson.M{"sender": int64(1), "receiver": int64(2), "status": RecordStatusRead, "createTime": int64(100)}
+	removed := applyPipeline(RemoveUpdate(true), legacy)
+	if removed["status"] != RecordStatusSenderRemoved {
+		t.Fatalf("unexpected status %v", removed["status"])
+	}
+	if removed["readTime"] != int64(100) {
+		t.Fatalf("read state should be kept in readTime, got %v", removed["readTime"])
+	}
+	if matchUnread(UnreadFilter(2), removed) {
+		t.Fatalf("removed legacy read record should not be unread")
+	}
+
+	// 未读的消息被发送方删除后仍然是接收者的未读消息
+	unread := bson.M{"sender": int64(1), "receiver": int64(2), "status": RecordStatusUnread, "createTime": int64(100)}
+	if !matchUnread(UnreadFilter(2), applyPipeline(RemoveUpdate(true), unread)) {
+		t.Fatalf("removed unread record should still be unread")
+	}
+
+	// 已经有readTime的消息不会被修改
+	read := bson.M{"sender": int64(1), "receiver": int64(2), "status": RecordStatusRead, "createTime": int64(100), "readTime": int64(200)}
+	if applyPipeline(RemoveUpdate(true), read)["readTime"] != int64(200) {
+		t.Fatalf("existing readTime should be kept")
+	}
+}
@@ -0,0 +1,36 @@
+package model
+
+import "time"
+
+type Group struct {
+	Id         int64     `json:"id" db:"id"`
+	Name       string    `json:"name" db:"name"`
+	OwnerId    int64     `json:"ownerId" db:"owner_id"` // 群主ID
+	Avatar     string    `json:"avatar" db:"avatar"`
+	Notice     string    `json:"notice" db:"notice"` // 群公告
+	CreateTime time.Time `json:"createTime" db:"create_time"`
+	Status     uint8     `json:"status" db:"status"`
+}
+
+type GroupMember struct {
+	Id       uint32    `json:"id" db:"id"`
+	GroupId  int64     `json:"groupId" db:"group_id"`
+	UserId   int64     `json:"userId" db:"user_id"`
+	Role     uint8     `json:"role" db:"role"` // 0 普通成员 1 群主
+	JoinTime time.Time `json:"joinTime" db:"join_time"`
+}
+
+const (
+	GroupRoleMember = iota
+	GroupRoleOwner
+)
+
+type GroupCreate struct {
+	Name    string  `json:"name" validate:"required,min=1,max=30"`
+	Members []int64 `json:"members" validate:"required,min=1,max=500"`
+}
+
+type GroupMembersAdd struct {
+	GroupId int64   `json:"groupId" validate:"required"`
+	Members []int64 `json:"members" validate:"required,min=1,max=500"`
+}